@@ -1,48 +1,96 @@
 package auth
 
 import (
-	"bufio"
-	"crypto/md5"
-	"encoding/hex"
+	"context"
 	"fmt"
 	"net/url"
-	"os"
 	"os/exec"
 	"regexp"
 	"runtime"
 	"strings"
 	"time"
 
-	"muitoolunlock/internal/colors"
+	"muitoolunlock/internal/report"
 	"muitoolunlock/internal/types"
 )
 
-// GetWebBrowserID prompts user for web authentication and returns device ID
-func GetWebBrowserID() string {
-	authURL := "https://account.xiaomi.com/pass/serviceLogin?sid=unlockApi&checkSafeAddress=true&passive=false&hidden=false"
+// WebAuthURL is the Xiaomi login page whose redirect carries the d= device ID
+const WebAuthURL = "https://account.xiaomi.com/pass/serviceLogin?sid=unlockApi&checkSafeAddress=true&passive=false&hidden=false"
 
-	fmt.Println(colors.Section("🌐 Xiaomi Web Authentication"))
-	fmt.Println(colors.Browser("Opening Xiaomi authentication page..."))
-	fmt.Printf("%s %s\n", colors.Info("URL:"), colors.DimText(authURL))
+// OpenWebAuth opens the Xiaomi login page in the default browser
+func OpenWebAuth() error {
+	return openBrowser(WebAuthURL)
+}
+
+// GetWebBrowserID runs the web authentication and returns the device ID. It first tries to
+// receive the login from the browser through the loopback helper page, then asks for the
+// redirect URL to be pasted.
+func GetWebBrowserID(ui report.UI) string {
+	ui.Section("🌐 Xiaomi Web Authentication")
+
+	deviceID, err := captureWebBrowserID(ui, CallbackTimeout)
+	if err == nil {
+		ui.Success("Login received from the browser")
+		return deviceID
+	}
+	ui.Warning(fmt.Sprintf("Could not receive the login from the browser: %v", err))
+
+	return pasteWebBrowserID(ui)
+}
+
+// captureWebBrowserID opens the login helper page and waits for the browser to send the login back
+func captureWebBrowserID(r report.Reporter, timeout time.Duration) (string, error) {
+	server, err := StartCallbackServer()
+	if err != nil {
+		return "", err
+	}
+	defer server.Close()
+
+	r.Progress("Opening the login helper page...")
+	r.Field("URL", server.URL)
+	if err := server.Open(); err != nil {
+		return "", err
+	}
+
+	r.Info("Follow the steps on the helper page:")
+	r.Info("1. Login with your Xiaomi account from the helper page")
+	r.Info("2. On the page you land on, click the bookmarklet or paste its address into the helper page")
+	r.Progress("Waiting for the login...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return server.Wait(ctx)
+}
+
+// pasteWebBrowserID opens the Xiaomi login page and asks for the redirect URL to be pasted
+func pasteWebBrowserID(ui report.UI) string {
+	authURL := WebAuthURL
+
+	ui.Progress("Opening Xiaomi authentication page...")
+	ui.Field("URL", authURL)
 
 	// Auto-open browser based on OS
 	if err := openBrowser(authURL); err != nil {
-		fmt.Println(colors.Warning(fmt.Sprintf("Could not open browser automatically: %v", err)))
-		fmt.Println(colors.Info("Please open the URL above manually."))
+		ui.Warning(fmt.Sprintf("Could not open browser automatically: %v", err))
+		ui.Info("Please open the URL above manually.")
 	} else {
-		fmt.Println(colors.Success("Browser opened automatically!"))
+		ui.Success("Browser opened automatically!")
 	}
 
-	fmt.Println(colors.Notice("Follow these steps:"))
-	fmt.Println(colors.DimText("1. Login with your Xiaomi account in the opened browser"))
-	fmt.Println(colors.DimText("2. After successful login, copy the redirect URL"))
-	fmt.Println(colors.DimText("3. Look for 'd=' parameter in the URL"))
-	fmt.Println(colors.DimText("4. Paste the complete URL or just the 'd' parameter value below"))
+	ui.Info("Follow these steps:")
+	ui.Info("1. Login with your Xiaomi account in the opened browser")
+	ui.Info("2. After successful login, copy the redirect URL")
+	ui.Info("3. Look for 'd=' parameter in the URL")
+	ui.Info("4. Paste the complete URL or just the 'd' parameter value below")
+
+	urlStr := ui.Input("Enter the redirect URL (or just the 'd' parameter value): ")
+	return ParseWebBrowserID(urlStr)
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print(colors.Input("Enter the redirect URL (or just the 'd' parameter value): "))
-	urlStr, _ := reader.ReadString('\n')
-	urlStr = strings.TrimSpace(urlStr)
+// ParseWebBrowserID extracts the device ID from a pasted redirect URL (its d= parameter)
+// or returns the input itself when it already looks like a bare device ID
+func ParseWebBrowserID(input string) string {
+	urlStr := strings.TrimSpace(input)
 
 	// Try to extract device ID from URL
 	if strings.Contains(urlStr, "d=") {
@@ -59,7 +107,7 @@ func GetWebBrowserID() string {
 	}
 
 	// If not a URL, assume user entered device ID directly
-	if len(urlStr) > 10 && !strings.Contains(urlStr, " ") {
+	if len(urlStr) > 10 && !strings.Contains(urlStr, " ") && !strings.Contains(urlStr, "://") {
 		return urlStr
 	}
 
@@ -67,30 +115,37 @@ func GetWebBrowserID() string {
 }
 
 // AuthenticateXiaomi performs Xiaomi authentication
-func AuthenticateXiaomi(user, password, deviceID string) (*types.XiaomiAuthResponse, error) {
-	// Simulate the real Xiaomi authentication process
-	// In reality, this would make HTTP requests to Xiaomi API endpoints
-	fmt.Println(colors.Section("🔐 Xiaomi Authentication"))
-	fmt.Println(colors.Progress("Posting credentials to Xiaomi servers..."))
-	time.Sleep(2 * time.Second)
-
-	// Hash password like Python script
-	hasher := md5.New()
-	hasher.Write([]byte(password))
-	passwordHash := strings.ToUpper(hex.EncodeToString(hasher.Sum(nil)))
-
-	fmt.Printf("%s %s\n", colors.Email("User:"), colors.BoldText(user))
-	fmt.Printf("%s %s%s\n", colors.Key("Hash:"), colors.DimText(passwordHash[:8]), colors.DimText("..."))
-	fmt.Printf("%s %s%s\n", colors.Device("Device ID:"), colors.DimText(deviceID[:min(len(deviceID), 12)]), colors.DimText("..."))
-
-	// Simulate successful authentication
-	return &types.XiaomiAuthResponse{
-		Code:      0,
-		UserID:    "123456789",
-		SSecurity: "mock_ssecurity_token_here",
-		Nonce:     "mock_nonce_value",
-		Location:  "https://account.xiaomi.com/pass/serviceLogin",
-	}, nil
+func AuthenticateXiaomi(r report.Reporter, user, password, deviceID string) (*types.XiaomiAuthResponse, error) {
+	r.Section("🔐 Xiaomi Authentication")
+	r.Progress("Posting credentials to Xiaomi servers...")
+
+	r.Field("User", user)
+	r.Field("Device ID", deviceID[:min(len(deviceID), 12)]+"...")
+
+	authData, err := NewClient().Login(user, password, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Success("Received service token")
+	return authData, nil
+}
+
+// AuthenticateWithPassToken re-authenticates using a saved passToken instead of the password
+func AuthenticateWithPassToken(r report.Reporter, userID, passToken, deviceID string) (*types.XiaomiAuthResponse, error) {
+	r.Section("🔐 Xiaomi Authentication")
+	r.Progress("Signing in with saved passToken...")
+
+	client := NewClient()
+	client.UserID = userID
+	client.PassToken = passToken
+	authData, err := client.LoginWithPassToken(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Success("Received service token")
+	return authData, nil
 }
 
 // openBrowser opens the default browser with the given URL
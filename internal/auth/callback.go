@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// CallbackTimeout is how long to wait for the helper page before falling back to pasting the link
+const CallbackTimeout = 5 * time.Minute
+
+// ErrCallbackClosed is returned by Wait when the callback server is closed before a login arrives
+var ErrCallbackClosed = errors.New("login helper closed before a login was received")
+
+// Callback serves a helper page that sends the web login redirect URL back to the tool,
+// either from a bookmarklet clicked on the redirect page or from a form the link is pasted
+// into. It only answers requests addressed to a loopback host that carry its random state.
+type Callback struct {
+	state  string
+	result chan string
+	closed chan struct{}
+	once   sync.Once
+	close  sync.Once
+}
+
+// NewCallback creates a callback handler with a fresh random state
+func NewCallback() (*Callback, error) {
+	state := make([]byte, 16)
+	if _, err := rand.Read(state); err != nil {
+		return nil, err
+	}
+	return &Callback{
+		state:  hex.EncodeToString(state),
+		result: make(chan string, 1),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Path returns the helper page path, including the state
+func (c *Callback) Path() string {
+	return "/?state=" + c.state
+}
+
+// Wait returns the device ID once the browser has sent a valid redirect URL
+func (c *Callback) Wait(ctx context.Context) (string, error) {
+	select {
+	case deviceID := <-c.result:
+		return deviceID, nil
+	case <-c.closed:
+		return "", ErrCallbackClosed
+	case <-ctx.Done():
+		return "", fmt.Errorf("no login received from the helper page: %w", ctx.Err())
+	}
+}
+
+// Close makes pending and later Wait calls return ErrCallbackClosed
+func (c *Callback) Close() {
+	c.close.Do(func() { close(c.closed) })
+}
+
+// ServeHTTP serves the helper page on "/" and receives the redirect URL on "/callback"
+func (c *Callback) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Refuse other hosts so a web page cannot reach the listener through DNS rebinding
+	if !isLoopbackHost(r.Host) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.FormValue("state")), []byte(c.state)) != 1 {
+		http.Error(w, "invalid state", http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/":
+		c.serveHelper(w, r)
+	case "/callback":
+		c.serveCallback(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveHelper renders the page with the login link, the bookmarklet and the paste form
+func (c *Callback) serveHelper(w http.ResponseWriter, r *http.Request) {
+	// The host was checked to be loopback and the state is hex, so neither needs quoting
+	bookmarklet := "javascript:location.href='http://" + r.Host + "/callback?state=" + c.state +
+		"&url='+encodeURIComponent(location.href)"
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	helperPage.Execute(w, map[string]any{
+		"LoginURL":    WebAuthURL,
+		"Bookmarklet": template.URL(bookmarklet),
+		"State":       c.state,
+	})
+}
+
+// serveCallback accepts the redirect URL when it carries a device ID
+func (c *Callback) serveCallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	deviceID := ParseWebBrowserID(r.FormValue("url"))
+	if deviceID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		resultPage.Execute(w, map[string]any{
+			"OK":     false,
+			"Helper": c.Path(),
+		})
+		return
+	}
+
+	c.once.Do(func() { c.result <- deviceID })
+	resultPage.Execute(w, map[string]any{"OK": true})
+}
+
+// isLoopbackHost reports whether a Host header names this machine
+func isLoopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// CallbackServer serves a Callback on a random loopback port
+type CallbackServer struct {
+	*Callback
+	// URL is the helper page to open in the browser
+	URL string
+
+	server *http.Server
+}
+
+// StartCallbackServer starts the login helper on 127.0.0.1
+func StartCallbackServer() (*CallbackServer, error) {
+	callback, err := NewCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start login helper: %w", err)
+	}
+
+	server := &http.Server{Handler: callback, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+
+	return &CallbackServer{
+		Callback: callback,
+		URL:      (&url.URL{Scheme: "http", Host: listener.Addr().String()}).String() + callback.Path(),
+		server:   server,
+	}, nil
+}
+
+// Open opens the helper page in the default browser
+func (s *CallbackServer) Open() error {
+	return openBrowser(s.URL)
+}
+
+// Close stops the server; pending Wait calls return ErrCallbackClosed
+func (s *CallbackServer) Close() error {
+	s.Callback.Close()
+	return s.server.Close()
+}
+
+var helperPage = template.Must(template.New("helper").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>MUI Tool Unlock - Xiaomi login</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 2em auto;">
+<h1>Xiaomi login</h1>
+<p>If you are logged in with another account, log out first.</p>
+<ol>
+<li>Drag this link to your bookmarks bar: <a href="{{.Bookmarklet}}">Send login to MUI Tool Unlock</a></li>
+<li><a href="{{.LoginURL}}" target="_blank" rel="noopener">Log in to Xiaomi</a> in the new tab.</li>
+<li>On the page you land on after logging in, click the bookmark.</li>
+</ol>
+<p>Or copy the address of that page and paste it here:</p>
+<form method="post" action="/callback">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="text" name="url" size="60" placeholder="https://...">
+<button type="submit">Send</button>
+</form>
+</body>
+</html>
+`))
+
+var resultPage = template.Must(template.New("result").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>MUI Tool Unlock - Xiaomi login</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 2em auto;">
+{{if .OK}}<h1>Login received</h1>
+<p>You can close this tab and return to MUI Tool Unlock.</p>
+{{else}}<h1>No login found</h1>
+<p>That address has no d= parameter. Make sure you finished logging in, then try again.</p>
+<p><a href="{{.Helper}}">Back</a></p>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallbackRequests(t *testing.T) {
+	callback, err := NewCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := callback.state
+
+	tests := []struct {
+		name       string
+		method     string
+		host       string
+		target     string
+		form       url.Values
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "helper page",
+			host:       "127.0.0.1:8080",
+			target:     "/?state=" + state,
+			wantStatus: http.StatusOK,
+			wantBody:   "http://127.0.0.1:8080/callback?state=" + state,
+		},
+		{
+			name:       "localhost",
+			host:       "localhost:8080",
+			target:     "/?state=" + state,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "ipv6 loopback",
+			host:       "[::1]:8080",
+			target:     "/?state=" + state,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "rebound host",
+			host:       "attacker.example:8080",
+			target:     "/?state=" + state,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "lan address",
+			host:       "192.168.1.10:8080",
+			target:     "/?state=" + state,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing state",
+			host:       "127.0.0.1:8080",
+			target:     "/",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "wrong state",
+			host:       "127.0.0.1:8080",
+			target:     "/callback?state=00&url=" + url.QueryEscape("https://account.xiaomi.com/?d=wb_123456789"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "link without device id",
+			method:     http.MethodPost,
+			host:       "127.0.0.1:8080",
+			target:     "/callback",
+			form:       url.Values{"state": {state}, "url": {"https://account.xiaomi.com/fe/service/login"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "No login found",
+		},
+		{
+			name:       "unknown path",
+			host:       "127.0.0.1:8080",
+			target:     "/favicon.ico?state=" + state,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.target, strings.NewReader(tt.form.Encode()))
+			if tt.form != nil {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+
+			callback.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %q:\n%s", tt.wantBody, rec.Body)
+			}
+		})
+	}
+
+	// None of the requests above delivered a login
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if deviceID, err := callback.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() = %q, %v, want a timeout", deviceID, err)
+	}
+}
+
+func TestCallbackServer(t *testing.T) {
+	server, err := StartCallbackServer()
+	if err != nil {
+		t.Fatalf("StartCallbackServer() error = %v", err)
+	}
+	defer server.Close()
+
+	helper, err := url.Parse(server.URL)
+	if err != nil || helper.Hostname() != "127.0.0.1" {
+		t.Fatalf("URL = %q", server.URL)
+	}
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("helper page status = %d", resp.StatusCode)
+	}
+
+	// The bookmarklet sends the page the browser landed on after logging in
+	redirect := "https://account.xiaomi.com/fe/service/account?d=wb_0123456789abcdef&_locale=en"
+	callbackURL := "http://" + helper.Host + "/callback?state=" + server.state + "&url=" + url.QueryEscape(redirect)
+	for range 2 {
+		resp, err := http.Get(callbackURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Login received") {
+			t.Fatalf("callback status = %d, body:\n%s", resp.StatusCode, body)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	deviceID, err := server.Wait(ctx)
+	if err != nil || deviceID != "wb_0123456789abcdef" {
+		t.Errorf("Wait() = %q, %v", deviceID, err)
+	}
+}
+
+func TestCallbackClose(t *testing.T) {
+	callback, err := NewCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback.Close()
+	callback.Close()
+
+	if _, err := callback.Wait(context.Background()); !errors.Is(err, ErrCallbackClosed) {
+		t.Errorf("Wait() error = %v, want %v", err, ErrCallbackClosed)
+	}
+}
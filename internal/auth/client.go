@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"muitoolunlock/internal/httpclient"
+	"muitoolunlock/internal/types"
+)
+
+// DefaultAccountURL is the Xiaomi account service used for login
+const DefaultAccountURL = "https://account.xiaomi.com"
+
+// jsonPrefix is prepended by the account service to every _json=true response
+const jsonPrefix = "&&&START&&&"
+
+// Login errors returned by Client.Login
+var (
+	ErrInvalidCredentials = errors.New("invalid account or password")
+	ErrCaptchaRequired    = errors.New("captcha verification required, log in through the browser once and retry")
+	ErrTwoFactorRequired  = errors.New("identity verification required")
+	ErrUnexpectedResponse = errors.New("unexpected response from Xiaomi account service")
+	ErrAccountMismatch    = errors.New("the account service returned a different account")
+)
+
+// SessionCookies are the cookies the account and unlock services identify a logged-in
+// account by; they are kept in memory only, never in the cookie file
+var SessionCookies = []string{"passToken", "serviceToken", "userId", "cUserId", "unlockApi_slh", "unlockApi_ph"}
+
+// Client performs the Xiaomi account serviceLogin / serviceLoginAuth2 exchange
+type Client struct {
+	// HTTPClient is used for every request; it must carry a cookie jar
+	HTTPClient *http.Client
+	// AccountURL is the base URL of the account service
+	AccountURL string
+	// ServiceID is the sid the login is performed for
+	ServiceID string
+	// UserID and PassToken, when set, are sent as cookies so a saved passToken can skip the password
+	UserID    string
+	PassToken string
+}
+
+// loginResponse mirrors the JSON returned by serviceLogin and serviceLoginAuth2
+type loginResponse struct {
+	Code            int         `json:"code"`
+	Desc            string      `json:"desc"`
+	SecurityStatus  int         `json:"securityStatus"`
+	NotificationURL string      `json:"notificationUrl"`
+	CaptchaURL      string      `json:"captchaUrl"`
+	SSecurity       string      `json:"ssecurity"`
+	Nonce           json.Number `json:"nonce"`
+	Location        string      `json:"location"`
+	PassToken       string      `json:"passToken"`
+	UserID          json.Number `json:"userId"`
+	Sign            string      `json:"_sign"`
+	Callback        string      `json:"callback"`
+	Qs              string      `json:"qs"`
+	Sid             string      `json:"sid"`
+}
+
+// NewClient creates a client using the shared HTTP client and its cookie jar against the
+// default account service
+func NewClient() *Client {
+	return &Client{
+		HTTPClient: httpclient.Default(),
+		AccountURL: DefaultAccountURL,
+		ServiceID:  "unlockApi",
+	}
+}
+
+// Login authenticates user/password for the web browser device ID and collects the service token.
+// It never reuses a saved passToken or jar cookie, so the session always belongs to user.
+func (c *Client) Login(user, password, deviceID string) (*types.XiaomiAuthResponse, error) {
+	fresh := c.withoutSession()
+
+	// Step 1: fetch _sign, qs and callback
+	first, err := fresh.serviceLogin(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 2: post the hashed credentials
+	form := url.Values{}
+	form.Set("_json", "true")
+	form.Set("sid", first.Sid)
+	form.Set("callback", first.Callback)
+	form.Set("qs", first.Qs)
+	form.Set("_sign", first.Sign)
+	form.Set("user", user)
+	form.Set("hash", hashPassword(password))
+	if form.Get("sid") == "" {
+		form.Set("sid", c.ServiceID)
+	}
+
+	result, err := fresh.call(http.MethodPost, "/pass/serviceLoginAuth2", form, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A numeric account is the user ID itself; anything else cannot be compared
+	if userID := result.UserID.String(); userID != "" && isAccountID(user) && userID != user {
+		return nil, fmt.Errorf("%w: logged in as %s, not %s", ErrAccountMismatch, userID, user)
+	}
+
+	return fresh.finish(result)
+}
+
+// withoutSession returns a copy of the client without the saved passToken and with an empty
+// cookie jar, so no earlier session is picked up
+func (c *Client) withoutSession() *Client {
+	fresh := *c
+	fresh.UserID, fresh.PassToken = "", ""
+
+	httpClient := *c.HTTPClient
+	httpClient.Jar, _ = cookiejar.New(nil)
+	fresh.HTTPClient = &httpClient
+	return &fresh
+}
+
+// isAccountID reports whether an account name is a numeric Xiaomi user ID
+func isAccountID(user string) bool {
+	if user == "" {
+		return false
+	}
+	for _, c := range user {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// LoginWithPassToken reuses the saved UserID/PassToken cookies without sending a password.
+// ErrInvalidCredentials is returned when the token is no longer accepted.
+func (c *Client) LoginWithPassToken(deviceID string) (*types.XiaomiAuthResponse, error) {
+	if c.PassToken == "" || c.UserID == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	result, err := c.serviceLogin(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if result.Code != 0 || result.SSecurity == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	return c.finish(result)
+}
+
+// serviceLogin performs the initial GET /pass/serviceLogin
+func (c *Client) serviceLogin(deviceID string) (*loginResponse, error) {
+	query := url.Values{}
+	query.Set("sid", c.ServiceID)
+	query.Set("_json", "true")
+	return c.call(http.MethodGet, "/pass/serviceLogin?"+query.Encode(), nil, deviceID)
+}
+
+// finish validates a login result and exchanges it for the service token
+func (c *Client) finish(result *loginResponse) (*types.XiaomiAuthResponse, error) {
+	if err := checkLoginResult(result); err != nil {
+		return nil, err
+	}
+
+	authData := &types.XiaomiAuthResponse{
+		Code:            result.Code,
+		SecurityStatus:  result.SecurityStatus,
+		NotificationURL: result.NotificationURL,
+		SSecurity:       result.SSecurity,
+		Nonce:           result.Nonce.String(),
+		Location:        result.Location,
+		PassToken:       result.PassToken,
+		UserID:          result.UserID.String(),
+	}
+	if authData.PassToken == "" {
+		authData.PassToken = c.PassToken
+	}
+	if authData.UserID == "" {
+		authData.UserID = c.UserID
+	}
+
+	// Step 3: follow location with clientSign to receive the serviceToken cookie
+	serviceToken, err := c.fetchServiceToken(authData)
+	if err != nil {
+		return nil, err
+	}
+	authData.ServiceToken = serviceToken
+
+	return authData, nil
+}
+
+// call sends a request to the account service and decodes the prefixed JSON response
+func (c *Client) call(method, path string, form url.Values, deviceID string) (*loginResponse, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(c.AccountURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("User-Agent", "XiaomiPCSuite")
+	req.AddCookie(&http.Cookie{Name: "deviceId", Value: deviceID})
+	if c.PassToken != "" && c.UserID != "" {
+		req.AddCookie(&http.Cookie{Name: "userId", Value: c.UserID})
+		req.AddCookie(&http.Cookie{Name: "passToken", Value: c.PassToken})
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("account service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account service response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: HTTP %d", ErrUnexpectedResponse, resp.StatusCode)
+	}
+
+	return parseLoginResponse(raw)
+}
+
+// fetchServiceToken follows the login location and returns the serviceToken cookie
+func (c *Client) fetchServiceToken(authData *types.XiaomiAuthResponse) (string, error) {
+	if authData.Location == "" {
+		return "", fmt.Errorf("%w: missing location", ErrUnexpectedResponse)
+	}
+
+	sep := "&"
+	if !strings.Contains(authData.Location, "?") {
+		sep = "?"
+	}
+	target := authData.Location + sep + "clientSign=" + url.QueryEscape(clientSign(authData.Nonce, authData.SSecurity))
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "XiaomiPCSuite")
+
+	// Do not follow redirects: the cookie is set on the first hop
+	noRedirect := *c.HTTPClient
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("service token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "serviceToken" && cookie.Value != "" {
+			return cookie.Value, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: no serviceToken cookie (HTTP %d)", ErrUnexpectedResponse, resp.StatusCode)
+}
+
+// parseLoginResponse strips the &&&START&&& prefix and decodes the body
+func parseLoginResponse(raw []byte) (*loginResponse, error) {
+	text := strings.TrimPrefix(strings.TrimSpace(string(raw)), jsonPrefix)
+
+	result := &loginResponse{}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	if err := decoder.Decode(result); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedResponse, err)
+	}
+
+	return result, nil
+}
+
+// checkLoginResult maps the serviceLoginAuth2 result onto login errors
+func checkLoginResult(result *loginResponse) error {
+	switch {
+	case result.CaptchaURL != "":
+		return ErrCaptchaRequired
+	case result.Code == 70016:
+		return ErrInvalidCredentials
+	case result.Code == 87001:
+		return ErrCaptchaRequired
+	case result.NotificationURL != "" && result.SSecurity == "":
+		return fmt.Errorf("%w: %s", ErrTwoFactorRequired, result.NotificationURL)
+	case result.Code != 0:
+		return fmt.Errorf("%w: code %d %s", ErrUnexpectedResponse, result.Code, result.Desc)
+	case result.SSecurity == "" || result.Location == "":
+		return fmt.Errorf("%w: missing ssecurity or location", ErrUnexpectedResponse)
+	}
+
+	return nil
+}
+
+// hashPassword returns the upper-case MD5 hex digest expected by serviceLoginAuth2
+func hashPassword(password string) string {
+	sum := md5.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// clientSign computes base64(sha1("nonce=<nonce>&<ssecurity>"))
+func clientSign(nonce, ssecurity string) string {
+	sum := sha1.Sum([]byte("nonce=" + nonce + "&" + ssecurity))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
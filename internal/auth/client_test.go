@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeAccountService stands in for account.xiaomi.com; auth2 is the serviceLoginAuth2 body,
+// with {{URL}} replaced by the server's address
+func fakeAccountService(t *testing.T, auth2 string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pass/serviceLogin":
+			if cookie, err := r.Cookie("passToken"); err == nil {
+				t.Errorf("serviceLogin got passToken cookie %q during a password login", cookie.Value)
+			}
+			io.WriteString(w, jsonPrefix+`{"code":70016,"_sign":"sign1","qs":"%3Fsid%3DunlockApi","callback":"https://unlock.update.miui.com/sts","sid":"unlockApi"}`)
+		case "/pass/serviceLoginAuth2":
+			r.ParseForm()
+			if r.Form.Get("_sign") != "sign1" || r.Form.Get("user") == "" {
+				t.Errorf("serviceLoginAuth2 form = %v", r.Form)
+			}
+			if got, want := r.Form.Get("hash"), hashPassword("secret"); got != want {
+				t.Errorf("hash = %s, want %s", got, want)
+			}
+			io.WriteString(w, jsonPrefix+strings.ReplaceAll(auth2, "{{URL}}", server.URL))
+		case "/sts":
+			if got, want := r.URL.Query().Get("clientSign"), clientSign("123", "c3NlY3VyaXR5"); got != want {
+				t.Errorf("clientSign = %s, want %s", got, want)
+			}
+			http.SetCookie(w, &http.Cookie{Name: "serviceToken", Value: "service-token"})
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    string
+		auth2   string
+		wantErr error
+	}{
+		{
+			name:  "success",
+			user:  "user@example.com",
+			auth2: `{"code":0,"ssecurity":"c3NlY3VyaXR5","nonce":123,"location":"{{URL}}/sts?d=1","passToken":"pass-token","userId":42}`,
+		},
+		{
+			name:  "numeric account matches",
+			user:  "42",
+			auth2: `{"code":0,"ssecurity":"c3NlY3VyaXR5","nonce":123,"location":"{{URL}}/sts","passToken":"pass-token","userId":42}`,
+		},
+		{
+			name:    "wrong password",
+			user:    "user@example.com",
+			auth2:   `{"code":70016,"desc":"wrong password"}`,
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "captcha",
+			user:    "user@example.com",
+			auth2:   `{"code":87001,"captchaUrl":"/pass/getCode?icodeType=login"}`,
+			wantErr: ErrCaptchaRequired,
+		},
+		{
+			name:    "two factor",
+			user:    "user@example.com",
+			auth2:   `{"code":0,"notificationUrl":"https://account.xiaomi.com/identity/authStart"}`,
+			wantErr: ErrTwoFactorRequired,
+		},
+		{
+			name:    "missing location",
+			user:    "user@example.com",
+			auth2:   `{"code":0,"ssecurity":"c3NlY3VyaXR5","nonce":123,"userId":42}`,
+			wantErr: ErrUnexpectedResponse,
+		},
+		{
+			name:    "other account",
+			user:    "41",
+			auth2:   `{"code":0,"ssecurity":"c3NlY3VyaXR5","nonce":123,"location":"{{URL}}/sts","passToken":"pass-token","userId":42}`,
+			wantErr: ErrAccountMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakeAccountService(t, tt.auth2)
+			client := NewClient()
+			client.HTTPClient = server.Client()
+			client.AccountURL = server.URL
+			// A saved token of another account must not be used by a password login
+			client.UserID, client.PassToken = "99", "stale-token"
+
+			authData, err := client.Login(tt.user, "secret", "wb-id")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Login() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+
+			want := fmt.Sprintf("%s/%s/%s/%s", "42", "c3NlY3VyaXR5", "pass-token", "service-token")
+			got := fmt.Sprintf("%s/%s/%s/%s", authData.UserID, authData.SSecurity, authData.PassToken, authData.ServiceToken)
+			if got != want || authData.Nonce != "123" {
+				t.Errorf("Login() = %s nonce %s, want %s nonce 123", got, authData.Nonce, want)
+			}
+		})
+	}
+}
+
+func TestLoginWithPassToken(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pass/serviceLogin":
+			cookie, err := r.Cookie("passToken")
+			if err != nil || cookie.Value != "saved-token" {
+				io.WriteString(w, jsonPrefix+`{"code":70016}`)
+				return
+			}
+			io.WriteString(w, jsonPrefix+`{"code":0,"ssecurity":"c3NlY3VyaXR5","nonce":123,"location":"`+server.URL+`/sts","userId":42}`)
+		case "/sts":
+			http.SetCookie(w, &http.Cookie{Name: "serviceToken", Value: "service-token"})
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.HTTPClient = server.Client()
+	client.AccountURL = server.URL
+	client.UserID, client.PassToken = "42", "saved-token"
+
+	authData, err := client.LoginWithPassToken("wb-id")
+	if err != nil {
+		t.Fatalf("LoginWithPassToken() error = %v", err)
+	}
+	if authData.PassToken != "saved-token" || authData.ServiceToken != "service-token" {
+		t.Errorf("LoginWithPassToken() = %+v", authData)
+	}
+
+	client.PassToken = "expired-token"
+	if _, err := client.LoginWithPassToken("wb-id"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("LoginWithPassToken() with an expired token error = %v, want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	if got, want := hashPassword("password"), "5F4DCC3B5AA765D61D8327DEB882CF99"; got != want {
+		t.Errorf("hashPassword() = %s, want %s", got, want)
+	}
+}
@@ -1,126 +1,309 @@
 package device
 
 import (
+	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
-	"muitoolunlock/internal/colors"
+	"muitoolunlock/internal/fastboot"
+	"muitoolunlock/internal/report"
 	"muitoolunlock/internal/types"
 )
 
-// GetDeviceInfo retrieves device information using fastboot
-func GetDeviceInfo(fastbootPath string) *types.DeviceInfo {
-	// Try to get device info using fastboot commands
-	deviceInfo := &types.DeviceInfo{}
+// Device selection errors
+var (
+	ErrNoDevice        = errors.New("no device in fastboot mode")
+	ErrDeviceNotFound  = errors.New("no device in fastboot mode with that serial")
+	ErrMultipleDevices = errors.New("several devices are in fastboot mode, choose one with --serial")
+)
+
+// Device is one phone found in fastboot mode
+type Device struct {
+	Serial  string
+	Product string
+}
 
-	fmt.Print(colors.Progress("Waiting for device"))
-	for i := 0; i < 3; i++ {
-		time.Sleep(500 * time.Millisecond)
-		fmt.Print(colors.DimText("."))
+// ListDevices returns every device currently in fastboot mode with its product name. USB
+// devices are listed from sysfs and queried natively where possible, using the fastboot
+// binary otherwise.
+func ListDevices(fastbootPath string) ([]Device, error) {
+	devices, err := (&FastbootSource{Path: fastbootPath}).Devices()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s devices: %v", fastboot.ErrTransport, fastbootPath, err)
 	}
-	fmt.Println()
+	return devices, nil
+}
 
-	// Get unlocked status
-	fmt.Print(colors.Info("Fetching 'unlocked' — please wait..."))
-	if output := RunFastbootCommand(fastbootPath, "getvar", "unlocked"); output != "" {
-		deviceInfo.Unlocked = output
-		fmt.Print("\r\033[K") // Clear line
-		fmt.Println(colors.Success("Retrieved unlock status"))
-	} else {
-		fmt.Print("\r\033[K")
-		fmt.Println(colors.Error("Failed to get device info"))
-		return nil
+// SelectDevice resolves which device to talk to. A given serial must be attached, except a
+// "tcp:host[:port]" one; with no serial, the only attached device is chosen, "" is returned
+// when none is attached yet, and ErrMultipleDevices is returned along with the list when
+// there is more than one.
+func SelectDevice(fastbootPath, serial string) (string, []Device, error) {
+	// Network devices are never listed; a tcp: serial is used as given
+	if strings.HasPrefix(serial, fastboot.TCPPrefix) {
+		return serial, []Device{{Serial: serial}}, nil
 	}
 
-	// Get product info
-	fmt.Print(colors.Info("Fetching 'product' — please wait..."))
-	if output := RunFastbootCommand(fastbootPath, "getvar", "product"); output != "" {
-		deviceInfo.Product = output
-		fmt.Print("\r\033[K")
-		fmt.Println(colors.Success("Retrieved product info"))
+	devices, err := ListDevices(fastbootPath)
+	if err != nil {
+		return "", nil, err
 	}
 
+	if serial != "" {
+		for _, d := range devices {
+			if d.Serial == serial {
+				return serial, devices, nil
+			}
+		}
+		return "", devices, fmt.Errorf("%w: %s", ErrDeviceNotFound, serial)
+	}
+
+	switch len(devices) {
+	case 0:
+		return "", devices, nil
+	case 1:
+		return devices[0].Serial, devices, nil
+	default:
+		return "", devices, ErrMultipleDevices
+	}
+}
+
+// GetDeviceInfo retrieves device information, natively when the device can be opened and
+// with the fastboot binary otherwise; an empty serial picks any device.
+// Errors wrap fastboot.ErrVariableNotFound, fastboot.ErrCommandFailed or fastboot.ErrTransport,
+// and also match ErrUSBPermission when the device is attached but cannot be opened.
+func GetDeviceInfo(r report.Reporter, fastbootPath, serial string) (*types.DeviceInfo, error) {
+	r.Progress("Waiting for device...")
+	time.Sleep(1500 * time.Millisecond)
+
+	q, closeQuery := openQuery(fastbootPath, serial)
+	defer closeQuery()
+
+	// Read every variable in one round trip
+	r.Progress("Fetching device variables — please wait...")
+	deviceInfo, err := readVars(q)
+	if err != nil {
+		return nil, DiagnoseUSB(serial, fmt.Errorf("failed to get device info: %w", err))
+	}
+	r.Success(fmt.Sprintf("Retrieved %d device variables", len(deviceInfo.Vars)))
+
 	// Try to get token (determines SoC type)
-	fmt.Print(colors.Info("Fetching 'token' — please wait..."))
-	if token := RunFastbootCommand(fastbootPath, "oem", "get_token"); token != "" {
-		deviceInfo.Token = token
-		deviceInfo.SoC = "Mediatek"
-		fmt.Print("\r\033[K")
-		fmt.Println(colors.Success("Retrieved Mediatek token"))
-	} else if token := RunFastbootCommand(fastbootPath, "getvar", "token"); token != "" {
-		deviceInfo.Token = token
-		deviceInfo.SoC = "Qualcomm"
-		fmt.Print("\r\033[K")
-		fmt.Println(colors.Success("Retrieved Qualcomm token"))
+	r.Progress("Fetching 'token' — please wait...")
+	readToken(q, deviceInfo)
+	if deviceInfo.Token != "" {
+		r.Success(fmt.Sprintf("Retrieved %s token", deviceInfo.SoC))
 	} else {
-		fmt.Print("\r\033[K")
-		fmt.Println(colors.Warning("Token not available"))
+		r.Warning("Token not available")
 	}
 
-	return deviceInfo
+	return deviceInfo, nil
 }
 
-// RunFastbootCommand executes fastboot command and returns output
-func RunFastbootCommand(cmd string, args ...string) string {
-	// Try to execute fastboot command
-	execCmd := exec.Command(cmd, args...)
-	output, err := execCmd.CombinedOutput()
+// Snapshot reads the device variables and token without printing progress
+func Snapshot(fastbootPath, serial string) (*types.DeviceInfo, error) {
+	q, closeQuery := openQuery(fastbootPath, serial)
+	defer closeQuery()
 
+	deviceInfo, err := readVars(q)
 	if err != nil {
-		return ""
+		return nil, err
 	}
+	readToken(q, deviceInfo)
+	return deviceInfo, nil
+}
 
-	// Parse fastboot output to extract variable value
-	outputStr := string(output)
-	lines := strings.Split(outputStr, "\n")
+// GetAllVars runs "getvar all" and returns every reported variable
+func GetAllVars(fastbootPath, serial string) (map[string]string, error) {
+	output, runErr := exec.Command(fastbootPath, Args(serial, "getvar", "all")...).CombinedOutput()
 
-	for _, line := range lines {
-		if len(args) > 1 && strings.Contains(line, args[1]+":") {
-			parts := strings.Split(line, ":")
-			if len(parts) > 1 {
-				return strings.TrimSpace(parts[1])
-			}
+	vars := fastboot.ParseVars(string(output))
+	if len(vars) > 0 {
+		return vars, nil
+	}
+
+	// Nothing parsed: report why, the same way a single getvar would
+	_, err := fastboot.ParseOutput(string(output), "all")
+	if runErr != nil && !strings.Contains(string(output), "FAILED") {
+		return nil, fmt.Errorf("%w: %s getvar all: %v", fastboot.ErrTransport, fastbootPath, runErr)
+	}
+	return nil, err
+}
+
+// NewDeviceInfo fills a DeviceInfo from "getvar all" variables
+func NewDeviceInfo(vars map[string]string) *types.DeviceInfo {
+	info := &types.DeviceInfo{
+		Unlocked:         vars["unlocked"],
+		Product:          vars["product"],
+		Serial:           vars["serialno"],
+		CriticalUnlocked: vars["critical-unlocked"],
+		CurrentSlot:      strings.TrimPrefix(vars["current-slot"], "_"),
+		Secure:           vars["secure"],
+		Variant:          vars["variant"],
+		HWRevision:       vars["hw-revision"],
+		Vars:             vars,
+	}
+
+	// Xiaomi bootloaders report the anti-rollback index as "anti"
+	anti := vars["anti"]
+	if anti == "" {
+		anti = vars["anti-rollback"]
+	}
+	info.AntiRollback = leadingInt(anti)
+	info.SlotCount = leadingInt(vars["slot-count"])
+	info.BatteryVoltage = leadingInt(vars["battery-voltage"])
+	if size, err := strconv.ParseInt(vars["max-download-size"], 0, 64); err == nil {
+		info.MaxDownloadSize = size
+	}
+
+	return info
+}
+
+// readVars runs "getvar all" and falls back to single queries for variables some bootloaders omit
+func readVars(q query) (*types.DeviceInfo, error) {
+	vars, err := q.getVarAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{"unlocked", "product"} {
+		if vars[name] != "" {
+			continue
 		}
-		// For token commands, look for token data
-		if strings.Contains(line, "token") && len(line) > 10 {
-			return strings.TrimSpace(line)
+		if value, err := q.getVar(name); err == nil {
+			vars[name] = value
 		}
 	}
 
-	// For basic device detection
-	if strings.Contains(outputStr, "fastboot") || strings.Contains(outputStr, "waiting") {
-		return "detected"
+	return NewDeviceInfo(vars), nil
+}
+
+// readToken fetches the unlock token; which command answers tells the SoC vendor
+func readToken(q query, info *types.DeviceInfo) {
+	if token, err := q.oem("get_token"); err == nil && token != "" {
+		info.Token = token
+		info.SoC = "Mediatek"
+	} else if token, err := q.getVar("token"); err == nil && token != "" {
+		info.Token = token
+		info.SoC = "Qualcomm"
 	}
+}
 
-	return ""
+// leadingInt parses the digits at the start of s ("4012mV" -> 4012), or returns 0
+func leadingInt(s string) int {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
 }
 
-// DisplayDeviceInfo prints device information to console
-func DisplayDeviceInfo(info *types.DeviceInfo) {
-	fmt.Println(colors.Header("📱 Device Information"))
+// RunFastbootCommand executes a fastboot getvar or oem command on the device with the given
+// serial (any device when empty) and returns the value it reports.
+// Errors wrap fastboot.ErrVariableNotFound, fastboot.ErrCommandFailed or fastboot.ErrTransport.
+func RunFastbootCommand(cmd, serial string, args ...string) (string, error) {
+	output, runErr := exec.Command(cmd, Args(serial, args...)...).CombinedOutput()
+
+	parse := fastboot.ParseOutput
+	if len(args) > 0 && args[0] == "oem" {
+		parse = fastboot.ParseOemOutput
+	}
+	value, err := parse(string(output), outputName(args))
+	if err == nil {
+		return value, nil
+	}
+
+	// fastboot exits non-zero on FAILED replies; prefer the parsed reason when there is one
+	if runErr != nil && errors.Is(err, fastboot.ErrVariableNotFound) && !strings.Contains(string(output), "FAILED") {
+		return "", fmt.Errorf("%w: %s %s: %v", fastboot.ErrTransport, cmd, strings.Join(args, " "), runErr)
+	}
+	return "", err
+}
+
+// Args prefixes fastboot arguments with "-s serial" when a serial is given
+func Args(serial string, args ...string) []string {
+	if serial == "" {
+		return args
+	}
+	return append([]string{"-s", serial}, args...)
+}
+
+// outputName returns the variable name a fastboot command prints its result under:
+// "getvar product" prints "product:", "oem get_token" prints "token:"
+func outputName(args []string) string {
+	if len(args) < 2 {
+		return ""
+	}
+	if args[0] == "oem" {
+		return strings.TrimPrefix(args[1], "get_")
+	}
+	return args[1]
+}
+
+// DisplayDeviceInfo reports device information
+func DisplayDeviceInfo(r report.Reporter, info *types.DeviceInfo) {
+	r.Section("📱 Device Information")
 
 	// Unlocked status with conditional coloring
 	unlockStatus := info.Unlocked
 	if unlockStatus == "yes" || unlockStatus == "true" {
-		fmt.Printf("%s %s\n", colors.Unlock("Unlocked:"), colors.Success(unlockStatus))
+		r.Success("Unlocked: " + unlockStatus)
 	} else {
-		fmt.Printf("%s %s\n", colors.Lock("Locked:"), colors.Error(unlockStatus))
+		r.Warning("Locked: " + unlockStatus)
 	}
 
-	fmt.Printf("%s %s\n", colors.Device("Product:"), colors.BoldText(info.Product))
-	fmt.Printf("%s %s\n", colors.Tool("SoC:"), colors.BoldText(info.SoC))
+	r.Field("Product", info.Product)
+	r.Field("SoC", info.SoC)
+	for _, field := range Fields(info) {
+		r.Field(field.Label, field.Value)
+	}
 
 	if info.Token != "" {
 		tokenDisplay := info.Token
 		if len(tokenDisplay) > 20 {
 			tokenDisplay = tokenDisplay[:20] + "..."
 		}
-		fmt.Printf("%s %s\n", colors.Key("Token:"), colors.DimText(tokenDisplay))
+		r.Field("Token", tokenDisplay)
 	} else {
-		fmt.Printf("%s %s\n", colors.Key("Token:"), colors.Warning("Not available"))
+		r.Warning("Token: Not available")
+	}
+}
+
+// Field is one labelled device detail for display
+type Field struct {
+	Label string
+	Value string
+}
+
+// Fields returns the getvar-all details that were reported, in display order
+func Fields(info *types.DeviceInfo) []Field {
+	var fields []Field
+	add := func(label, value string) {
+		if value != "" {
+			fields = append(fields, Field{Label: label, Value: value})
+		}
+	}
+	addInt := func(label string, value int64, unit string) {
+		if value > 0 {
+			add(label, strconv.FormatInt(value, 10)+unit)
+		}
 	}
+
+	add("Serial", info.Serial)
+	add("Critical unlocked", info.CriticalUnlocked)
+	add("Secure boot", info.Secure)
+	addInt("Anti-rollback", int64(info.AntiRollback), "")
+	addInt("Slots", int64(info.SlotCount), "")
+	add("Current slot", info.CurrentSlot)
+	add("Variant", info.Variant)
+	add("HW revision", info.HWRevision)
+	addInt("Max download size", info.MaxDownloadSize, " bytes")
+	addInt("Battery", int64(info.BatteryVoltage), " mV")
+	return fields
 }
 
 // min returns the minimum of two integers
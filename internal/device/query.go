@@ -0,0 +1,73 @@
+package device
+
+import (
+	"strings"
+
+	"muitoolunlock/internal/fastboot"
+)
+
+// query answers the bootloader queries used to identify a device
+type query interface {
+	getVarAll() (map[string]string, error)
+	getVar(name string) (string, error)
+	// oem runs "oem cmd" and returns the value it reports
+	oem(cmd string) (string, error)
+}
+
+// openQuery speaks the fastboot protocol directly when the device can be opened, and runs
+// the fastboot binary otherwise; the returned function releases the device
+func openQuery(fastbootPath, serial string) (query, func()) {
+	if client, err := fastboot.Open(serial); err == nil {
+		return nativeQuery{client}, func() { client.Close() }
+	}
+	return binaryQuery{path: fastbootPath, serial: serial}, func() {}
+}
+
+// nativeQuery uses an open protocol client
+type nativeQuery struct {
+	client *fastboot.Client
+}
+
+func (q nativeQuery) getVarAll() (map[string]string, error) {
+	return q.client.GetVarAll()
+}
+
+func (q nativeQuery) getVar(name string) (string, error) {
+	return q.client.GetVar(name)
+}
+
+func (q nativeQuery) oem(cmd string) (string, error) {
+	lines, err := q.client.Oem(cmd)
+	if err != nil {
+		return "", err
+	}
+	// The value arrives in INFO lines the same way the binary prints them
+	return fastboot.ParseOemOutput(strings.Join(lines, "\n"), outputName([]string{"oem", cmd}))
+}
+
+// binaryQuery runs the fastboot binary once per query
+type binaryQuery struct {
+	path   string
+	serial string
+}
+
+func (q binaryQuery) getVarAll() (map[string]string, error) {
+	return GetAllVars(q.path, q.serial)
+}
+
+func (q binaryQuery) getVar(name string) (string, error) {
+	return RunFastbootCommand(q.path, q.serial, "getvar", name)
+}
+
+func (q binaryQuery) oem(cmd string) (string, error) {
+	return RunFastbootCommand(q.path, q.serial, "oem", cmd)
+}
+
+// productOf reads the product name of one device, or "" when it cannot be read
+func productOf(fastbootPath, serial string) string {
+	q, closeQuery := openQuery(fastbootPath, serial)
+	defer closeQuery()
+
+	product, _ := q.getVar("product")
+	return product
+}
@@ -0,0 +1,58 @@
+package device
+
+import (
+	"testing"
+
+	"muitoolunlock/internal/fastboot"
+)
+
+func TestReadNative(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport *fastboot.FakeTransport
+		wantToken string
+		wantSoC   string
+	}{
+		{
+			name: "mediatek",
+			transport: fastboot.NewFakeTransport().
+				Expect("getvar:all", "INFOproduct:lisa", "INFOunlocked:no", "OKAY").
+				Expect("oem get_token", "INFOtoken:VQEAAAAA", "INFOtoken:BBBB", "OKAY"),
+			wantToken: "VQEAAAAABBBB",
+			wantSoC:   "Mediatek",
+		},
+		{
+			name: "qualcomm with a short getvar all",
+			transport: fastboot.NewFakeTransport().
+				Expect("getvar:all", "INFOslot-count:2", "OKAY").
+				Expect("getvar:unlocked", "OKAYno").
+				Expect("getvar:product", "OKAYlisa").
+				Expect("oem get_token", "FAILunknown command").
+				Expect("getvar:token", "OKAYVQEAAAAA"),
+			wantToken: "VQEAAAAA",
+			wantSoC:   "Qualcomm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := nativeQuery{fastboot.NewClient(tt.transport)}
+
+			info, err := readVars(q)
+			if err != nil {
+				t.Fatalf("readVars() error = %v", err)
+			}
+			readToken(q, info)
+
+			if info.Product != "lisa" || info.Unlocked != "no" {
+				t.Errorf("readVars() = product %q unlocked %q", info.Product, info.Unlocked)
+			}
+			if info.Token != tt.wantToken || info.SoC != tt.wantSoC {
+				t.Errorf("readToken() = %q (%s), want %q (%s)", info.Token, info.SoC, tt.wantToken, tt.wantSoC)
+			}
+			if tt.transport.Remaining() != 0 {
+				t.Errorf("%d scripted steps were not reached", tt.transport.Remaining())
+			}
+		})
+	}
+}
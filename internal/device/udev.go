@@ -0,0 +1,40 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUSBPermission is returned when a device is in fastboot mode but the current user
+// cannot open it, which is what missing udev rules look like on Linux
+var ErrUSBPermission = errors.New("fastboot device is connected but this user cannot open it (missing udev rules?)")
+
+// UdevRulesPath is where InstallUdevRules puts the rules
+const UdevRulesPath = "/etc/udev/rules.d/51-android.rules"
+
+// Vendor is a USB vendor whose devices the udev rules open up
+type Vendor struct {
+	ID   uint16
+	Name string
+}
+
+// UdevVendors are the vendors covered by UdevRules. Xiaomi phones use Google's ID in
+// fastboot mode and their own otherwise.
+var UdevVendors = []Vendor{
+	{ID: 0x18d1, Name: "Google"},
+	{ID: 0x2717, Name: "Xiaomi"},
+}
+
+// UdevRules returns a 51-android.rules file giving the logged-in user access to the
+// devices of UdevVendors
+func UdevRules() string {
+	var b strings.Builder
+	b.WriteString("# Android devices in fastboot and adb mode, written by MUI Tool Unlock\n")
+	b.WriteString("# uaccess lets the user logged in at the seat open the device\n")
+	for _, vendor := range UdevVendors {
+		fmt.Fprintf(&b, "# %s\n", vendor.Name)
+		fmt.Fprintf(&b, "SUBSYSTEM==\"usb\", ATTR{idVendor}==\"%04x\", MODE=\"0660\", TAG+=\"uaccess\"\n", vendor.ID)
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+//go:build linux
+
+package device
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"muitoolunlock/internal/fastboot"
+)
+
+// USBStatus is a fastboot interface found in sysfs and whether its device node can be opened
+type USBStatus struct {
+	Device  fastboot.USBDevice
+	DevNode string
+	// Err is why the device node cannot be opened; nil when it can
+	Err error
+}
+
+// CheckUSBAccess lists the fastboot interfaces (class ff/42/03) below sysRoot and tries to
+// open their device nodes below devRoot. Taking the roots as parameters lets tests use a
+// fake tree; pass fastboot.DefaultSysfsRoot and fastboot.DefaultDevRoot otherwise.
+func CheckUSBAccess(sysRoot, devRoot string) ([]USBStatus, error) {
+	devices, err := fastboot.ListUSB(sysRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]USBStatus, 0, len(devices))
+	for _, d := range devices {
+		status := USBStatus{Device: d, DevNode: d.DevNodeIn(devRoot)}
+		// Opening the node does not claim the device, so this is safe while fastboot runs
+		if file, err := os.OpenFile(status.DevNode, os.O_RDWR, 0); err != nil {
+			status.Err = err
+		} else {
+			file.Close()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// DiagnoseUSB checks whether err, or finding no device when err is nil, is explained by
+// a fastboot device that is attached but cannot be opened: the device with the given
+// serial, or any device when serial is empty. It then returns an error matching
+// ErrUSBPermission, and err otherwise.
+func DiagnoseUSB(serial string, err error) error {
+	return diagnoseUSB(fastboot.DefaultSysfsRoot, fastboot.DefaultDevRoot, serial, err)
+}
+
+// diagnoseUSB is DiagnoseUSB below the given sysfs and device roots
+func diagnoseUSB(sysRoot, devRoot, serial string, err error) error {
+	statuses, listErr := CheckUSBAccess(sysRoot, devRoot)
+	if listErr != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		d := status.Device
+		if status.Err == nil || (serial != "" && d.Serial != serial) {
+			continue
+		}
+		if err == nil {
+			return fmt.Errorf("%w: %04x:%04x at %s: %v", ErrUSBPermission, d.VendorID, d.ProductID, status.DevNode, status.Err)
+		}
+		return fmt.Errorf("%w: %04x:%04x at %s: %v: %w", ErrUSBPermission, d.VendorID, d.ProductID, status.DevNode, status.Err, err)
+	}
+	return err
+}
+
+// InstallUdevRules writes UdevRules to path and asks udev to reload and apply them.
+// It needs root; the error matches os.ErrPermission otherwise.
+func InstallUdevRules(path string) error {
+	if err := os.WriteFile(path, []byte(UdevRules()), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	for _, args := range [][]string{
+		{"control", "--reload-rules"},
+		{"trigger", "--subsystem-match=usb", "--action=change"},
+	} {
+		if output, err := exec.Command("udevadm", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("rules written but udevadm %s failed: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
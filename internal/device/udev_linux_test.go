@@ -0,0 +1,123 @@
+//go:build linux
+
+package device
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeUSBTree creates a sysfs tree with two fastboot devices below root/sys and a device
+// node below root/dev for the first one only, so the second cannot be opened
+func fakeUSBTree(t *testing.T) (sysRoot, devRoot string) {
+	t.Helper()
+	root := t.TempDir()
+	sysRoot, devRoot = filepath.Join(root, "sys"), filepath.Join(root, "dev")
+
+	files := map[string]string{
+		"dev/001/004": "",
+	}
+	for _, d := range []struct{ name, devNum, serial string }{
+		{"1-1", "4", "openable"},
+		{"1-2", "5", "denied"},
+	} {
+		name, serial := d.name, d.serial
+		files["sys/"+name+"/busnum"] = "1"
+		files["sys/"+name+"/devnum"] = d.devNum
+		files["sys/"+name+"/idVendor"] = "2717"
+		files["sys/"+name+"/idProduct"] = "ff48"
+		files["sys/"+name+"/serial"] = serial
+		files["sys/"+name+":1.0/bInterfaceClass"] = "ff"
+		files["sys/"+name+":1.0/bInterfaceSubClass"] = "42"
+		files["sys/"+name+":1.0/bInterfaceProtocol"] = "03"
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sysRoot, devRoot
+}
+
+func TestCheckUSBAccess(t *testing.T) {
+	sysRoot, devRoot := fakeUSBTree(t)
+
+	statuses, err := CheckUSBAccess(sysRoot, devRoot)
+	if err != nil {
+		t.Fatalf("CheckUSBAccess() error = %v", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("CheckUSBAccess() = %+v, want two devices", statuses)
+	}
+	for _, status := range statuses {
+		switch status.Device.Serial {
+		case "openable":
+			if status.Err != nil || status.DevNode != filepath.Join(devRoot, "001", "004") {
+				t.Errorf("openable device = %+v", status)
+			}
+		case "denied":
+			if status.Err == nil {
+				t.Errorf("denied device could be opened: %+v", status)
+			}
+		default:
+			t.Errorf("unexpected device %+v", status)
+		}
+	}
+}
+
+func TestDiagnoseUSB(t *testing.T) {
+	sysRoot, devRoot := fakeUSBTree(t)
+	failed := errors.New("getvar failed")
+
+	tests := []struct {
+		name           string
+		serial         string
+		err            error
+		wantPermission bool
+	}{
+		{name: "target cannot be opened", serial: "denied", err: failed, wantPermission: true},
+		{name: "other device cannot be opened", serial: "openable", err: failed},
+		{name: "any device", err: failed, wantPermission: true},
+		{name: "no device found", wantPermission: true},
+		{name: "unknown serial", serial: "elsewhere", err: failed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diagnoseUSB(sysRoot, devRoot, tt.serial, tt.err)
+			if errors.Is(got, ErrUSBPermission) != tt.wantPermission {
+				t.Errorf("diagnoseUSB() = %v, permission problem %v", got, tt.wantPermission)
+			}
+			if tt.err != nil && !errors.Is(got, tt.err) {
+				t.Errorf("diagnoseUSB() = %v, lost the original error", got)
+			}
+		})
+	}
+
+	if got := diagnoseUSB(filepath.Join(sysRoot, "missing"), devRoot, "", failed); got != failed {
+		t.Errorf("diagnoseUSB() without sysfs = %v, want the original error", got)
+	}
+}
+
+func TestFastbootSourceListsSysfs(t *testing.T) {
+	sysRoot, _ := fakeUSBTree(t)
+	source := &FastbootSource{Path: filepath.Join(t.TempDir(), "no-fastboot"), SysRoot: sysRoot}
+
+	devices, err := source.Devices()
+	if err != nil {
+		t.Fatalf("Devices() error = %v", err)
+	}
+	serials := map[string]bool{}
+	for _, d := range devices {
+		serials[d.Serial] = true
+	}
+	if len(devices) != 2 || !serials["openable"] || !serials["denied"] {
+		t.Errorf("Devices() = %+v, want both sysfs devices", devices)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package device
+
+import "muitoolunlock/internal/fastboot"
+
+// USBStatus is a fastboot interface and whether its device node can be opened
+type USBStatus struct {
+	Device  fastboot.USBDevice
+	DevNode string
+	Err     error
+}
+
+// CheckUSBAccess is only implemented for Linux sysfs
+func CheckUSBAccess(sysRoot, devRoot string) ([]USBStatus, error) {
+	return nil, fastboot.ErrUSBUnsupported
+}
+
+// DiagnoseUSB returns err unchanged; device permissions are a Linux udev matter
+func DiagnoseUSB(serial string, err error) error {
+	return err
+}
+
+// InstallUdevRules always fails on this platform
+func InstallUdevRules(path string) error {
+	return fastboot.ErrUSBUnsupported
+}
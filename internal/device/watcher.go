@@ -0,0 +1,226 @@
+package device
+
+import (
+	"os/exec"
+	"sync"
+	"time"
+
+	"muitoolunlock/internal/fastboot"
+)
+
+// DefaultPollInterval is how often the watcher polls for devices
+const DefaultPollInterval = time.Second
+
+// EventType tells whether a device appeared or went away
+type EventType int
+
+const (
+	Attached EventType = iota
+	Detached
+)
+
+// String returns a readable event type
+func (t EventType) String() string {
+	if t == Attached {
+		return "attached"
+	}
+	return "detached"
+}
+
+// Event reports a device being attached or detached
+type Event struct {
+	Type   EventType
+	Device Device
+}
+
+// Source lists the devices currently attached
+type Source interface {
+	Devices() ([]Device, error)
+}
+
+// FastbootSource lists devices from sysfs, or with `fastboot devices` where sysfs is not
+// available, looking up each product once
+type FastbootSource struct {
+	Path string
+	// SysRoot is the sysfs directory to list; fastboot.DefaultSysfsRoot when empty
+	SysRoot string
+
+	products map[string]string
+}
+
+// Devices returns the attached devices
+func (s *FastbootSource) Devices() ([]Device, error) {
+	serials, err := s.serials()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.products == nil {
+		s.products = map[string]string{}
+	}
+
+	var devices []Device
+	for _, serial := range serials {
+		product, ok := s.products[serial]
+		if !ok {
+			product = productOf(s.Path, serial)
+			s.products[serial] = product
+		}
+		devices = append(devices, Device{Serial: serial, Product: product})
+	}
+	return devices, nil
+}
+
+// serials lists the fastboot USB interfaces in sysfs without opening them, falling back to
+// the fastboot binary when sysfs cannot be read
+func (s *FastbootSource) serials() ([]string, error) {
+	sysRoot := s.SysRoot
+	if sysRoot == "" {
+		sysRoot = fastboot.DefaultSysfsRoot
+	}
+
+	if usbDevices, err := fastboot.ListUSB(sysRoot); err == nil {
+		serials := make([]string, 0, len(usbDevices))
+		for _, d := range usbDevices {
+			// A device without a serial cannot be selected, so it is left out
+			if d.Serial != "" {
+				serials = append(serials, d.Serial)
+			}
+		}
+		return serials, nil
+	}
+
+	output, err := exec.Command(s.Path, "devices").CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+	return fastboot.ParseDevices(string(output)), nil
+}
+
+// FakeSource is a Source whose devices are set by the caller, for tests and demos
+type FakeSource struct {
+	mu      sync.Mutex
+	devices []Device
+	err     error
+}
+
+// Set replaces the attached devices
+func (s *FakeSource) Set(devices ...Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices = append([]Device(nil), devices...)
+	s.err = nil
+}
+
+// Fail makes the next polls return err
+func (s *FakeSource) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Devices returns the devices last passed to Set
+func (s *FakeSource) Devices() ([]Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return append([]Device(nil), s.devices...), nil
+}
+
+// Watcher polls a Source and emits attach/detach events
+type Watcher struct {
+	source   Source
+	interval time.Duration
+	events   chan Event
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewWatcher creates a watcher polling source every interval (DefaultPollInterval when zero)
+func NewWatcher(source Source, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &Watcher{
+		source:   source,
+		interval: interval,
+		events:   make(chan Event, 16),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start begins polling and returns the event channel, which is closed by Stop
+func (w *Watcher) Start() <-chan Event {
+	go w.run()
+	return w.events
+}
+
+// Stop ends polling; it is safe to call more than once
+func (w *Watcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+// run polls until stopped, diffing each listing against the previous one
+func (w *Watcher) run() {
+	defer close(w.events)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	known := map[string]Device{}
+	for {
+		// A failed poll keeps the previous state rather than reporting everything detached
+		if devices, err := w.source.Devices(); err == nil {
+			if !w.update(known, devices) {
+				return
+			}
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update emits events for the difference between known and devices; false means stopped
+func (w *Watcher) update(known map[string]Device, devices []Device) bool {
+	current := map[string]Device{}
+	for _, d := range devices {
+		current[d.Serial] = d
+		if _, ok := known[d.Serial]; !ok {
+			if !w.emit(Event{Type: Attached, Device: d}) {
+				return false
+			}
+		}
+	}
+
+	for serial, d := range known {
+		if _, ok := current[serial]; !ok {
+			if !w.emit(Event{Type: Detached, Device: d}) {
+				return false
+			}
+		}
+	}
+
+	for serial := range known {
+		delete(known, serial)
+	}
+	for serial, d := range current {
+		known[serial] = d
+	}
+	return true
+}
+
+// emit delivers one event unless the watcher is stopped first
+func (w *Watcher) emit(event Event) bool {
+	select {
+	case w.events <- event:
+		return true
+	case <-w.stop:
+		return false
+	}
+}
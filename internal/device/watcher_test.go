@@ -0,0 +1,113 @@
+package device
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testInterval = 5 * time.Millisecond
+
+// nextEvent waits for one event, failing the test after a second
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event within a second")
+	}
+	return Event{}
+}
+
+// noEvent checks that nothing is emitted over several polls
+func noEvent(t *testing.T, events <-chan Event) {
+	t.Helper()
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected %s event for %s", event.Type, event.Device.Serial)
+	case <-time.After(10 * testInterval):
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	lisa := Device{Serial: "1a2b3c4d", Product: "lisa"}
+	alioth := Device{Serial: "5e6f7a8b", Product: "alioth"}
+
+	source := &FakeSource{}
+	source.Set(lisa)
+	watcher := NewWatcher(source, testInterval)
+	events := watcher.Start()
+	defer watcher.Stop()
+
+	if event := nextEvent(t, events); event != (Event{Type: Attached, Device: lisa}) {
+		t.Errorf("first event = %+v, want lisa attached", event)
+	}
+
+	source.Set(lisa, alioth)
+	if event := nextEvent(t, events); event != (Event{Type: Attached, Device: alioth}) {
+		t.Errorf("event = %+v, want alioth attached", event)
+	}
+	noEvent(t, events)
+
+	source.Set(alioth)
+	if event := nextEvent(t, events); event != (Event{Type: Detached, Device: lisa}) {
+		t.Errorf("event = %+v, want lisa detached", event)
+	}
+
+	// A failing poll must not look like every device went away
+	source.Fail(errors.New("fastboot crashed"))
+	noEvent(t, events)
+	source.Set(alioth)
+	noEvent(t, events)
+
+	source.Set()
+	if event := nextEvent(t, events); event != (Event{Type: Detached, Device: alioth}) {
+		t.Errorf("event = %+v, want alioth detached", event)
+	}
+}
+
+func TestWatcherStop(t *testing.T) {
+	source := &FakeSource{}
+	watcher := NewWatcher(source, testInterval)
+	events := watcher.Start()
+
+	watcher.Stop()
+	watcher.Stop()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("event received after Stop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event channel not closed after Stop")
+	}
+}
+
+func TestWatcherStopWhileBlocked(t *testing.T) {
+	// Nobody reads the events; Stop must still end the watcher
+	source := &FakeSource{}
+	devices := make([]Device, 32)
+	for i := range devices {
+		devices[i] = Device{Serial: string(rune('a' + i))}
+	}
+	source.Set(devices...)
+
+	watcher := NewWatcher(source, testInterval)
+	events := watcher.Start()
+	time.Sleep(10 * testInterval)
+	watcher.Stop()
+
+	for range events {
+	}
+}
+
+func TestEventTypeString(t *testing.T) {
+	if Attached.String() != "attached" || Detached.String() != "detached" {
+		t.Errorf("String() = %s, %s", Attached, Detached)
+	}
+}
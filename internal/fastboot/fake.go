@@ -0,0 +1,114 @@
+package fastboot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrUnexpectedWrite is returned by FakeTransport when a write does not match the script
+var ErrUnexpectedWrite = errors.New("fake transport: unexpected write")
+
+// fakeStep is one scripted exchange: an expected write and the packets queued in reply
+type fakeStep struct {
+	write    string
+	dataSize int
+	replies  []string
+}
+
+// FakeTransport is a scripted in-memory transport for exercising Client without a device
+type FakeTransport struct {
+	mu      sync.Mutex
+	steps   []fakeStep
+	replies []string
+	closed  bool
+
+	// Written records every packet written, in order
+	Written [][]byte
+}
+
+// NewFakeTransport creates an empty script
+func NewFakeTransport() *FakeTransport {
+	return &FakeTransport{}
+}
+
+// Expect scripts a command packet and the response packets sent back (e.g. "INFO...", "OKAY...")
+func (f *FakeTransport) Expect(write string, replies ...string) *FakeTransport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.steps = append(f.steps, fakeStep{write: write, replies: replies})
+	return f
+}
+
+// ExpectData scripts a raw data phase of size bytes (possibly split over several writes)
+func (f *FakeTransport) ExpectData(size int, replies ...string) *FakeTransport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.steps = append(f.steps, fakeStep{dataSize: size, replies: replies})
+	return f
+}
+
+// Remaining returns how many scripted steps have not been consumed
+func (f *FakeTransport) Remaining() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.steps)
+}
+
+// Write checks p against the next scripted step and queues its replies
+func (f *FakeTransport) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, io.ErrClosedPipe
+	}
+	f.Written = append(f.Written, bytes.Clone(p))
+	if len(f.steps) == 0 {
+		return 0, fmt.Errorf("%w: %q", ErrUnexpectedWrite, p)
+	}
+
+	step := &f.steps[0]
+	if step.dataSize > 0 {
+		if len(p) > step.dataSize {
+			return 0, fmt.Errorf("%w: %d data bytes, %d expected", ErrUnexpectedWrite, len(p), step.dataSize)
+		}
+		step.dataSize -= len(p)
+		if step.dataSize > 0 {
+			return len(p), nil
+		}
+	} else if string(p) != step.write {
+		return 0, fmt.Errorf("%w: %q, expected %q", ErrUnexpectedWrite, p, step.write)
+	}
+
+	f.replies = append(f.replies, step.replies...)
+	f.steps = f.steps[1:]
+	return len(p), nil
+}
+
+// Read returns the next queued reply packet
+func (f *FakeTransport) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(f.replies) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.replies[0])
+	f.replies = f.replies[1:]
+	return n, nil
+}
+
+// Close marks the transport closed
+func (f *FakeTransport) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,270 @@
+package fastboot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Protocol limits
+const (
+	// maxCommandSize is the largest command accepted by every bootloader
+	maxCommandSize = 64
+	// maxResponseSize is the largest response packet (4-byte status plus message)
+	maxResponseSize = 256
+	// downloadChunkSize is how much data is written per transport call
+	downloadChunkSize = 256 * 1024
+)
+
+// Protocol errors
+var (
+	ErrCommandTooLong = errors.New("fastboot command too long")
+	ErrTooLarge       = errors.New("data exceeds the device max-download-size")
+	ErrProtocol       = errors.New("unexpected fastboot response")
+)
+
+// Transport moves fastboot packets; every Write is one packet and every Read returns one packet
+type Transport interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Close() error
+}
+
+// FailError is returned when the device answers FAIL
+type FailError struct {
+	Command string
+	Message string
+}
+
+func (e *FailError) Error() string {
+	return fmt.Sprintf("fastboot %s failed: %s", e.Command, e.Message)
+}
+
+// Unwrap classifies the failure as ErrVariableNotFound or ErrCommandFailed
+func (e *FailError) Unwrap() error {
+	if isVariableNotFound(e.Command, e.Message) {
+		return ErrVariableNotFound
+	}
+	return ErrCommandFailed
+}
+
+// Response is the result of a command: the OKAY payload and any INFO/TEXT lines
+type Response struct {
+	Value string
+	Info  []string
+}
+
+// Client speaks the fastboot protocol over a Transport
+type Client struct {
+	transport Transport
+	// maxDownload caches max-download-size; 0 means not queried yet, -1 unknown
+	maxDownload int64
+	// OnInfo, when set, receives INFO and TEXT messages as they arrive
+	OnInfo func(message string)
+}
+
+// NewClient creates a client over an open transport
+func NewClient(transport Transport) *Client {
+	return &Client{transport: transport}
+}
+
+// Open connects to the device with the given serial: "tcp:host[:port]" dials a network
+// device, any other serial opens that USB device (the only one when empty)
+func Open(serial string) (*Client, error) {
+	if address, ok := strings.CutPrefix(serial, TCPPrefix); ok {
+		transport, err := DialTCP(address, tcpDialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrTransport, err)
+		}
+		return NewClient(transport), nil
+	}
+
+	transport, err := OpenUSB(serial)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(transport), nil
+}
+
+// Close closes the underlying transport
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
+
+// Command sends cmd and reads responses until OKAY or FAIL
+func (c *Client) Command(cmd string) (*Response, error) {
+	if err := c.send(cmd); err != nil {
+		return nil, err
+	}
+
+	resp := &Response{}
+	for {
+		status, message, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+
+		switch status {
+		case "OKAY":
+			resp.Value = message
+			return resp, nil
+		case "FAIL":
+			return resp, &FailError{Command: cmd, Message: message}
+		case "INFO", "TEXT":
+			resp.Info = append(resp.Info, message)
+			if c.OnInfo != nil {
+				c.OnInfo(message)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s%s to %q", ErrProtocol, status, message, cmd)
+		}
+	}
+}
+
+// GetVar reads a bootloader variable
+func (c *Client) GetVar(name string) (string, error) {
+	resp, err := c.Command("getvar:" + name)
+	if err != nil {
+		return "", err
+	}
+	return resp.Value, nil
+}
+
+// GetVarAll returns every variable reported by "getvar:all"
+func (c *Client) GetVarAll() (map[string]string, error) {
+	resp, err := c.Command("getvar:all")
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]string{}
+	collectVars(vars, resp.Info)
+	return vars, nil
+}
+
+// Oem runs "oem <cmd>" and returns the INFO lines it produced
+func (c *Client) Oem(cmd string) ([]string, error) {
+	resp, err := c.Command("oem " + cmd)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Info, nil
+}
+
+// MaxDownloadSize returns the device's max-download-size, or -1 when it does not report one
+func (c *Client) MaxDownloadSize() (int64, error) {
+	if c.maxDownload != 0 {
+		return c.maxDownload, nil
+	}
+
+	value, err := c.GetVar("max-download-size")
+	var fail *FailError
+	if errors.As(err, &fail) {
+		c.maxDownload = -1
+		return c.maxDownload, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(value), 0, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("%w: max-download-size %q", ErrProtocol, value)
+	}
+	c.maxDownload = size
+	return size, nil
+}
+
+// Download sends data to the device's staging buffer (the equivalent of "fastboot stage")
+func (c *Client) Download(data []byte) error {
+	limit, err := c.MaxDownloadSize()
+	if err != nil {
+		return err
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return fmt.Errorf("%w: %d > %d bytes", ErrTooLarge, len(data), limit)
+	}
+
+	cmd := fmt.Sprintf("download:%08x", len(data))
+	if err := c.send(cmd); err != nil {
+		return err
+	}
+
+	// Wait for DATA<size>, passing INFO through
+	for {
+		status, message, err := c.readResponse()
+		if err != nil {
+			return err
+		}
+		if status == "INFO" || status == "TEXT" {
+			if c.OnInfo != nil {
+				c.OnInfo(message)
+			}
+			continue
+		}
+		if status == "FAIL" {
+			return &FailError{Command: cmd, Message: message}
+		}
+		if status != "DATA" {
+			return fmt.Errorf("%w: %s%s to %q", ErrProtocol, status, message, cmd)
+		}
+
+		accepted, err := strconv.ParseInt(message, 16, 64)
+		if err != nil || accepted != int64(len(data)) {
+			return fmt.Errorf("%w: device accepted %q of %d bytes", ErrProtocol, message, len(data))
+		}
+		break
+	}
+
+	for offset := 0; offset < len(data); offset += downloadChunkSize {
+		end := min(offset+downloadChunkSize, len(data))
+		if _, err := c.transport.Write(data[offset:end]); err != nil {
+			return fmt.Errorf("%w: data transfer failed: %w", ErrTransport, err)
+		}
+	}
+
+	// The transfer ends with OKAY (or FAIL), possibly preceded by INFO
+	for {
+		status, message, err := c.readResponse()
+		if err != nil {
+			return err
+		}
+		switch status {
+		case "OKAY":
+			return nil
+		case "FAIL":
+			return &FailError{Command: cmd, Message: message}
+		case "INFO", "TEXT":
+			if c.OnInfo != nil {
+				c.OnInfo(message)
+			}
+		default:
+			return fmt.Errorf("%w: %s%s after download", ErrProtocol, status, message)
+		}
+	}
+}
+
+// send writes one command packet
+func (c *Client) send(cmd string) error {
+	if len(cmd) > maxCommandSize {
+		return fmt.Errorf("%w: %q", ErrCommandTooLong, cmd)
+	}
+	if _, err := c.transport.Write([]byte(cmd)); err != nil {
+		return fmt.Errorf("%w: write failed: %w", ErrTransport, err)
+	}
+	return nil
+}
+
+// readResponse reads one response packet and splits it into status and message
+func (c *Client) readResponse() (string, string, error) {
+	buf := make([]byte, maxResponseSize)
+	n, err := c.transport.Read(buf)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: read failed: %w", ErrTransport, err)
+	}
+	if n < 4 {
+		return "", "", fmt.Errorf("%w: short packet %q", ErrProtocol, buf[:n])
+	}
+	return string(buf[:4]), string(buf[4:n]), nil
+}
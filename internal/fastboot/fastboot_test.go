@@ -0,0 +1,234 @@
+package fastboot
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		replies  []string
+		want     *Response
+		wantErr  error
+		wantInfo []string
+	}{
+		{
+			name:    "okay",
+			replies: []string{"OKAYlisa"},
+			want:    &Response{Value: "lisa"},
+		},
+		{
+			name:     "info then okay",
+			replies:  []string{"INFOline 1", "TEXTline 2", "OKAY"},
+			want:     &Response{Info: []string{"line 1", "line 2"}},
+			wantInfo: []string{"line 1", "line 2"},
+		},
+		{
+			name:    "unknown variable",
+			replies: []string{"FAILVariable not found"},
+			wantErr: ErrVariableNotFound,
+		},
+		{
+			name:    "other failure",
+			replies: []string{"FAILDevice is locked"},
+			wantErr: ErrCommandFailed,
+		},
+		{
+			name:    "unexpected status",
+			replies: []string{"DATA00000010"},
+			wantErr: ErrProtocol,
+		},
+		{
+			name:    "short packet",
+			replies: []string{"OK"},
+			wantErr: ErrProtocol,
+		},
+		{
+			name:    "no reply",
+			wantErr: ErrTransport,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewFakeTransport().Expect("getvar:product", tt.replies...)
+			client := NewClient(transport)
+			var info []string
+			client.OnInfo = func(message string) { info = append(info, message) }
+
+			got, err := client.Command("getvar:product")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Command() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Command() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Command() = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(info, tt.wantInfo) {
+				t.Errorf("OnInfo got %q, want %q", info, tt.wantInfo)
+			}
+		})
+	}
+}
+
+func TestCommandTooLong(t *testing.T) {
+	transport := NewFakeTransport()
+	_, err := NewClient(transport).Command("oem " + string(bytes.Repeat([]byte("x"), maxCommandSize)))
+	if !errors.Is(err, ErrCommandTooLong) {
+		t.Errorf("Command() error = %v, want %v", err, ErrCommandTooLong)
+	}
+	if len(transport.Written) != 0 {
+		t.Errorf("Command() wrote %q", transport.Written)
+	}
+}
+
+func TestOem(t *testing.T) {
+	transport := NewFakeTransport().Expect("oem get_token", "INFOtoken:VQEAAA", "INFOtoken:BBBB", "OKAY")
+	lines, err := NewClient(transport).Oem("get_token")
+	if err != nil {
+		t.Fatalf("Oem() error = %v", err)
+	}
+	if want := []string{"token:VQEAAA", "token:BBBB"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("Oem() = %q, want %q", lines, want)
+	}
+}
+
+func TestMaxDownloadSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    int64
+		wantErr error
+	}{
+		{name: "hex", reply: "OKAY0x20000000", want: 0x20000000},
+		{name: "decimal", reply: "OKAY536870912", want: 536870912},
+		{name: "not reported", reply: "FAILVariable not found", want: -1},
+		{name: "garbage", reply: "OKAYlots", wantErr: ErrProtocol},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewFakeTransport().Expect("getvar:max-download-size", tt.reply)
+			client := NewClient(transport)
+
+			got, err := client.MaxDownloadSize()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("MaxDownloadSize() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("MaxDownloadSize() = %d, %v, want %d", got, err, tt.want)
+			}
+
+			// The value is cached; a second query would be an unexpected write
+			if again, err := client.MaxDownloadSize(); err != nil || again != tt.want {
+				t.Errorf("second MaxDownloadSize() = %d, %v", again, err)
+			}
+		})
+	}
+}
+
+func TestDownload(t *testing.T) {
+	data := bytes.Repeat([]byte{0xa5}, 2*downloadChunkSize+10)
+	transport := NewFakeTransport().
+		Expect("getvar:max-download-size", "OKAY0x1000000").
+		Expect("download:0008000a", "INFOpreparing", "DATA0008000a").
+		ExpectData(len(data), "OKAY")
+	client := NewClient(transport)
+
+	if err := client.Download(data); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if transport.Remaining() != 0 {
+		t.Errorf("%d scripted steps were not reached", transport.Remaining())
+	}
+
+	var sizes []int
+	for _, packet := range transport.Written[2:] {
+		sizes = append(sizes, len(packet))
+	}
+	if want := []int{downloadChunkSize, downloadChunkSize, 10}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("data written in chunks of %v, want %v", sizes, want)
+	}
+	if !bytes.Equal(bytes.Join(transport.Written[2:], nil), data) {
+		t.Error("data written does not match the download")
+	}
+}
+
+func TestDownloadErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport *FakeTransport
+		wantErr   error
+	}{
+		{
+			name:      "too large",
+			transport: NewFakeTransport().Expect("getvar:max-download-size", "OKAY0x8"),
+			wantErr:   ErrTooLarge,
+		},
+		{
+			name: "size mismatch",
+			transport: NewFakeTransport().
+				Expect("getvar:max-download-size", "FAILunknown variable").
+				Expect("download:00000010", "DATA00000008"),
+			wantErr: ErrProtocol,
+		},
+		{
+			name: "refused",
+			transport: NewFakeTransport().
+				Expect("getvar:max-download-size", "OKAY0x100").
+				Expect("download:00000010", "FAILdownload refused"),
+			wantErr: ErrCommandFailed,
+		},
+		{
+			name: "failed after data",
+			transport: NewFakeTransport().
+				Expect("getvar:max-download-size", "OKAY0x100").
+				Expect("download:00000010", "DATA00000010").
+				ExpectData(16, "FAILflash write failure"),
+			wantErr: ErrCommandFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewClient(tt.transport).Download(make([]byte, 16))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Download() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFailErrorUnwrap(t *testing.T) {
+	tests := []struct {
+		command string
+		message string
+		want    error
+	}{
+		{command: "getvar:token", message: "GetVar Variable Not found", want: ErrVariableNotFound},
+		{command: "getvar:anti", message: "unknown variable", want: ErrVariableNotFound},
+		{command: "getvar:partition-type:cust", message: "partition not found", want: ErrCommandFailed},
+		{command: "oem get_token", message: "unknown command", want: ErrCommandFailed},
+		{command: "oem unlock", message: "oem unlock is not allowed", want: ErrCommandFailed},
+		{command: "oem get_token", message: "variable not found", want: ErrCommandFailed},
+		{command: "flash:boot", message: "Flashing is not allowed in Lock State", want: ErrCommandFailed},
+	}
+
+	for _, tt := range tests {
+		err := &FailError{Command: tt.command, Message: tt.message}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("FailError{%q, %q} = %v, want %v", tt.command, tt.message, errors.Unwrap(err), tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package fastboot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Output parsing errors
+var (
+	// ErrVariableNotFound means the bootloader does not know the variable or command
+	ErrVariableNotFound = errors.New("fastboot variable not found")
+	// ErrCommandFailed means the bootloader answered FAILED for another reason
+	ErrCommandFailed = errors.New("fastboot command failed")
+	// ErrTransport means the fastboot tool could not talk to a device at all
+	ErrTransport = errors.New("fastboot transport error")
+)
+
+// remoteFailure extracts the bootloader message from `FAILED (remote: 'message')`
+var remoteFailure = regexp.MustCompile(`FAILED \(remote: ['"]?(.*?)['"]?\)\s*$`)
+
+// notFoundMessages are bootloader replies to getvar that mean the variable does not exist,
+// e.g. "GetVar Variable Not found"; other refusals such as "partition not found" or
+// "oem unlock is not allowed" are command failures
+var notFoundMessages = []string{
+	"variable not found",
+	"unknown variable",
+}
+
+// isVariableNotFound reports whether a FAILED reply to command means the variable does not exist
+func isVariableNotFound(command, message string) bool {
+	if !strings.HasPrefix(command, "getvar") {
+		return false
+	}
+	lower := strings.ToLower(message)
+	for _, notFound := range notFoundMessages {
+		if strings.Contains(lower, notFound) {
+			return true
+		}
+	}
+	return false
+}
+
+// transportMessages appear in fastboot tool output when no device could be reached
+var transportMessages = []string{
+	"< waiting for",
+	"no devices",
+	"no such device",
+	"device not found",
+	"write to device failed",
+	"read from device failed",
+	"status read failed",
+	"command write failed",
+}
+
+// ParseOutput extracts variable name from the combined output of `fastboot getvar name`.
+//
+// Lines may carry a "(bootloader) " prefix and values may contain colons. Values that
+// arrive in several chunks, like Qualcomm and MediaTek tokens, are concatenated in order.
+// A FAILED reply is reported as ErrVariableNotFound or ErrCommandFailed, and output
+// showing that no device was reached as ErrTransport.
+func ParseOutput(output, name string) (string, error) {
+	return parseOutput(output, "getvar", name)
+}
+
+// ParseOemOutput extracts the value an oem command such as `fastboot oem get_token` reports
+// under name. It reads the output like ParseOutput, but every FAILED reply is ErrCommandFailed.
+func ParseOemOutput(output, name string) (string, error) {
+	return parseOutput(output, "oem", name)
+}
+
+// parseOutput extracts variable name from the output of a getvar or oem command
+func parseOutput(output, command, name string) (string, error) {
+	var parts []string
+	prefix := name + ":"
+
+	for _, rawLine := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(rawLine)
+		line = strings.TrimSpace(strings.TrimPrefix(line, "(bootloader)"))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, prefix) {
+			if value := strings.TrimSpace(line[len(prefix):]); value != "" {
+				parts = append(parts, value)
+			}
+			continue
+		}
+
+		if strings.Contains(line, "FAILED") {
+			return "", classifyFailure(command, name, line)
+		}
+
+		lower := strings.ToLower(line)
+		for _, message := range transportMessages {
+			if strings.Contains(lower, message) {
+				return "", fmt.Errorf("%w: %s", ErrTransport, line)
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrVariableNotFound, name)
+	}
+	return strings.Join(parts, ""), nil
+}
+
+// classifyFailure turns a FAILED line of command into the matching error
+func classifyFailure(command, name, line string) error {
+	match := remoteFailure.FindStringSubmatch(line)
+	if match == nil {
+		// The tool itself failed without a reply from the bootloader
+		return fmt.Errorf("%w: %s", ErrTransport, line)
+	}
+
+	message := match[1]
+	if isVariableNotFound(command, message) {
+		return fmt.Errorf("%w: %s (%s)", ErrVariableNotFound, name, message)
+	}
+	return fmt.Errorf("%w: %s", ErrCommandFailed, message)
+}
+
+// qualifiedVars are variables reported once per partition; their name carries the partition
+// after a second colon, e.g. "partition-size:boot_a: 0x6000000"
+var qualifiedVars = map[string]bool{
+	"partition-size": true,
+	"partition-type": true,
+	"has-slot":       true,
+	"is-logical":     true,
+}
+
+// ParseVars parses the output of `fastboot getvar all` into a variable map.
+// Lines look like "(bootloader) product:lisa" or "(bootloader) partition-size:boot: 0x4000000";
+// partition variables keep their suffix in the name, and values may contain colons.
+func ParseVars(output string) map[string]string {
+	var lines []string
+	for _, rawLine := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(rawLine)
+		if strings.HasPrefix(line, "(bootloader)") {
+			lines = append(lines, strings.TrimPrefix(line, "(bootloader)"))
+		}
+	}
+
+	vars := map[string]string{}
+	collectVars(vars, lines)
+	return vars
+}
+
+// collectVars adds each "name:value" line to vars. A name seen again continues its value,
+// since bootloaders split long values such as the token over several lines.
+func collectVars(vars map[string]string, lines []string) {
+	for _, line := range lines {
+		name, value, ok := splitVarLine(line)
+		if !ok {
+			continue
+		}
+		vars[name] += value
+	}
+}
+
+// splitVarLine splits "name: value" or "name:value" at the first colon, or at the second one
+// for per-partition variables
+func splitVarLine(line string) (string, string, bool) {
+	name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok {
+		return "", "", false
+	}
+	if qualifiedVars[name] {
+		partition, rest, ok := strings.Cut(value, ":")
+		if !ok {
+			return "", "", false
+		}
+		name, value = name+":"+partition, rest
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || strings.Contains(name, " ") {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(value), true
+}
+
+// ParseDevices returns the serials listed by `fastboot devices`, one "serial<TAB>fastboot" line each
+func ParseDevices(output string) []string {
+	var serials []string
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[1] != "fastboot" && fields[1] != "fastbootd") {
+			continue
+		}
+		serials = append(serials, fields[0])
+	}
+	return serials
+}
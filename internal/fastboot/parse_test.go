@@ -0,0 +1,239 @@
+package fastboot
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		variable string
+		// oem parses the output of an oem command instead of getvar
+		oem     bool
+		want    string
+		wantErr error
+	}{
+		{
+			name:     "getvar",
+			output:   "product: lisa\nFinished. Total time: 0.001s\n",
+			variable: "product",
+			want:     "lisa",
+		},
+		{
+			name:     "crlf",
+			output:   "unlocked: no\r\nFinished. Total time: 0.001s\r\n",
+			variable: "unlocked",
+			want:     "no",
+		},
+		{
+			name:     "value with colons",
+			output:   "version-baseband: MPSS.HI.3.1.c3:00125\nFinished. Total time: 0.002s\n",
+			variable: "version-baseband",
+			want:     "MPSS.HI.3.1.c3:00125",
+		},
+		{
+			name: "mediatek token in chunks",
+			output: "(bootloader) token:VQECKgEQ4Ft8D4bprvS2q9tBmIjYJBsa\n" +
+				"(bootloader) token:AAAAcK4IAAAAAAAAAAAAAAAAAAAAAAAA\n" +
+				"(bootloader) token:ZmFrZQ==\n" +
+				"OKAY [  0.010s]\n" +
+				"Finished. Total time: 0.010s\n",
+			variable: "token",
+			want:     "VQECKgEQ4Ft8D4bprvS2q9tBmIjYJBsaAAAAcK4IAAAAAAAAAAAAAAAAAAAAAAAAZmFrZQ==",
+		},
+		{
+			name:     "unknown variable",
+			output:   "getvar:token FAILED (remote: 'GetVar Variable Not found')\nFinished. Total time: 0.001s\n",
+			variable: "token",
+			wantErr:  ErrVariableNotFound,
+		},
+		{
+			name:     "unknown variable on fastbootd",
+			output:   "getvar:token FAILED (remote: 'Variable not found')\nfastboot: error: Command failed\n",
+			variable: "token",
+			wantErr:  ErrVariableNotFound,
+		},
+		{
+			name:     "unknown partition",
+			output:   "getvar:partition-size:vendor_boot FAILED (remote: 'partition not found')\nFinished. Total time: 0.001s\n",
+			variable: "partition-size:vendor_boot",
+			wantErr:  ErrCommandFailed,
+		},
+		{
+			name:     "getvar refused while locked",
+			output:   "getvar:token FAILED (remote: 'Command not allowed')\nfastboot: error: Command failed\n",
+			variable: "token",
+			wantErr:  ErrCommandFailed,
+		},
+		{
+			name:     "oem token",
+			output:   "(bootloader) token:VQECKgEQ4Ft8D4bprvS2q9tBmIjYJBsa\nOKAY [  0.010s]\nFinished. Total time: 0.010s\n",
+			variable: "token",
+			oem:      true,
+			want:     "VQECKgEQ4Ft8D4bprvS2q9tBmIjYJBsa",
+		},
+		{
+			name:     "unknown oem command",
+			output:   "FAILED (remote: 'unknown command')\nfastboot: error: Command failed\n",
+			variable: "token",
+			oem:      true,
+			wantErr:  ErrCommandFailed,
+		},
+		{
+			name:     "oem unlock not allowed",
+			output:   "FAILED (remote: 'oem unlock is not allowed')\nfastboot: error: Command failed\n",
+			variable: "unlock",
+			oem:      true,
+			wantErr:  ErrCommandFailed,
+		},
+		{
+			name:     "oem refused while locked",
+			output:   "FAILED (remote: 'Flashing is not allowed in Lock State')\nfastboot: error: Command failed\n",
+			variable: "token",
+			oem:      true,
+			wantErr:  ErrCommandFailed,
+		},
+		{
+			name:     "oem reply mentioning a missing variable",
+			output:   "FAILED (remote: 'variable not found')\nfastboot: error: Command failed\n",
+			variable: "token",
+			oem:      true,
+			wantErr:  ErrCommandFailed,
+		},
+		{
+			name:     "oem command not supported",
+			output:   "FAILED (remote: 'Command not supported in default implementation')\nfastboot: error: Command failed\n",
+			variable: "token",
+			oem:      true,
+			wantErr:  ErrCommandFailed,
+		},
+		{
+			name:     "remote failure",
+			output:   "FAILED (remote: \"Device is locked\")\nfastboot: error: Command failed\n",
+			variable: "token",
+			wantErr:  ErrCommandFailed,
+		},
+		{
+			name:     "device gone",
+			output:   "FAILED (Write to device failed (No such device))\nfastboot: error: Command failed\n",
+			variable: "product",
+			wantErr:  ErrTransport,
+		},
+		{
+			name:     "waiting",
+			output:   "< waiting for any device >\n",
+			variable: "product",
+			wantErr:  ErrTransport,
+		},
+		{
+			name:     "empty value",
+			output:   "token: \nFinished. Total time: 0.001s\n",
+			variable: "token",
+			wantErr:  ErrVariableNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parse := ParseOutput
+			if tt.oem {
+				parse = ParseOemOutput
+			}
+			got, err := parse(tt.output, tt.variable)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseOutput() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseOutput() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// getvarAll is abridged `fastboot getvar all` output from a Qualcomm Xiaomi bootloader
+const getvarAll = `(bootloader) parallel-download-flash:yes
+(bootloader) hw-revision:20001
+(bootloader) unlocked:no
+(bootloader) off-mode-charge:0
+(bootloader) battery-voltage:4168
+(bootloader) version-baseband:MPSS.HI.3.1.c3:00125
+(bootloader) version-bootloader:
+(bootloader) erase-block-size: 0x1000
+(bootloader) variant:SM_ UFS
+(bootloader) partition-type:boot_a:raw
+(bootloader) partition-size:boot_a: 0x6000000
+(bootloader) has-slot:boot:yes
+(bootloader) current-slot:a
+(bootloader) max-download-size: 805306368
+(bootloader) serialno:1a2b3c4d
+(bootloader) token:VQECKgEQ4Ft8D4bprvS2q9tBmIjYJBsa
+(bootloader) token:ZmFrZQ==
+(bootloader) product:lisa
+all:
+Finished. Total time: 0.061s
+`
+
+func TestParseVars(t *testing.T) {
+	want := map[string]string{
+		"parallel-download-flash": "yes",
+		"hw-revision":             "20001",
+		"unlocked":                "no",
+		"off-mode-charge":         "0",
+		"battery-voltage":         "4168",
+		"version-baseband":        "MPSS.HI.3.1.c3:00125",
+		"version-bootloader":      "",
+		"erase-block-size":        "0x1000",
+		"variant":                 "SM_ UFS",
+		"partition-type:boot_a":   "raw",
+		"partition-size:boot_a":   "0x6000000",
+		"has-slot:boot":           "yes",
+		"current-slot":            "a",
+		"max-download-size":       "805306368",
+		"serialno":                "1a2b3c4d",
+		"token":                   "VQECKgEQ4Ft8D4bprvS2q9tBmIjYJBsaZmFrZQ==",
+		"product":                 "lisa",
+	}
+
+	if got := ParseVars(getvarAll); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseVars() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestGetVarAll(t *testing.T) {
+	transport := NewFakeTransport().Expect("getvar:all",
+		"INFOpartition-size:userdata: 0x1b4bffb000",
+		"INFOtoken:VQECKgEQ",
+		"INFOtoken:ZmFrZQ==",
+		"INFOversion-baseband:MPSS:1",
+		"OKAY",
+	)
+
+	got, err := NewClient(transport).GetVarAll()
+	if err != nil {
+		t.Fatalf("GetVarAll() error = %v", err)
+	}
+	want := map[string]string{
+		"partition-size:userdata": "0x1b4bffb000",
+		"token":                   "VQECKgEQZmFrZQ==",
+		"version-baseband":        "MPSS:1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetVarAll() = %v, want %v", got, want)
+	}
+}
+
+func TestParseDevices(t *testing.T) {
+	output := "1a2b3c4d\tfastboot\nemulator-5554\tdevice\n5e6f7a8b\t fastbootd\n\n"
+	if got, want := ParseDevices(output), []string{"1a2b3c4d", "5e6f7a8b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDevices() = %q, want %q", got, want)
+	}
+}
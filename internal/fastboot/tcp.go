@@ -0,0 +1,101 @@
+package fastboot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultTCPPort is the port fastbootd and network-capable bootloaders listen on
+const DefaultTCPPort = 5554
+
+// TCPPrefix marks a network device serial, as the fastboot tool accepts them ("tcp:host[:port]")
+const TCPPrefix = "tcp:"
+
+// tcpDialTimeout bounds connecting to a network device opened by serial
+const tcpDialTimeout = 5 * time.Second
+
+// tcpHandshake is exchanged in both directions before any packet ("FB" + protocol version)
+const tcpHandshake = "FB01"
+
+// TCPTransport carries fastboot packets over TCP, each prefixed with an 8-byte big-endian length
+type TCPTransport struct {
+	conn    net.Conn
+	pending []byte
+}
+
+// DialTCP connects to host (with optional ":port") and performs the protocol handshake
+func DialTCP(address string, timeout time.Duration) (*TCPTransport, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, fmt.Sprint(DefaultTCPPort))
+	}
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := NewTCPTransport(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return transport, nil
+}
+
+// NewTCPTransport performs the handshake on an existing connection
+func NewTCPTransport(conn net.Conn) (*TCPTransport, error) {
+	if _, err := conn.Write([]byte(tcpHandshake)); err != nil {
+		return nil, fmt.Errorf("fastboot tcp handshake failed: %w", err)
+	}
+
+	reply := make([]byte, len(tcpHandshake))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("fastboot tcp handshake failed: %w", err)
+	}
+	if string(reply[:2]) != "FB" {
+		return nil, fmt.Errorf("%w: tcp handshake %q", ErrProtocol, reply)
+	}
+
+	return &TCPTransport{conn: conn}, nil
+}
+
+// Write sends p as one length-prefixed packet
+func (t *TCPTransport) Write(p []byte) (int, error) {
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(len(p)))
+	if _, err := t.conn.Write(header[:]); err != nil {
+		return 0, err
+	}
+	return t.conn.Write(p)
+}
+
+// Read returns the next packet; a packet larger than p is returned over several reads
+func (t *TCPTransport) Read(p []byte) (int, error) {
+	if len(t.pending) == 0 {
+		var header [8]byte
+		if _, err := io.ReadFull(t.conn, header[:]); err != nil {
+			return 0, err
+		}
+
+		size := binary.BigEndian.Uint64(header[:])
+		if size > 64*1024*1024 {
+			return 0, fmt.Errorf("%w: tcp packet of %d bytes", ErrProtocol, size)
+		}
+		t.pending = make([]byte, size)
+		if _, err := io.ReadFull(t.conn, t.pending); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// Close closes the connection
+func (t *TCPTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,115 @@
+package fastboot
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveTCP accepts one connection on a local listener and answers each command packet with
+// the reply from replies, using the fastboot TCP framing
+func serveTCP(t *testing.T, handshake string, replies map[string][]string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		hello := make([]byte, len(tcpHandshake))
+		if _, err := io.ReadFull(conn, hello); err != nil || string(hello) != tcpHandshake {
+			t.Errorf("handshake = %q, %v", hello, err)
+			return
+		}
+		conn.Write([]byte(handshake))
+
+		for {
+			var header [8]byte
+			if _, err := io.ReadFull(conn, header[:]); err != nil {
+				return
+			}
+			packet := make([]byte, binary.BigEndian.Uint64(header[:]))
+			if _, err := io.ReadFull(conn, packet); err != nil {
+				return
+			}
+			for _, reply := range replies[string(packet)] {
+				binary.BigEndian.PutUint64(header[:], uint64(len(reply)))
+				conn.Write(append(header[:], reply...))
+			}
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestOpenTCP(t *testing.T) {
+	address := serveTCP(t, "FB01", map[string][]string{
+		"getvar:product":  {"OKAYlisa"},
+		"oem device-info": {"INFO" + strings.Repeat("x", 200), "INFOVerity mode: true", "OKAY"},
+	})
+
+	client, err := Open(TCPPrefix + address)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer client.Close()
+
+	if product, err := client.GetVar("product"); err != nil || product != "lisa" {
+		t.Errorf("GetVar(product) = %q, %v", product, err)
+	}
+	lines, err := client.Oem("device-info")
+	if err != nil || len(lines) != 2 || len(lines[0]) != 200 || lines[1] != "Verity mode: true" {
+		t.Errorf("Oem(device-info) = %q, %v", lines, err)
+	}
+}
+
+func TestOpenTCPBadHandshake(t *testing.T) {
+	address := serveTCP(t, "HTTP", nil)
+
+	if _, err := Open(TCPPrefix + address); !errors.Is(err, ErrProtocol) || !errors.Is(err, ErrTransport) {
+		t.Errorf("Open() error = %v, want %v and %v", err, ErrProtocol, ErrTransport)
+	}
+}
+
+func TestTCPTransportSplitsLargePackets(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		io.ReadFull(server, make([]byte, len(tcpHandshake)))
+		server.Write([]byte(tcpHandshake))
+		var header [8]byte
+		binary.BigEndian.PutUint64(header[:], 6)
+		server.Write(append(header[:], "OKAYab"...))
+	}()
+
+	transport, err := NewTCPTransport(client)
+	if err != nil {
+		t.Fatalf("NewTCPTransport() error = %v", err)
+	}
+
+	// A packet larger than the read buffer is returned over several reads
+	var got []string
+	buf := make([]byte, 4)
+	for range 2 {
+		n, err := transport.Read(buf)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+	if strings.Join(got, "|") != "OKAY|ab" {
+		t.Errorf("Read() = %q, want OKAY then ab", got)
+	}
+}
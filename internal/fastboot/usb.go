@@ -0,0 +1,173 @@
+package fastboot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultSysfsRoot is where Linux exposes USB devices
+const DefaultSysfsRoot = "/sys/bus/usb/devices"
+
+// DefaultDevRoot is where Linux keeps the usbfs device nodes
+const DefaultDevRoot = "/dev/bus/usb"
+
+// Fastboot USB interface class/subclass/protocol
+const (
+	fastbootClass    = 0xff
+	fastbootSubclass = 0x42
+	fastbootProtocol = 0x03
+)
+
+// USB errors
+var (
+	ErrNoDevice       = errors.New("no fastboot USB device found")
+	ErrUSBUnsupported = errors.New("native USB transport is only supported on Linux")
+)
+
+// USBDevice describes a fastboot interface found in sysfs
+type USBDevice struct {
+	// SysPath is the sysfs directory of the USB device (e.g. /sys/bus/usb/devices/1-2)
+	SysPath string
+	// Interface is the sysfs name of the fastboot interface (e.g. 1-2:1.0)
+	Interface   string
+	InterfaceNo int
+	BusNum      int
+	DevNum      int
+	VendorID    uint16
+	ProductID   uint16
+	Serial      string
+	Product     string
+	// EndpointIn and EndpointOut are the bulk endpoint addresses
+	EndpointIn  uint8
+	EndpointOut uint8
+}
+
+// DevNode returns the usbfs device node path
+func (d *USBDevice) DevNode() string {
+	return d.DevNodeIn(DefaultDevRoot)
+}
+
+// DevNodeIn returns the device node path below devRoot (normally DefaultDevRoot)
+func (d *USBDevice) DevNodeIn(devRoot string) string {
+	return filepath.Join(devRoot, padNumber(d.BusNum), padNumber(d.DevNum))
+}
+
+// ListUSB walks sysRoot (normally DefaultSysfsRoot) for interfaces with the fastboot
+// class ff/42/03. Taking the root as a parameter lets tests use a fake tree.
+func ListUSB(sysRoot string) ([]USBDevice, error) {
+	entries, err := os.ReadDir(sysRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []USBDevice
+	for _, entry := range entries {
+		name := entry.Name()
+		// Interfaces are named <device>:<config>.<interface>
+		colon := strings.IndexByte(name, ':')
+		if colon < 0 {
+			continue
+		}
+
+		ifacePath := filepath.Join(sysRoot, name)
+		if readHex(ifacePath, "bInterfaceClass") != fastbootClass ||
+			readHex(ifacePath, "bInterfaceSubClass") != fastbootSubclass ||
+			readHex(ifacePath, "bInterfaceProtocol") != fastbootProtocol {
+			continue
+		}
+
+		devPath := filepath.Join(sysRoot, name[:colon])
+		device := USBDevice{
+			SysPath:     devPath,
+			Interface:   name,
+			InterfaceNo: int(readHex(ifacePath, "bInterfaceNumber")),
+			BusNum:      readDecimal(devPath, "busnum"),
+			DevNum:      readDecimal(devPath, "devnum"),
+			VendorID:    uint16(readHex(devPath, "idVendor")),
+			ProductID:   uint16(readHex(devPath, "idProduct")),
+			Serial:      readString(devPath, "serial"),
+			Product:     readString(devPath, "product"),
+		}
+		device.EndpointIn, device.EndpointOut = bulkEndpoints(ifacePath)
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// FindUSB returns the fastboot device with the given serial, or the only one when serial is empty
+func FindUSB(sysRoot, serial string) (*USBDevice, error) {
+	devices, err := ListUSB(sysRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range devices {
+		if serial == "" || devices[i].Serial == serial {
+			return &devices[i], nil
+		}
+	}
+	return nil, ErrNoDevice
+}
+
+// bulkEndpoints reads the ep_XX directories of an interface
+func bulkEndpoints(ifacePath string) (in, out uint8) {
+	entries, err := os.ReadDir(ifacePath)
+	if err != nil {
+		return 0, 0
+	}
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "ep_") {
+			continue
+		}
+		epPath := filepath.Join(ifacePath, entry.Name())
+		if readString(epPath, "type") != "Bulk" {
+			continue
+		}
+
+		address := uint8(readHex(epPath, "bEndpointAddress"))
+		if address&0x80 != 0 {
+			in = address
+		} else {
+			out = address
+		}
+	}
+	return in, out
+}
+
+// readString returns a trimmed sysfs attribute, or "" if missing
+func readString(dir, name string) string {
+	raw, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// readHex parses a hexadecimal sysfs attribute, or returns -1 if missing
+func readHex(dir, name string) int64 {
+	value, err := strconv.ParseInt(readString(dir, name), 16, 64)
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+// readDecimal parses a decimal sysfs attribute, or returns 0 if missing
+func readDecimal(dir, name string) int {
+	value, _ := strconv.Atoi(readString(dir, name))
+	return value
+}
+
+// padNumber formats a bus or device number as usbfs does (three digits)
+func padNumber(n int) string {
+	s := strconv.Itoa(n)
+	for len(s) < 3 {
+		s = "0" + s
+	}
+	return s
+}
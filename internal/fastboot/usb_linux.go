@@ -0,0 +1,134 @@
+//go:build linux
+
+package fastboot
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// usbfs ioctl numbers from linux/usbdevice_fs.h
+const (
+	iocWrite = 1
+	iocRead  = 2
+
+	// maxBulkSize keeps each transfer under the default usbfs buffer limit
+	maxBulkSize = 16 * 1024
+	// usbTimeoutMillis bounds a single bulk transfer
+	usbTimeoutMillis = 5000
+)
+
+// usbBulkTransfer mirrors struct usbdevfs_bulktransfer
+type usbBulkTransfer struct {
+	Endpoint uint32
+	Length   uint32
+	Timeout  uint32
+	Data     unsafe.Pointer
+}
+
+var (
+	usbdevfsBulk             = ioc(iocRead|iocWrite, 2, unsafe.Sizeof(usbBulkTransfer{}))
+	usbdevfsClaimInterface   = ioc(iocRead, 15, unsafe.Sizeof(uint32(0)))
+	usbdevfsReleaseInterface = ioc(iocRead, 16, unsafe.Sizeof(uint32(0)))
+)
+
+// ioc builds an ioctl request number for the usbfs ('U') type
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | uintptr('U')<<8 | nr
+}
+
+// USBTransport carries fastboot packets over usbfs bulk endpoints
+type USBTransport struct {
+	file   *os.File
+	device USBDevice
+}
+
+// OpenUSB opens the fastboot device with the given serial (or the only one when empty)
+func OpenUSB(serial string) (*USBTransport, error) {
+	device, err := FindUSB(DefaultSysfsRoot, serial)
+	if err != nil {
+		return nil, err
+	}
+	return OpenUSBDevice(device)
+}
+
+// OpenUSBDevice opens a device found by ListUSB and claims its fastboot interface
+func OpenUSBDevice(device *USBDevice) (*USBTransport, error) {
+	if device.EndpointIn == 0 || device.EndpointOut == 0 {
+		return nil, fmt.Errorf("%w: %s has no bulk endpoints", ErrProtocol, device.Interface)
+	}
+
+	file, err := os.OpenFile(device.DevNode(), os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s (check udev permissions): %w", device.DevNode(), err)
+	}
+
+	iface := uint32(device.InterfaceNo)
+	if err := ioctl(file, usbdevfsClaimInterface, unsafe.Pointer(&iface)); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to claim USB interface %d: %w", iface, err)
+	}
+
+	return &USBTransport{file: file, device: *device}, nil
+}
+
+// Device returns the USB device this transport is connected to
+func (t *USBTransport) Device() USBDevice {
+	return t.device
+}
+
+// Read performs one bulk IN transfer
+func (t *USBTransport) Read(p []byte) (int, error) {
+	return t.bulk(t.device.EndpointIn, p)
+}
+
+// Write performs bulk OUT transfers, split to fit the usbfs buffer limit
+func (t *USBTransport) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := min(written+maxBulkSize, len(p))
+		n, err := t.bulk(t.device.EndpointOut, p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Close releases the interface and closes the device node
+func (t *USBTransport) Close() error {
+	iface := uint32(t.device.InterfaceNo)
+	ioctl(t.file, usbdevfsReleaseInterface, unsafe.Pointer(&iface))
+	return t.file.Close()
+}
+
+// bulk runs a single USBDEVFS_BULK transfer on endpoint
+func (t *USBTransport) bulk(endpoint uint8, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	transfer := usbBulkTransfer{
+		Endpoint: uint32(endpoint),
+		Length:   uint32(len(p)),
+		Timeout:  usbTimeoutMillis,
+		Data:     unsafe.Pointer(&p[0]),
+	}
+	n, _, errno := syscall.Syscall(syscall.SYS_IOCTL, t.file.Fd(), usbdevfsBulk, uintptr(unsafe.Pointer(&transfer)))
+	if errno != 0 {
+		return 0, fmt.Errorf("USB bulk transfer on endpoint %#x failed: %w", endpoint, errno)
+	}
+	return int(n), nil
+}
+
+// ioctl issues a usbfs ioctl with a pointer argument
+func ioctl(file *os.File, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
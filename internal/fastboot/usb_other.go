@@ -0,0 +1,25 @@
+//go:build !linux
+
+package fastboot
+
+// USBTransport is unavailable outside Linux; use the fastboot binary or TCP instead
+type USBTransport struct{}
+
+// OpenUSB always fails on this platform
+func OpenUSB(serial string) (*USBTransport, error) {
+	return nil, ErrUSBUnsupported
+}
+
+// OpenUSBDevice always fails on this platform
+func OpenUSBDevice(device *USBDevice) (*USBTransport, error) {
+	return nil, ErrUSBUnsupported
+}
+
+// Device returns an empty device
+func (t *USBTransport) Device() USBDevice {
+	return USBDevice{}
+}
+
+func (t *USBTransport) Read(p []byte) (int, error)  { return 0, ErrUSBUnsupported }
+func (t *USBTransport) Write(p []byte) (int, error) { return 0, ErrUSBUnsupported }
+func (t *USBTransport) Close() error                { return nil }
@@ -0,0 +1,95 @@
+package fastboot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSysfs creates attribute files below root; keys are paths relative to root
+func writeSysfs(t *testing.T, root string, attributes map[string]string) {
+	t.Helper()
+	for name, value := range attributes {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListUSB(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, map[string]string{
+		// Root hub: no interface suffix
+		"usb1/busnum": "1",
+		// A phone in fastboot mode
+		"1-2/busnum":                     "1",
+		"1-2/devnum":                     "14",
+		"1-2/idVendor":                   "18d1",
+		"1-2/idProduct":                  "d00d",
+		"1-2/serial":                     "1a2b3c4d",
+		"1-2/product":                    "Android",
+		"1-2:1.0/bInterfaceClass":        "ff",
+		"1-2:1.0/bInterfaceSubClass":     "42",
+		"1-2:1.0/bInterfaceProtocol":     "03",
+		"1-2:1.0/bInterfaceNumber":       "00",
+		"1-2:1.0/ep_81/type":             "Bulk",
+		"1-2:1.0/ep_81/bEndpointAddress": "81",
+		"1-2:1.0/ep_01/type":             "Bulk",
+		"1-2:1.0/ep_01/bEndpointAddress": "01",
+		"1-2:1.0/ep_83/type":             "Interrupt",
+		"1-2:1.0/ep_83/bEndpointAddress": "83",
+		// A phone booted normally exposes adb (ff/42/01), not fastboot
+		"2-1/busnum":                 "2",
+		"2-1/devnum":                 "3",
+		"2-1/serial":                 "5e6f7a8b",
+		"2-1:1.1/bInterfaceClass":    "ff",
+		"2-1:1.1/bInterfaceSubClass": "42",
+		"2-1:1.1/bInterfaceProtocol": "01",
+		// A mass storage stick
+		"2-2/busnum":              "2",
+		"2-2:1.0/bInterfaceClass": "08",
+	})
+
+	devices, err := ListUSB(root)
+	if err != nil {
+		t.Fatalf("ListUSB() error = %v", err)
+	}
+	want := []USBDevice{{
+		SysPath:     filepath.Join(root, "1-2"),
+		Interface:   "1-2:1.0",
+		InterfaceNo: 0,
+		BusNum:      1,
+		DevNum:      14,
+		VendorID:    0x18d1,
+		ProductID:   0xd00d,
+		Serial:      "1a2b3c4d",
+		Product:     "Android",
+		EndpointIn:  0x81,
+		EndpointOut: 0x01,
+	}}
+	if !reflect.DeepEqual(devices, want) {
+		t.Fatalf("ListUSB() =\n%+v\nwant\n%+v", devices, want)
+	}
+	if got := devices[0].DevNodeIn("/dev/bus/usb"); got != "/dev/bus/usb/001/014" {
+		t.Errorf("DevNodeIn() = %s", got)
+	}
+
+	if device, err := FindUSB(root, ""); err != nil || device.Serial != "1a2b3c4d" {
+		t.Errorf("FindUSB(any) = %+v, %v", device, err)
+	}
+	if _, err := FindUSB(root, "5e6f7a8b"); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("FindUSB(adb device) error = %v, want %v", err, ErrNoDevice)
+	}
+}
+
+func TestListUSBMissingRoot(t *testing.T) {
+	if _, err := ListUSB(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ListUSB() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,228 @@
+// Package httpclient builds the HTTP client shared by every network call, with proxy, CA
+// bundle and timeout settings and a cookie jar that survives restarts.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Configuration errors; match them with errors.Is
+var (
+	ErrInvalidProxy   = errors.New("invalid proxy URL")
+	ErrCABundle       = errors.New("cannot load CA bundle")
+	ErrInvalidTimeout = errors.New("invalid timeout")
+)
+
+// Default timeouts used when Options leaves them zero
+const (
+	DefaultConnectTimeout = 30 * time.Second
+	DefaultReadTimeout    = 60 * time.Second
+)
+
+// Environment variables read by OptionsFromEnv. The standard HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY variables are always honored.
+const (
+	EnvProxy          = "MUI_PROXY"
+	EnvCABundle       = "MUI_CA_BUNDLE"
+	EnvConnectTimeout = "MUI_CONNECT_TIMEOUT"
+	EnvReadTimeout    = "MUI_READ_TIMEOUT"
+)
+
+// Options configures the shared client
+type Options struct {
+	// Proxy is used for every request not excluded by NO_PROXY; empty means HTTPS_PROXY
+	// and HTTP_PROXY. A URL without a scheme is taken as http://.
+	Proxy string
+	// CABundle is a PEM file of certificates trusted in addition to the system roots,
+	// such as an intercepting proxy's
+	CABundle string
+	// ConnectTimeout bounds the TCP connection and TLS handshake
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds the wait for the response headers and for each read of the body,
+	// so a slow but steady download is not cut off
+	ReadTimeout time.Duration
+	// CookieFile, when set, keeps the cookies across runs
+	CookieFile string
+	// PrivateCookies names cookies that are never written to CookieFile, such as login tokens
+	PrivateCookies []string
+}
+
+// OptionsFromEnv reads MUI_PROXY, MUI_CA_BUNDLE, MUI_CONNECT_TIMEOUT and MUI_READ_TIMEOUT
+func OptionsFromEnv() (Options, error) {
+	opts := Options{
+		Proxy:    os.Getenv(EnvProxy),
+		CABundle: os.Getenv(EnvCABundle),
+	}
+
+	var err error
+	if opts.ConnectTimeout, err = durationEnv(EnvConnectTimeout); err != nil {
+		return opts, err
+	}
+	if opts.ReadTimeout, err = durationEnv(EnvReadTimeout); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// durationEnv parses a duration such as "45s" from an environment variable; unset is zero
+func durationEnv(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%w: %s=%q, use a duration such as 30s", ErrInvalidTimeout, name, value)
+	}
+	return d, nil
+}
+
+// New builds a client from opts
+func New(opts Options) (*http.Client, error) {
+	if opts.ConnectTimeout < 0 || opts.ReadTimeout < 0 {
+		return nil, fmt.Errorf("%w: timeouts cannot be negative", ErrInvalidTimeout)
+	}
+
+	connectTimeout := opts.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+	readTimeout := opts.ReadTimeout
+	if readTimeout == 0 {
+		readTimeout = DefaultReadTimeout
+	}
+
+	proxy, err := proxyFunc(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = readTimeout
+
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &readTimeoutConn{Conn: conn, timeout: readTimeout}, nil
+	}
+
+	if opts.CABundle != "" {
+		roots, err := loadCABundle(opts.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+
+	var jar http.CookieJar
+	if opts.CookieFile != "" {
+		jar, err = OpenJar(opts.CookieFile, opts.PrivateCookies...)
+	} else {
+		jar, err = cookiejar.New(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: transport, Jar: jar}, nil
+}
+
+// proxyFunc returns the proxy selector: the explicit proxy, or the environment's, for every
+// host not listed in NO_PROXY
+func proxyFunc(explicit string) (func(*http.Request) (*url.URL, error), error) {
+	config := httpproxy.FromEnvironment()
+	if explicit != "" {
+		if !strings.Contains(explicit, "://") {
+			explicit = "http://" + explicit
+		}
+		parsed, err := url.Parse(explicit)
+		if err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidProxy, explicit)
+		}
+		config.HTTPProxy = explicit
+		config.HTTPSProxy = explicit
+	}
+
+	proxy := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}, nil
+}
+
+// loadCABundle returns the system roots plus the certificates in a PEM file
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCABundle, err)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w: no PEM certificates in %s", ErrCABundle, path)
+	}
+	return roots, nil
+}
+
+// readTimeoutConn fails a read that waits longer than timeout for data
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *readTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// shared is the client returned by Default
+var shared atomic.Pointer[http.Client]
+
+// Configure replaces the shared client with one built from opts
+func Configure(opts Options) error {
+	client, err := New(opts)
+	if err != nil {
+		return err
+	}
+	shared.Store(client)
+	return nil
+}
+
+// Default returns the shared client, built from the environment's proxy settings and the
+// default timeouts until Configure is called
+func Default() *http.Client {
+	if client := shared.Load(); client != nil {
+		return client
+	}
+
+	client, err := New(Options{})
+	if err != nil {
+		// Without options nothing can fail; keep a working client regardless
+		client = &http.Client{Timeout: DefaultReadTimeout}
+	}
+	shared.CompareAndSwap(nil, client)
+	return shared.Load()
+}
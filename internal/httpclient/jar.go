@@ -0,0 +1,193 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Jar is a cookie jar written to a file after every change, readable by the owner only.
+// Session cookies are kept too, except the private ones, which only live in memory.
+type Jar struct {
+	path    string
+	private map[string]bool
+
+	mu      sync.Mutex
+	inner   *cookiejar.Jar
+	cookies map[string]savedCookie
+}
+
+// savedCookie is a cookie and the URL that set it, as stored in the file
+type savedCookie struct {
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Expires  time.Time `json:"expires,omitzero"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+}
+
+// OpenJar loads the cookies saved at path; a missing file yields an empty jar. Cookies named
+// in private are never saved, and are dropped from a file written by an older version.
+func OpenJar(path string, private ...string) (*Jar, error) {
+	inner, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	j := &Jar{path: path, private: make(map[string]bool), inner: inner, cookies: make(map[string]savedCookie)}
+	for _, name := range private {
+		j.private[name] = true
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookies: %w", err)
+	}
+
+	var saved []savedCookie
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		return nil, fmt.Errorf("failed to read cookies from %s: %w", path, err)
+	}
+
+	now := time.Now()
+	dropped := false
+	for _, c := range saved {
+		if j.private[c.Name] {
+			dropped = true
+			continue
+		}
+		u, err := url.Parse(c.URL)
+		if err != nil || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			continue
+		}
+		inner.SetCookies(u, []*http.Cookie{c.cookie()})
+		j.cookies[c.key(u)] = c
+	}
+	if dropped {
+		if err := j.save(); err != nil {
+			return nil, fmt.Errorf("failed to remove private cookies from %s: %w", path, err)
+		}
+	}
+	return j, nil
+}
+
+// SetCookies stores the cookies of a response and saves the jar
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.inner.SetCookies(u, cookies)
+
+	origin := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+	now := time.Now()
+	for _, cookie := range cookies {
+		c := savedCookie{
+			URL:      origin.String(),
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		}
+		// Max-Age is relative to now, store it as an absolute expiry
+		if cookie.MaxAge > 0 {
+			c.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+
+		key := c.key(u)
+		if j.private[c.Name] {
+			continue
+		}
+		if cookie.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(j.cookies, key)
+			continue
+		}
+		j.cookies[key] = c
+	}
+
+	// The jar interface cannot report errors; a failed save only loses persistence
+	j.save()
+}
+
+// Cookies returns the cookies to send with a request to u
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	inner := j.inner
+	j.mu.Unlock()
+	return inner.Cookies(u)
+}
+
+// Clear forgets every cookie and removes the file
+func (j *Jar) Clear() error {
+	inner, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.inner = inner
+	j.cookies = make(map[string]savedCookie)
+
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove cookies: %w", err)
+	}
+	return nil
+}
+
+// save writes the jar to its file
+func (j *Jar) save() error {
+	saved := make([]savedCookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		saved = append(saved, c)
+	}
+	raw, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// key identifies a cookie the way a jar does: by domain, path and name
+func (c savedCookie) key(u *url.URL) string {
+	domain := c.Domain
+	if domain == "" {
+		domain = u.Hostname()
+	}
+	return domain + ";" + c.Path + ";" + c.Name
+}
+
+// cookie converts the stored form back to an http.Cookie
+func (c savedCookie) cookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+}
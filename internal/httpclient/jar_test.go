@@ -0,0 +1,106 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func cookieNames(cookies []*http.Cookie) string {
+	var names []string
+	for _, c := range cookies {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestJarKeepsPrivateCookiesInMemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	account, _ := url.Parse("https://account.xiaomi.com/pass/serviceLoginAuth2")
+
+	jar, err := OpenJar(path, "passToken", "serviceToken")
+	if err != nil {
+		t.Fatalf("OpenJar() error = %v", err)
+	}
+	jar.SetCookies(account, []*http.Cookie{
+		{Name: "uLocale", Value: "en_US", Path: "/"},
+		{Name: "passToken", Value: "secret-pass-token", Path: "/"},
+	})
+
+	if got := cookieNames(jar.Cookies(account)); got != "uLocale,passToken" {
+		t.Errorf("Cookies() = %s, want both cookies while running", got)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "secret-pass-token") || !strings.Contains(string(raw), "en_US") {
+		t.Errorf("cookie file =\n%s", raw)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("cookie file mode = %v, %v", info.Mode(), err)
+	}
+
+	reopened, err := OpenJar(path, "passToken", "serviceToken")
+	if err != nil {
+		t.Fatalf("OpenJar() error = %v", err)
+	}
+	if got := cookieNames(reopened.Cookies(account)); got != "uLocale" {
+		t.Errorf("reopened Cookies() = %s, want only uLocale", got)
+	}
+}
+
+func TestOpenJarScrubsOldFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	old := `[
+  {"url": "https://account.xiaomi.com/", "name": "passToken", "value": "secret-pass-token", "path": "/"},
+  {"url": "https://account.xiaomi.com/", "name": "uLocale", "value": "en_US", "path": "/"}
+]`
+	if err := os.WriteFile(path, []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	jar, err := OpenJar(path, "passToken")
+	if err != nil {
+		t.Fatalf("OpenJar() error = %v", err)
+	}
+	account, _ := url.Parse("https://account.xiaomi.com/")
+	if got := cookieNames(jar.Cookies(account)); got != "uLocale" {
+		t.Errorf("Cookies() = %s, want only uLocale", got)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "secret-pass-token") {
+		t.Errorf("private cookie left in the file:\n%s", raw)
+	}
+}
+
+func TestJarClear(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	site, _ := url.Parse("https://unlock.update.miui.com/")
+
+	jar, err := OpenJar(path, "serviceToken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar.SetCookies(site, []*http.Cookie{{Name: "serviceToken", Value: "token"}, {Name: "region", Value: "eu"}})
+
+	if err := jar.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if cookies := jar.Cookies(site); len(cookies) != 0 {
+		t.Errorf("Cookies() after Clear() = %s", cookieNames(cookies))
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("cookie file still exists: %v", err)
+	}
+	if err := jar.Clear(); err != nil {
+		t.Errorf("second Clear() error = %v", err)
+	}
+}
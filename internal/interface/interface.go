@@ -1,122 +1,542 @@
 package interfaces
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"muitoolunlock/internal/auth"
-	"muitoolunlock/internal/colors"
 	"muitoolunlock/internal/device"
+	"muitoolunlock/internal/httpclient"
+	"muitoolunlock/internal/paths"
+	"muitoolunlock/internal/platform"
+	"muitoolunlock/internal/report"
+	"muitoolunlock/internal/session"
 	"muitoolunlock/internal/storage"
+	"muitoolunlock/internal/types"
 	"muitoolunlock/internal/unlock"
 )
 
-// RunInteractiveUnlock runs the interactive unlock process
-func RunInteractiveUnlock(fastbootPath string) {
-	fmt.Println(colors.Header("🔐 Interactive Xiaomi Device Unlock"))
+// ErrWebAuthFailed is returned when no device ID could be read from the web login redirect
+var ErrWebAuthFailed = errors.New("web authentication failed")
+
+// RunInteractiveUnlock runs the interactive unlock process against the device with the given serial.
+// The result holds the device and unlock outcome reached before any error.
+func RunInteractiveUnlock(ui report.UI, fastbootPath, serial string) (*Result, error) {
+	ui.Section("🔐 Interactive Xiaomi Device Unlock")
+	result := NewResult()
 
 	// Load existing data
-	data := storage.LoadUnlockData()
+	data, err := storage.LoadUnlockData()
+	if err != nil {
+		return result, err
+	}
 
 	// Get account info
 	if data.User == "" {
-		fmt.Print(colors.Email("Xiaomi Account (ID/Email/Phone): "))
-		reader := bufio.NewReader(os.Stdin)
-		account, _ := reader.ReadString('\n')
-		data.User = strings.TrimSpace(account)
-		storage.SaveUnlockData(data)
-		fmt.Println(colors.Save("Account saved"))
-	}
-
-	if data.Password == "" {
-		fmt.Print(colors.Lock("Enter password: "))
-		reader := bufio.NewReader(os.Stdin)
-		password, _ := reader.ReadString('\n')
-		data.Password = strings.TrimSpace(password)
-		storage.SaveUnlockData(data)
-		fmt.Println(colors.Save("Password saved"))
+		data.User = ui.Input("📧 Xiaomi Account (ID/Email/Phone): ")
+		if err := storage.SaveUnlockData(data); err != nil {
+			return result, err
+		}
+		ui.Success("Account saved")
 	}
 
 	// Get web browser ID if not exists (similar to Python wb_id flow)
 	if data.WbID == "" {
-		fmt.Println(colors.Section("🌐 Web Authentication Required"))
-		fmt.Println(colors.Notice("If logged in with any account in your browser,"))
-		fmt.Println(colors.Notice("please log out before continuing."))
-		fmt.Println(colors.Rocket("Opening Xiaomi authentication page automatically..."))
+		ui.Section("🌐 Web Authentication Required")
+		ui.Info("If logged in with any account in your browser,")
+		ui.Info("please log out before continuing.")
+		ui.Progress("Opening the Xiaomi login in your browser...")
 
 		// Get device ID from web authentication (auto-open browser)
-		deviceID := auth.GetWebBrowserID()
+		deviceID := auth.GetWebBrowserID(ui)
 		if deviceID == "" {
-			fmt.Println(colors.Error("Web authentication failed"))
-			return
+			return result, ErrWebAuthFailed
 		}
 		data.WbID = deviceID
-		storage.SaveUnlockData(data)
+		if err := storage.SaveUnlockData(data); err != nil {
+			return result, err
+		}
 	}
 
-	// Authenticate with Xiaomi
-	fmt.Println(colors.Progress("Authenticating with Xiaomi servers..."))
-	authData, err := auth.AuthenticateXiaomi(data.User, data.Password, data.WbID)
+	// Reuse the saved session or authenticate with Xiaomi
+	sess := session.New(data, interactiveLogin(ui, ""))
+	authData, reused, err := sess.AuthData()
 	if err != nil {
-		fmt.Println(colors.Error(fmt.Sprintf("Authentication failed: %v", err)))
-		return
+		return result, fmt.Errorf("%w: %w", unlock.ErrAuthFailed, err)
 	}
 
-	fmt.Printf("%s %s\n", colors.Success("Authentication successful! Account ID:"), colors.BoldText(authData.UserID))
-
-	// Save login success
-	if data.Login != "ok" {
-		data.Login = "ok"
-		data.UID = authData.UserID
-		storage.SaveUnlockData(data)
-		fmt.Println(colors.Save("Login saved."))
+	if reused {
+		ui.Success("Reusing saved session for Account ID: " + authData.UserID)
+	} else {
+		ui.Success("Authentication successful! Account ID: " + authData.UserID)
+		if forgetPassword {
+			ui.Info("💾 Login saved (passToken only, password not stored).")
+		} else {
+			ui.Info("💾 Login saved.")
+		}
 	}
 
 	// Get device info
-	fmt.Println(colors.Section("📱 Device Information"))
-	fmt.Println(colors.Warning("Ensure you're in Bootloader mode (fastboot mode)"))
+	ui.Section("📱 Device Information")
+	ui.Warning("Ensure you're in Bootloader mode (fastboot mode)")
+
+	serial, err = chooseDevice(ui, fastbootPath, serial)
+	if err != nil {
+		return result, offerUdevRules(ui, err)
+	}
 
-	deviceInfo := device.GetDeviceInfo(fastbootPath)
-	if deviceInfo == nil {
-		fmt.Println(colors.Error("Failed to get device info. Please ensure device is in fastboot mode."))
-		return
+	deviceInfo, err := device.GetDeviceInfo(ui, fastbootPath, serial)
+	if err != nil {
+		return result, offerUdevRules(ui, err)
 	}
 
-	device.DisplayDeviceInfo(deviceInfo)
+	result.Device = deviceInfo
+	device.DisplayDeviceInfo(ui, deviceInfo)
 
 	// Confirm unlock
-	fmt.Print(colors.Warning("Are you sure you want to unlock this device? (y/N): "))
-	reader := bufio.NewReader(os.Stdin)
-	confirm, _ := reader.ReadString('\n')
-	confirm = strings.TrimSpace(strings.ToLower(confirm))
-
-	if confirm != "y" && confirm != "yes" {
-		fmt.Println(colors.Error("Unlock cancelled"))
-		return
+	if !ui.Confirm("Are you sure you want to unlock this device?", false) {
+		return result, unlock.ErrCancelled
 	}
 
 	// Perform real unlock with API
-	unlock.PerformUnlock(deviceInfo, authData, fastbootPath)
+	resp, err := unlock.PerformUnlock(ui, deviceInfo, sess, data.WbID, fastbootPath, serial)
+	result.Unlock = newUnlockResult(resp, err)
+	return result, err
+}
+
+// Store options set up by SetupEncryptedStore and SetupSecretStore
+var (
+	forgetPassword  bool
+	storePassphrase []byte
+)
+
+// SetupEncryptedStore switches storage to the encrypted data file, migrating any plaintext file.
+// The passphrase is read from MUI_STORE_PASSPHRASE or prompted for.
+func SetupEncryptedStore(ui report.UI, forget bool) error {
+	baseDir := storage.DataDir()
+
+	passphrase := []byte(os.Getenv("MUI_STORE_PASSPHRASE"))
+	if len(passphrase) == 0 {
+		secret, err := ui.Secret("Store passphrase: ")
+		if err != nil {
+			return fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		passphrase = []byte(secret)
+	}
+
+	store := &storage.EncryptedFile{
+		Path:           filepath.Join(baseDir, storage.EncryptedFileName),
+		Passphrase:     passphrase,
+		ForgetPassword: forget,
+	}
+	if _, err := store.Load(); err != nil {
+		return err
+	}
+
+	migrated, err := storage.MigratePlaintext(filepath.Join(baseDir, storage.PlainFileName), store)
+	if err != nil {
+		return err
+	}
+	if migrated {
+		ui.Success("Migrated " + storage.PlainFileName + " to encrypted " + storage.EncryptedFileName)
+	}
+
+	// Re-save so an existing file drops its password when --forget-password is first used
+	if forget {
+		if data, err := store.Load(); err == nil && data.Password != "" {
+			if err := store.Save(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	storage.SetBackend(store)
+	forgetPassword = forget
+	storePassphrase = passphrase
+	return nil
+}
+
+// SetupSecretStore keeps the passToken in the named secret backend (auto, keyring or file)
+// instead of the account data file
+func SetupSecretStore(r report.Reporter, name string) error {
+	secrets, chosen, err := storage.OpenSecretStore(name, filepath.Join(storage.DataDir(), storage.SecretsFileName), storePassphrase)
+	if errors.Is(err, storage.ErrPlaintextSecrets) {
+		r.Info("Use --encrypt to keep the tokens in an encrypted file instead,")
+		r.Info("or --secret-backend file to accept a plaintext file.")
+	}
+	if err != nil {
+		return err
+	}
+
+	storage.SetBackend(&storage.SecretBackend{Data: storage.CurrentBackend(), Secrets: secrets})
+	forgetPassword = true
+
+	if chosen == storage.SecretBackendKeyring {
+		r.Info("🔑 Tokens are stored in the system keyring")
+	} else if len(storePassphrase) == 0 {
+		r.Warning("🔑 Tokens are stored unencrypted in " + storage.SecretsFileName)
+	} else {
+		r.Info("🔑 Tokens are stored encrypted in " + storage.SecretsFileName)
+	}
+	return nil
+}
+
+// interactiveLogin returns a login that tries the saved passToken, falling back to password,
+// then to a password saved by older versions, and asks for one when there is neither. The
+// password is only kept in memory.
+func interactiveLogin(ui report.UI, password string) session.LoginFunc {
+	return func(data *types.UnlockData) (*types.XiaomiAuthResponse, error) {
+		ui.Progress("Authenticating with Xiaomi servers...")
+
+		if data.PassToken != "" {
+			authData, err := auth.AuthenticateWithPassToken(ui, data.UID, data.PassToken, data.WbID)
+			if err == nil {
+				return authData, nil
+			}
+			ui.Warning(fmt.Sprintf("Saved passToken rejected: %v", err))
+			data.PassToken = ""
+		}
+
+		if password == "" {
+			password = data.Password
+		}
+		if password == "" {
+			secret, err := ui.Secret("🔒 Enter password: ")
+			if err != nil {
+				return nil, fmt.Errorf("failed to read password: %w", err)
+			}
+			password = strings.TrimSpace(secret)
+		}
+		return auth.AuthenticateXiaomi(ui, data.User, password, data.WbID)
+	}
+}
+
+// ShowSession prints the saved account and session state (--whoami)
+func ShowSession(r report.Reporter) error {
+	r.Section("👤 Saved Xiaomi Session")
+
+	data, err := storage.LoadUnlockData()
+	if err != nil {
+		return err
+	}
+	if data.User == "" {
+		r.Warning("No saved account")
+		return nil
+	}
+
+	r.Field("Account", data.User)
+	if data.UID != "" {
+		r.Field("Account ID", data.UID)
+	}
+	if data.PassToken != "" {
+		r.Success("passToken saved")
+	} else {
+		r.Warning("No passToken saved, password login required")
+	}
+
+	sess := session.New(data, nil)
+	if sess.Valid() {
+		r.Success("Service token valid until: " + sess.ExpiresAt().Format("2006-01-02 15:04"))
+	} else if !sess.ExpiresAt().IsZero() {
+		r.Warning("Service token expired at: " + sess.ExpiresAt().Format("2006-01-02 15:04"))
+	} else {
+		r.Warning("No active service token")
+	}
+	return nil
+}
+
+// Logout clears the saved session and tokens (--logout)
+func Logout(r report.Reporter) error {
+	data, err := storage.LoadUnlockData()
+	if err != nil {
+		return err
+	}
+	if err := session.New(data, nil).Logout(); err != nil {
+		return err
+	}
+	if err := clearCookies(); err != nil {
+		return err
+	}
+	r.Success("Logged out, saved tokens cleared")
+	return nil
+}
+
+// clearCookies forgets the shared client's cookies and removes the profile's cookie file
+func clearCookies() error {
+	if jar, ok := httpclient.Default().Jar.(*httpclient.Jar); ok {
+		if err := jar.Clear(); err != nil {
+			return err
+		}
+	}
+
+	err := os.Remove(filepath.Join(storage.DataDir(), storage.CookiesFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove cookies: %w", err)
+	}
+	return nil
+}
+
+// MigrateLegacyFiles moves the account data and platform-tools that older versions kept in the
+// working directory, and the profiles they kept in the config folder, to the per-user
+// directories. It only runs once; failed moves are retried on the next start.
+func MigrateLegacyFiles(r report.Reporter) error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	moves, err := storage.MigrationMoves(workDir)
+	if err != nil {
+		return err
+	}
+	toolMoves, err := platform.MigrationMoves(workDir)
+	if err != nil {
+		return err
+	}
+
+	moved, err := paths.Migrate(append(moves, toolMoves...))
+	for _, move := range moved {
+		r.Info(fmt.Sprintf("📦 Moved %s to %s", move.From, move.To))
+	}
+	return err
+}
+
+// ConfigureHTTP sets up the shared HTTP client, keeping its cookies in the data folder of the
+// selected profile. The login cookies stay in memory; the stores keep the tokens instead.
+func ConfigureHTTP(opts httpclient.Options) error {
+	opts.CookieFile = filepath.Join(storage.DataDir(), storage.CookiesFileName)
+	opts.PrivateCookies = auth.SessionCookies
+	return httpclient.Configure(opts)
+}
+
+// SelectProfile switches storage to the named profile, or the default profile when name is empty
+func SelectProfile(r report.Reporter, name string) error {
+	selected, err := storage.UseProfile(name)
+	if err != nil {
+		return err
+	}
+	if selected != "" {
+		r.Field("Profile", selected)
+	}
+	return nil
+}
+
+// ListProfiles prints the saved account profiles (--profiles)
+func ListProfiles(r report.Reporter) error {
+	r.Section("👥 Account Profiles")
+
+	profiles, defaultProfile, err := storage.ListProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to read profiles: %w", err)
+	}
+	if len(profiles) == 0 {
+		r.Warning("No profiles yet, add one with --profile-add <name>")
+		return nil
+	}
+
+	for _, name := range profiles {
+		user := "(no account yet)"
+		if account, err := storage.ProfileAccount(name); err == nil && account != "" {
+			user = account
+		}
+
+		if name == defaultProfile {
+			user += " [default]"
+		}
+		r.Field(name, user)
+	}
+	return nil
+}
+
+// ManageProfile runs the --profile-add/--profile-remove/--profile-default commands
+func ManageProfile(r report.Reporter, add, remove, setDefault string) error {
+	if add != "" {
+		if err := storage.AddProfile(add); err != nil {
+			return err
+		}
+		r.Success("Profile added: " + add)
+	}
+	if remove != "" {
+		if err := storage.RemoveProfile(remove); err != nil {
+			return err
+		}
+		r.Success("Profile removed: " + remove)
+	}
+	if setDefault != "" {
+		if err := storage.SetDefaultProfile(setDefault); err != nil {
+			return err
+		}
+		r.Success("Default profile: " + setDefault)
+	}
+	return nil
+}
+
+// ManagePlatformTools runs the --platform-tools install, verify, repair or uninstall action,
+// installing from src. With a pinned release, verify also checks the installed fastboot is it.
+func ManagePlatformTools(r report.Reporter, action string, src platform.Source) error {
+	r.Section("🔧 Platform Tools")
+
+	dir, err := platform.DefaultDir()
+	if err != nil {
+		return err
+	}
+	manager := platform.NewManager(dir)
+	if err := manager.Configure(src); err != nil {
+		return err
+	}
+	manager.Progress = platform.ReportProgress(r)
+
+	switch action {
+	case "install":
+		r.Progress("Installing platform-tools...")
+		r.Field("Source", manager.Source())
+		err = manager.Install()
+	case "verify":
+		err = manager.Verify()
+	case "repair":
+		r.Progress("Repairing platform-tools...")
+		err = manager.Repair()
+	case "uninstall":
+		err = manager.Uninstall()
+	default:
+		return fmt.Errorf("unknown platform-tools action %q, use install, verify, repair or uninstall", action)
+	}
+	if err == nil && action != "uninstall" {
+		_, err = manager.CheckFastboot()
+	}
+	if err != nil {
+		return err
+	}
+
+	if action == "uninstall" {
+		r.Success("Platform-tools removed from " + manager.ToolsDir())
+	} else {
+		r.Success("Platform-tools ready: " + manager.FastbootPath())
+	}
+	return nil
 }
 
-// ProcessDirectUnlock processes direct unlock with account/password parameters
-func ProcessDirectUnlock(account, password, fastbootPath string) {
-	fmt.Printf("%s %s\n", colors.Progress("Processing unlock for account:"), colors.BoldText(account))
-	fmt.Println(colors.Error("Direct unlock requires web authentication. Please use interactive mode."))
-	fmt.Println(colors.Info("💡 Run: mui-tool-unlock-terminal (without flags)"))
+// DirectUnlockOptions configures an unattended unlock (--unlock)
+type DirectUnlockOptions struct {
+	// Account and WbID override the saved profile; Password is used when no passToken works
+	Account  string
+	Password string
+	WbID     string
+	Serial   string
+	// Yes confirms the unlock without asking
+	Yes bool
+}
+
+// ProcessDirectUnlock runs the whole unlock without prompting. Anything that would need a
+// person (no --yes, no web login device ID, no usable password) fails with report.ErrNeedsInput.
+func ProcessDirectUnlock(r report.Reporter, opts DirectUnlockOptions, fastbootPath string) (*Result, error) {
+	r.Section("🔐 Unattended Xiaomi Device Unlock")
+	result := NewResult()
+	ui := &report.Unattended{Reporter: r, AssumeYes: opts.Yes}
+
+	if !opts.Yes {
+		return result, fmt.Errorf("%w: pass --yes to confirm the unlock", report.ErrNeedsInput)
+	}
+
+	data, err := storage.LoadUnlockData()
+	if err != nil {
+		return result, err
+	}
+	if opts.Account != "" && opts.Account != data.User {
+		// A different account invalidates everything saved for the previous one
+		*data = types.UnlockData{User: opts.Account}
+	}
+	if data.User == "" {
+		return result, fmt.Errorf("%w: pass --account or use a profile with a saved account", report.ErrNeedsInput)
+	}
+	if opts.WbID != "" {
+		data.WbID = opts.WbID
+	}
+	if data.WbID == "" {
+		return result, fmt.Errorf("%w: pass --wb-id or log in interactively once to save it", report.ErrNeedsInput)
+	}
+	if err := storage.SaveUnlockData(data); err != nil {
+		return result, err
+	}
+
+	r.Progress("Processing unlock for account: " + data.User)
+	sess := session.New(data, interactiveLogin(ui, opts.Password))
+	authData, reused, err := sess.AuthData()
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", unlock.ErrAuthFailed, err)
+	}
+	if reused {
+		r.Success("Reusing saved session for Account ID: " + authData.UserID)
+	} else {
+		r.Success("Authentication successful! Account ID: " + authData.UserID)
+	}
+
+	// Do not wait for a device to show up
+	serial, devices, err := device.SelectDevice(fastbootPath, opts.Serial)
+	if err != nil {
+		return result, err
+	}
+	// Installing udev rules needs a person at the machine; only explain a permission problem
+	if len(devices) == 0 {
+		return result, explainUSBPermission(r, device.DiagnoseUSB(opts.Serial, device.ErrNoDevice))
+	}
+
+	deviceInfo, err := device.GetDeviceInfo(r, fastbootPath, serial)
+	if err != nil {
+		return result, explainUSBPermission(r, err)
+	}
+	result.Device = deviceInfo
+	device.DisplayDeviceInfo(r, deviceInfo)
+
+	resp, err := unlock.PerformUnlock(ui, deviceInfo, sess, data.WbID, fastbootPath, serial)
+	result.Unlock = newUnlockResult(resp, err)
+	return result, err
 }
 
 // RunDeviceMode runs device information mode
-func RunDeviceMode(fastbootPath string) {
-	fmt.Println(colors.Header("📱 Device Information Mode"))
+func RunDeviceMode(ui report.UI, fastbootPath, serial string) (*Result, error) {
+	ui.Section("📱 Device Information Mode")
+	result := NewResult()
+
+	serial, err := chooseDevice(ui, fastbootPath, serial)
+	if err != nil {
+		return result, offerUdevRules(ui, err)
+	}
+
+	deviceInfo, err := device.GetDeviceInfo(ui, fastbootPath, serial)
+	if err != nil {
+		return result, offerUdevRules(ui, err)
+	}
+
+	result.Device = deviceInfo
+	device.DisplayDeviceInfo(ui, deviceInfo)
+	return result, nil
+}
 
-	deviceInfo := device.GetDeviceInfo(fastbootPath)
-	if deviceInfo == nil {
-		fmt.Println(colors.Error("No device found. Please ensure device is connected and in fastboot mode."))
-		return
+// chooseDevice resolves the target serial, asking which device to use when several are attached.
+// When fastboot sees no device it checks for one the user is not allowed to open.
+func chooseDevice(ui report.UI, fastbootPath, serial string) (string, error) {
+	chosen, devices, err := device.SelectDevice(fastbootPath, serial)
+	if err == nil && len(devices) == 0 {
+		return "", device.DiagnoseUSB(serial, nil)
+	}
+	if !errors.Is(err, device.ErrMultipleDevices) {
+		return chosen, err
 	}
 
-	device.DisplayDeviceInfo(deviceInfo)
+	ui.Section("📱 Several devices are in fastboot mode")
+	for i, d := range devices {
+		ui.Field(fmt.Sprintf("%d) %s", i+1, d.Serial), d.Product)
+	}
+
+	answer := ui.Input(fmt.Sprintf("📱 Choose a device [1-%d]: ", len(devices)))
+	index, convErr := strconv.Atoi(answer)
+	if convErr != nil || index < 1 || index > len(devices) {
+		return "", err
+	}
+	return devices[index-1].Serial, nil
 }
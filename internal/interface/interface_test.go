@@ -0,0 +1,68 @@
+package interfaces
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"muitoolunlock/internal/httpclient"
+	"muitoolunlock/internal/report"
+	"muitoolunlock/internal/storage"
+	"muitoolunlock/internal/types"
+	"muitoolunlock/internal/unlock"
+)
+
+// offline sends every request to a proxy that refuses it, so a login fails after using the password
+func offline(t *testing.T) {
+	t.Helper()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "offline", http.StatusBadGateway)
+	}))
+	t.Cleanup(proxy.Close)
+	if err := httpclient.Configure(httpclient.Options{Proxy: proxy.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { httpclient.Configure(httpclient.Options{}) })
+}
+
+func TestInteractiveLoginKeepsPromptedPasswordInMemory(t *testing.T) {
+	offline(t)
+	ui := report.NewRecorder("hunter2")
+	data := &types.UnlockData{User: "user@example.com", WbID: "wb_0123456789abcdef"}
+
+	if _, err := interactiveLogin(ui, "")(data); err == nil {
+		t.Fatal("login through a refusing proxy succeeded")
+	}
+	if secrets := ui.Messages("secret"); len(secrets) != 1 {
+		t.Errorf("secret prompts = %q, want one", secrets)
+	}
+	if data.Password != "" {
+		t.Errorf("prompted password stored in the account data: %+v", data)
+	}
+}
+
+func TestProcessDirectUnlockKeepsPasswordInMemory(t *testing.T) {
+	offline(t)
+	dataPath := filepath.Join(t.TempDir(), storage.PlainFileName)
+	storage.SetBackend(&storage.PlainFile{Path: dataPath})
+	t.Cleanup(func() { storage.SetBackend(nil) })
+
+	r := report.NewRecorder()
+	opts := DirectUnlockOptions{Account: "user@example.com", WbID: "wb_0123456789abcdef", Password: "hunter2", Yes: true}
+	_, err := ProcessDirectUnlock(r, opts, "")
+	if !errors.Is(err, unlock.ErrAuthFailed) || errors.Is(err, report.ErrNeedsInput) {
+		t.Fatalf("ProcessDirectUnlock() error = %v, want a failed login with the given password", err)
+	}
+
+	raw, err := os.ReadFile(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "hunter2") || !strings.Contains(string(raw), "wb_0123456789abcdef") {
+		t.Errorf("saved data =\n%s", raw)
+	}
+}
@@ -0,0 +1,131 @@
+package interfaces
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"muitoolunlock/internal/auth"
+	"muitoolunlock/internal/device"
+	"muitoolunlock/internal/fastboot"
+	"muitoolunlock/internal/httpclient"
+	"muitoolunlock/internal/platform"
+	"muitoolunlock/internal/report"
+	"muitoolunlock/internal/session"
+	"muitoolunlock/internal/types"
+	"muitoolunlock/internal/unlock"
+	"muitoolunlock/internal/unlockapi"
+)
+
+// Exit codes of the terminal binary, one per failure class
+const (
+	ExitOK             = 0
+	ExitFailure        = 1 // any failure not listed below, including a cancelled unlock
+	ExitSetup          = 2 // platform-tools, USB permissions, profile or account store setup failed
+	ExitAuth           = 3 // web or Xiaomi account authentication failed
+	ExitDeviceNotFound = 4 // no device, or no single device, in fastboot mode
+	ExitServerRefused  = 5 // the unlock server refused the request
+	ExitWaitPeriod     = 6 // the unlock server requires waiting before unlocking
+	ExitFastboot       = 7 // reading from or applying the unlock to the device failed
+	ExitNeedsInput     = 8 // an unattended run needed a person to answer a prompt
+)
+
+// ExitCode returns the exit code for an error returned by the run functions
+func ExitCode(err error) int {
+	var apiErr *unlockapi.APIError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, report.ErrNeedsInput):
+		return ExitNeedsInput
+	case errors.Is(err, platform.ErrDownload), errors.Is(err, platform.ErrExtract),
+		errors.Is(err, platform.ErrNotInstalled), errors.Is(err, platform.ErrBroken),
+		errors.Is(err, platform.ErrFastbootVersion), errors.Is(err, platform.ErrFastbootTooOld),
+		errors.Is(err, platform.ErrFastbootPinned), errors.Is(err, platform.ErrInvalidRelease),
+		errors.Is(err, httpclient.ErrInvalidProxy), errors.Is(err, httpclient.ErrCABundle), errors.Is(err, httpclient.ErrInvalidTimeout),
+		errors.Is(err, device.ErrUSBPermission):
+		return ExitSetup
+	case errors.Is(err, unlock.ErrAuthFailed), errors.Is(err, ErrWebAuthFailed), errors.Is(err, session.ErrNoLogin),
+		errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrCaptchaRequired), errors.Is(err, auth.ErrTwoFactorRequired),
+		errors.Is(err, auth.ErrAccountMismatch):
+		return ExitAuth
+	case errors.Is(err, unlockapi.ErrWaitPeriod):
+		return ExitWaitPeriod
+	case errors.As(err, &apiErr):
+		return ExitServerRefused
+	case errors.Is(err, device.ErrNoDevice), errors.Is(err, device.ErrDeviceNotFound), errors.Is(err, device.ErrMultipleDevices):
+		return ExitDeviceNotFound
+	case errors.Is(err, unlock.ErrFlashFailed), errors.Is(err, fastboot.ErrTransport),
+		errors.Is(err, fastboot.ErrCommandFailed), errors.Is(err, fastboot.ErrVariableNotFound):
+		return ExitFastboot
+	default:
+		return ExitFailure
+	}
+}
+
+// Result is the single JSON document printed with --json
+type Result struct {
+	Version  string            `json:"version"`
+	ExitCode int               `json:"exit_code"`
+	Error    string            `json:"error,omitempty"`
+	Device   *types.DeviceInfo `json:"device,omitempty"`
+	Unlock   *UnlockResult     `json:"unlock,omitempty"`
+}
+
+// UnlockResult is the outcome of the unlock request
+type UnlockResult struct {
+	Unlocked bool `json:"unlocked"`
+	// Code is the unlock server response code (0 when accepted)
+	Code        int        `json:"code"`
+	Description string     `json:"description,omitempty"`
+	WaitUntil   *time.Time `json:"wait_until,omitempty"`
+}
+
+// NewResult creates an empty result for this version of the tool
+func NewResult() *Result {
+	return &Result{Version: types.AppVersion}
+}
+
+// Finish records the exit code and error message for err
+func (r *Result) Finish(code int, err error) {
+	r.ExitCode = code
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// WriteJSON writes the result as one indented JSON document
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// newUnlockResult describes what PerformUnlock returned, or nil when the request was never answered
+func newUnlockResult(resp *types.UnlockResponse, err error) *UnlockResult {
+	if err == nil {
+		return &UnlockResult{Unlocked: true}
+	}
+
+	result := &UnlockResult{}
+	var apiErr *unlockapi.APIError
+	if errors.As(err, &apiErr) {
+		result.Code = apiErr.Code
+		result.Description = apiErr.Description
+	} else if resp == nil {
+		return nil
+	}
+
+	if resp != nil {
+		result.Code = resp.Code
+		if resp.DescEN != "" {
+			result.Description = resp.DescEN
+		}
+		if !resp.WaitUntil.IsZero() {
+			waitUntil := resp.WaitUntil
+			result.WaitUntil = &waitUntil
+		}
+	}
+	return result
+}
@@ -0,0 +1,122 @@
+package interfaces
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"muitoolunlock/internal/device"
+	"muitoolunlock/internal/fastboot"
+	"muitoolunlock/internal/paths"
+	"muitoolunlock/internal/report"
+)
+
+// rulesFileName is the udev rules file name, also used for the copy saved for the user
+var rulesFileName = filepath.Base(device.UdevRulesPath)
+
+// explainUSBPermission tells the user why an attached device cannot be used when err is a
+// USB permission error, and returns err
+func explainUSBPermission(r report.Reporter, err error) error {
+	if !errors.Is(err, device.ErrUSBPermission) {
+		return err
+	}
+
+	r.Section("🔌 USB Permission Problem")
+	r.Warning("A device is in fastboot mode, but this user is not allowed to open it.")
+	r.Info("Linux only lets root open USB devices unless a udev rule grants access.")
+	r.Info(fmt.Sprintf("Installing %s for Xiaomi and Google devices fixes this;", rulesFileName))
+	r.Info("unplug and reconnect the phone afterwards.")
+	return err
+}
+
+// offerUdevRules explains a USB permission error and offers to install the udev rules; it
+// returns err
+func offerUdevRules(ui report.UI, err error) error {
+	if !errors.Is(err, device.ErrUSBPermission) {
+		return err
+	}
+
+	explainUSBPermission(ui, err)
+	if ui.Confirm("Install the udev rules now?", false) {
+		if installErr := InstallUdevRules(ui); installErr != nil {
+			ui.Error(installErr.Error())
+		}
+	}
+	return err
+}
+
+// InstallUdevRules installs the udev rules when running as root. Otherwise it saves them in
+// the state directory and shows the commands to install them with sudo.
+func InstallUdevRules(r report.Reporter) error {
+	err := device.InstallUdevRules(device.UdevRulesPath)
+	if err == nil {
+		r.Success("Installed " + device.UdevRulesPath + ", now unplug and reconnect the phone")
+		return nil
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+
+	stateDir, dirErr := paths.StateDir()
+	if dirErr != nil {
+		return err
+	}
+	saved := filepath.Join(stateDir, rulesFileName)
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(saved, []byte(device.UdevRules()), 0644); err != nil {
+		return err
+	}
+
+	r.Warning("Installing udev rules needs root. The rules were saved to " + saved)
+	r.Info("Install them with:")
+	r.Info(fmt.Sprintf("  sudo install -m 0644 %s %s", saved, device.UdevRulesPath))
+	r.Info("  sudo udevadm control --reload-rules && sudo udevadm trigger")
+	return nil
+}
+
+// ManageUdevRules runs the --udev check, print or install action; print writes the rules to out
+func ManageUdevRules(r report.Reporter, action string, out io.Writer) error {
+	switch action {
+	case "print":
+		_, err := io.WriteString(out, device.UdevRules())
+		return err
+	case "install":
+		r.Section("🔌 USB Access")
+		return InstallUdevRules(r)
+	case "check":
+		r.Section("🔌 USB Access")
+	default:
+		return fmt.Errorf("unknown udev action %q, use check, print or install", action)
+	}
+
+	statuses, err := device.CheckUSBAccess(fastboot.DefaultSysfsRoot, fastboot.DefaultDevRoot)
+	if errors.Is(err, os.ErrNotExist) {
+		// Containers and some sandboxes hide the USB bus entirely
+		r.Warning("No USB devices are visible at " + fastboot.DefaultSysfsRoot)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(statuses) == 0 {
+		r.Warning("No device in fastboot mode is attached over USB")
+		return nil
+	}
+
+	var denied error
+	for _, status := range statuses {
+		d := status.Device
+		label := fmt.Sprintf("%04x:%04x %s", d.VendorID, d.ProductID, d.Serial)
+		if status.Err != nil {
+			r.Error(fmt.Sprintf("%s at %s: %v", label, status.DevNode, status.Err))
+			denied = fmt.Errorf("%w: %s: %v", device.ErrUSBPermission, status.DevNode, status.Err)
+		} else {
+			r.Success(fmt.Sprintf("%s at %s can be opened", label, status.DevNode))
+		}
+	}
+	return explainUSBPermission(r, denied)
+}
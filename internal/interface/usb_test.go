@@ -0,0 +1,57 @@
+package interfaces
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"muitoolunlock/internal/device"
+	"muitoolunlock/internal/report"
+)
+
+func TestOfferUdevRulesDeclined(t *testing.T) {
+	denied := fmt.Errorf("%w: /dev/bus/usb/001/004: permission denied", device.ErrUSBPermission)
+	ui := report.NewRecorder("n")
+
+	if err := offerUdevRules(ui, denied); err != denied {
+		t.Errorf("offerUdevRules() = %v, want the original error", err)
+	}
+	if sections := ui.Messages("section"); len(sections) != 1 || !strings.Contains(sections[0], "USB Permission") {
+		t.Errorf("sections = %q", sections)
+	}
+	if confirms := ui.Messages("confirm"); len(confirms) != 1 {
+		t.Errorf("confirms = %q, want one question", confirms)
+	}
+	if successes := ui.Messages("success"); len(successes) != 0 {
+		t.Errorf("rules were installed after declining: %q", successes)
+	}
+}
+
+func TestOfferUdevRulesOtherError(t *testing.T) {
+	other := errors.New("fastboot crashed")
+	ui := report.NewRecorder()
+
+	if err := offerUdevRules(ui, other); err != other {
+		t.Errorf("offerUdevRules() = %v, want %v", err, other)
+	}
+	if len(ui.Events) != 0 {
+		t.Errorf("offerUdevRules() reported %+v for an unrelated error", ui.Events)
+	}
+}
+
+func TestManageUdevRules(t *testing.T) {
+	ui := report.NewRecorder()
+	var out strings.Builder
+
+	if err := ManageUdevRules(ui, "print", &out); err != nil {
+		t.Fatalf("ManageUdevRules(print) error = %v", err)
+	}
+	if out.String() != device.UdevRules() || len(ui.Events) != 0 {
+		t.Errorf("ManageUdevRules(print) wrote %q and reported %+v", out.String(), ui.Events)
+	}
+
+	if err := ManageUdevRules(ui, "remove", &out); err == nil {
+		t.Error("ManageUdevRules(remove) succeeded")
+	}
+}
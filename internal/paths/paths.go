@@ -0,0 +1,211 @@
+// Package paths resolves the per-user directories the tool keeps its files in, following the
+// XDG Base Directory specification, and moves files left behind by older versions.
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// AppName is the folder created below each base directory
+const AppName = "mui-tool-unlock"
+
+// Environment variables overriding each directory; they name the final folder, without AppName
+const (
+	EnvConfigDir = "MUI_CONFIG_DIR"
+	EnvStateDir  = "MUI_STATE_DIR"
+	EnvCacheDir  = "MUI_CACHE_DIR"
+)
+
+// overrides set with SetConfigDir, SetStateDir and SetCacheDir take precedence over the environment
+var overrides struct {
+	config, state, cache string
+}
+
+// SetConfigDir overrides the config directory; an empty dir restores the default
+func SetConfigDir(dir string) {
+	overrides.config = dir
+}
+
+// SetStateDir overrides the state directory; an empty dir restores the default
+func SetStateDir(dir string) {
+	overrides.state = dir
+}
+
+// SetCacheDir overrides the cache directory; an empty dir restores the default
+func SetCacheDir(dir string) {
+	overrides.cache = dir
+}
+
+// ConfigDir returns the directory for settings such as the profile list:
+// $XDG_CONFIG_HOME/mui-tool-unlock, or the platform's config folder
+func ConfigDir() (string, error) {
+	return resolve(overrides.config, EnvConfigDir, "XDG_CONFIG_HOME", os.UserConfigDir)
+}
+
+// StateDir returns the directory for account data and tokens:
+// $XDG_STATE_HOME/mui-tool-unlock, or ~/.local/state/mui-tool-unlock
+func StateDir() (string, error) {
+	return resolve(overrides.state, EnvStateDir, "XDG_STATE_HOME", userStateDir)
+}
+
+// CacheDir returns the directory for downloads that can be fetched again, such as the
+// platform-tools: $XDG_CACHE_HOME/mui-tool-unlock, or the platform's cache folder
+func CacheDir() (string, error) {
+	return resolve(overrides.cache, EnvCacheDir, "XDG_CACHE_HOME", os.UserCacheDir)
+}
+
+// resolve picks the override, then the tool's environment variable, then the XDG variable and
+// finally the platform default. The XDG specification says relative paths are to be ignored.
+func resolve(override, env, xdg string, fallback func() (string, error)) (string, error) {
+	if override != "" {
+		return filepath.Abs(override)
+	}
+	if dir := os.Getenv(env); dir != "" {
+		return filepath.Abs(dir)
+	}
+	if dir := os.Getenv(xdg); filepath.IsAbs(dir) {
+		return filepath.Join(dir, AppName), nil
+	}
+
+	base, err := fallback()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the user directory (set %s): %w", env, err)
+	}
+	return filepath.Join(base, AppName), nil
+}
+
+// userStateDir is the default XDG state home; macOS and Windows have no separate state folder
+func userStateDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		return os.UserConfigDir()
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state"), nil
+}
+
+// migratedMarker is written to the state directory once the old files have been moved
+const migratedMarker = ".migrated"
+
+// rename is os.Rename, replaced in tests to act as if the folders were on separate devices
+var rename = os.Rename
+
+// Move is a file or folder to relocate from an old location
+type Move struct {
+	From, To string
+}
+
+// Migrate performs the moves once per state directory, in order. A move is skipped when its
+// source is missing or its destination already exists, so nothing is ever overwritten. The
+// moves done are returned; when one fails the marker is not written and the next call retries.
+func Migrate(moves []Move) ([]Move, error) {
+	state, err := StateDir()
+	if err != nil {
+		return nil, err
+	}
+	marker := filepath.Join(state, migratedMarker)
+	if _, err := os.Stat(marker); err == nil {
+		return nil, nil
+	}
+
+	var done []Move
+	var errs []error
+	for _, move := range moves {
+		moved, err := move.run()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if moved {
+			done = append(done, move)
+		}
+	}
+	if len(errs) > 0 {
+		return done, errors.Join(errs...)
+	}
+
+	if err := os.MkdirAll(state, 0700); err != nil {
+		return done, err
+	}
+	return done, os.WriteFile(marker, nil, 0600)
+}
+
+// run moves From to To and reports whether anything was moved
+func (m Move) run() (bool, error) {
+	from, err := filepath.Abs(m.From)
+	if err != nil {
+		return false, err
+	}
+	to, err := filepath.Abs(m.To)
+	if err != nil {
+		return false, err
+	}
+	if from == to {
+		return false, nil
+	}
+	if _, err := os.Lstat(from); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return false, fmt.Errorf("failed to move %s: %w", from, err)
+	}
+	if err := rename(from, to); err != nil {
+		// Renaming fails across file systems; copy and remove the original instead
+		if err := copyTree(from, to); err != nil {
+			os.RemoveAll(to)
+			return false, fmt.Errorf("failed to move %s to %s: %w", from, to, err)
+		}
+		if err := os.RemoveAll(from); err != nil {
+			return true, fmt.Errorf("copied %s to %s but failed to remove it: %w", from, to, err)
+		}
+	}
+	return true, nil
+}
+
+// copyTree copies a file or folder, keeping the permissions
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return fmt.Errorf("cannot copy %s: not a regular file", path)
+		}
+	})
+}
+
+// copyFile copies one regular file
+func copyFile(src, dst string, perm os.FileMode) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, perm)
+}
@@ -0,0 +1,180 @@
+package paths
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// xdgHome points every XDG base directory into a temporary folder and returns it
+func xdgHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	for _, env := range []string{EnvConfigDir, EnvStateDir, EnvCacheDir} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "cache"))
+	return home
+}
+
+// writeFile creates path and its folders with content
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of path, or "" when it cannot be read
+func readFile(path string) string {
+	data, _ := os.ReadFile(path)
+	return string(data)
+}
+
+func TestDirsFollowXDG(t *testing.T) {
+	home := xdgHome(t)
+
+	for name, dir := range map[string]func() (string, error){"config": ConfigDir, "state": StateDir, "cache": CacheDir} {
+		got, err := dir()
+		if want := filepath.Join(home, name, AppName); err != nil || got != want {
+			t.Errorf("%s dir = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	// A relative XDG path is ignored, the tool's own variable wins over XDG
+	t.Setenv("XDG_STATE_HOME", "relative")
+	if got, _ := StateDir(); got == filepath.Join("relative", AppName) {
+		t.Errorf("StateDir() used a relative XDG_STATE_HOME")
+	}
+	t.Setenv(EnvStateDir, filepath.Join(home, "mine"))
+	if got, _ := StateDir(); got != filepath.Join(home, "mine") {
+		t.Errorf("StateDir() = %q, want %s", got, EnvStateDir)
+	}
+}
+
+func TestMigrateOnce(t *testing.T) {
+	home := xdgHome(t)
+	old := filepath.Join(home, "old")
+	writeFile(t, filepath.Join(old, "data.json"), "account")
+	writeFile(t, filepath.Join(old, "platform-tools", "fastboot"), "fastboot")
+	state, _ := StateDir()
+	moves := []Move{
+		{From: filepath.Join(old, "data.json"), To: filepath.Join(state, "data.json")},
+		{From: filepath.Join(old, "platform-tools"), To: filepath.Join(home, "cache", AppName, "platform-tools")},
+		{From: filepath.Join(old, "missing.json"), To: filepath.Join(state, "missing.json")},
+	}
+
+	done, err := Migrate(moves)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if len(done) != 2 || done[0] != moves[0] || done[1] != moves[1] {
+		t.Errorf("Migrate() moved %+v, want the two existing sources", done)
+	}
+	if readFile(moves[0].To) != "account" || readFile(filepath.Join(moves[1].To, "fastboot")) != "fastboot" {
+		t.Error("moved files lost their content")
+	}
+	if _, err := os.Stat(filepath.Join(old, "data.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("source kept after the move: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(state, migratedMarker)); err != nil {
+		t.Errorf("marker not written: %v", err)
+	}
+
+	// Once marked, files left at the old location again stay there
+	writeFile(t, filepath.Join(old, "data.json"), "newer")
+	os.Remove(moves[0].To)
+	if done, err := Migrate(moves); err != nil || len(done) != 0 {
+		t.Errorf("second Migrate() = %+v, %v, want nothing", done, err)
+	}
+	if readFile(filepath.Join(old, "data.json")) != "newer" {
+		t.Error("second Migrate() moved a file")
+	}
+}
+
+func TestMigrateKeepsExistingFiles(t *testing.T) {
+	home := xdgHome(t)
+	move := Move{From: filepath.Join(home, "old", "data.json"), To: filepath.Join(home, "new", "data.json")}
+	writeFile(t, move.From, "old account")
+	writeFile(t, move.To, "current account")
+
+	done, err := Migrate([]Move{move})
+	if err != nil || len(done) != 0 {
+		t.Fatalf("Migrate() = %+v, %v, want nothing moved", done, err)
+	}
+	if readFile(move.To) != "current account" || readFile(move.From) != "old account" {
+		t.Errorf("Migrate() overwrote %s or removed %s", move.To, move.From)
+	}
+}
+
+func TestMigrateCopiesAcrossDevices(t *testing.T) {
+	home := xdgHome(t)
+	rename = func(from, to string) error {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() { rename = os.Rename })
+
+	old := filepath.Join(home, "old", "platform-tools")
+	writeFile(t, filepath.Join(old, "fastboot"), "fastboot")
+	writeFile(t, filepath.Join(old, "lib", "libc++.so"), "lib")
+	if err := os.Chmod(filepath.Join(old, "fastboot"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	move := Move{From: old, To: filepath.Join(home, "cache", "platform-tools")}
+
+	if done, err := Migrate([]Move{move}); err != nil || len(done) != 1 {
+		t.Fatalf("Migrate() = %+v, %v", done, err)
+	}
+	if readFile(filepath.Join(move.To, "fastboot")) != "fastboot" || readFile(filepath.Join(move.To, "lib", "libc++.so")) != "lib" {
+		t.Error("copied folder lost files")
+	}
+	if info, err := os.Stat(filepath.Join(move.To, "fastboot")); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0755) {
+		t.Errorf("copied fastboot = %v, %v, want mode 0755", info, err)
+	}
+	if _, err := os.Stat(old); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("source kept after the copy: %v", err)
+	}
+}
+
+func TestMigrateRetriesAfterFailure(t *testing.T) {
+	home := xdgHome(t)
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	rename = func(from, to string) error {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() { rename = os.Rename })
+
+	// A symbolic link cannot be copied, so the move fails and is retried next time
+	old := filepath.Join(home, "old")
+	writeFile(t, filepath.Join(old, "tools", "fastboot"), "fastboot")
+	if err := os.Symlink("fastboot", filepath.Join(old, "tools", "link")); err != nil {
+		t.Fatal(err)
+	}
+	move := Move{From: filepath.Join(old, "tools"), To: filepath.Join(home, "new", "tools")}
+
+	if _, err := Migrate([]Move{move}); err == nil {
+		t.Fatal("Migrate() of an uncopyable folder succeeded")
+	}
+	if _, err := os.Stat(move.To); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial copy left at the destination: %v", err)
+	}
+	state, _ := StateDir()
+	if _, err := os.Stat(filepath.Join(state, migratedMarker)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("marker written after a failed move: %v", err)
+	}
+
+	rename = os.Rename
+	if done, err := Migrate([]Move{move}); err != nil || len(done) != 1 {
+		t.Errorf("retried Migrate() = %+v, %v", done, err)
+	}
+}
@@ -0,0 +1,333 @@
+package platform
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"muitoolunlock/internal/httpclient"
+)
+
+// Download errors; match them with errors.Is
+var (
+	ErrHTTPStatus = errors.New("unexpected HTTP status")
+	ErrTooLarge   = errors.New("download exceeds the maximum size")
+	ErrChecksum   = errors.New("SHA-256 checksum mismatch")
+	ErrNoChecksum = errors.New("no SHA-256 digest is known for the archive")
+)
+
+// DefaultMaxSize caps a platform-tools download; the archives are well under 100 MB
+const DefaultMaxSize = 100 << 20
+
+// DefaultTimeout bounds a whole download, including a slow connection
+const DefaultTimeout = 10 * time.Minute
+
+// Downloader fetches files over HTTP into a ".part" file that a later attempt resumes with a
+// Range request. The file is only moved into place once complete and verified.
+type Downloader struct {
+	Client *http.Client
+	// MaxSize is the largest accepted file in bytes
+	MaxSize int64
+	// Progress is called as bytes arrive; total is -1 when the server does not say
+	Progress func(done, total int64)
+}
+
+// NewDownloader creates a downloader using the shared HTTP client, bounded by DefaultTimeout,
+// and the default size limit
+func NewDownloader() *Downloader {
+	client := *httpclient.Default()
+	client.Timeout = DefaultTimeout
+	return &Downloader{
+		Client:  &client,
+		MaxSize: DefaultMaxSize,
+	}
+}
+
+// Download fetches url to dest. When sha256Hex is not empty the file must match it.
+func (d *Downloader) Download(url, dest, sha256Hex string) error {
+	part := dest + ".part"
+
+	// A partial file is only continued when the server can confirm it has not changed since
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+	validator, _ := os.ReadFile(validatorPath(part))
+	if offset > d.MaxSize || (offset > 0 && len(validator) == 0) {
+		removePart(part)
+		offset = 0
+	}
+
+	complete, err := d.fetch(url, part, offset, string(validator))
+	if errors.Is(err, errResume) {
+		// The partial file cannot be continued; start over once
+		removePart(part)
+		complete, err = d.fetch(url, part, 0, "")
+	}
+	if err != nil {
+		return err
+	}
+	if !complete {
+		// Keep the partial file so the next attempt resumes it
+		return fmt.Errorf("download of %s ended early: %w", url, io.ErrUnexpectedEOF)
+	}
+
+	if sha256Hex != "" {
+		if err := verifySHA256(part, sha256Hex); err != nil {
+			removePart(part)
+			return err
+		}
+	}
+	os.Remove(validatorPath(part))
+	return os.Rename(part, dest)
+}
+
+// errResume is returned by fetch when the server cannot continue the partial file
+var errResume = errors.New("server cannot resume the download")
+
+// validatorPath returns the file keeping the ETag or Last-Modified date of a partial download
+func validatorPath(part string) string {
+	return part + ".validator"
+}
+
+// removePart deletes a partial download together with its validator
+func removePart(part string) {
+	os.Remove(part)
+	os.Remove(validatorPath(part))
+}
+
+// rangeValidator returns the response's strong ETag or, without one, its Last-Modified date;
+// weak ETags cannot be used with If-Range
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// fetch downloads url into part starting at offset and reports whether the file is complete.
+// A resumed request carries validator as If-Range, so a changed file is sent whole.
+func (d *Downloader) fetch(url, part string, offset int64, validator string) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return false, fmt.Errorf("%w: Content-Range %q", errResume, resp.Header.Get("Content-Range"))
+		}
+		total = size
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Nothing left to send when the partial file already holds the whole file
+		if _, size, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && size == offset {
+			return true, nil
+		}
+		return false, fmt.Errorf("%w: %s", errResume, resp.Status)
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the Range header or the file changed: start from the beginning
+		offset = 0
+		total = resp.ContentLength
+		flags |= os.O_TRUNC
+	default:
+		return false, fmt.Errorf("%w: %s: %s", ErrHTTPStatus, url, resp.Status)
+	}
+
+	if total > d.MaxSize {
+		return false, fmt.Errorf("%w: %d bytes", ErrTooLarge, total)
+	}
+
+	out, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+
+	if offset == 0 {
+		// Remember which file this is so an interrupted download can be resumed safely
+		if validator := rangeValidator(resp.Header); validator != "" {
+			if err := os.WriteFile(validatorPath(part), []byte(validator), 0644); err != nil {
+				return false, err
+			}
+		} else {
+			os.Remove(validatorPath(part))
+		}
+	}
+
+	counter := &progressWriter{done: offset, total: total, report: d.Progress}
+	counter.emit()
+
+	// Read one byte past the limit to notice a server that sends more than it announced
+	written, err := io.Copy(out, io.TeeReader(io.LimitReader(resp.Body, d.MaxSize-offset+1), counter))
+	if offset+written > d.MaxSize {
+		out.Close()
+		removePart(part)
+		return false, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, d.MaxSize)
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := out.Close(); err != nil {
+		return false, err
+	}
+
+	return total < 0 || offset+written == total, nil
+}
+
+// parseContentRange reads "bytes start-end/size" or "bytes */size"; size is -1 when unknown
+func parseContentRange(value string) (start, size int64, ok bool) {
+	value, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	span, sizeText, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	size = -1
+	if sizeText != "*" {
+		n, err := strconv.ParseInt(sizeText, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		size = n
+	}
+	if span == "*" {
+		return 0, size, true
+	}
+
+	startText, _, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+// progressWriter counts bytes passing through and reports them
+type progressWriter struct {
+	done   int64
+	total  int64
+	report func(done, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	p.emit()
+	return len(b), nil
+}
+
+func (p *progressWriter) emit() {
+	if p.report != nil {
+		p.report(p.done, p.total)
+	}
+}
+
+// verifySHA256 checks the file at path against a hex SHA-256 digest
+func verifySHA256(path, expected string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, strings.TrimSpace(expected)) {
+		return fmt.Errorf("%w: got %s, want %s", ErrChecksum, actual, expected)
+	}
+	return nil
+}
+
+// ParseManifest reads a SHA256SUMS-style manifest ("<hex digest>  <file name>" per line)
+// into a map from file name to digest
+func ParseManifest(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid manifest line: %q", line)
+		}
+		// sha256sum marks binary mode with a leading '*'
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums, scanner.Err()
+}
+
+// PinnedSHA256 maps the archive names of pinned releases to their SHA-256 digests. Only
+// release archives can be listed: the "latest" archives change with every release. A
+// pinned release missing here needs MUI_PLATFORM_TOOLS_SHA256 or MUI_PLATFORM_TOOLS_MANIFEST
+// to be installed.
+var PinnedSHA256 = map[string]string{}
+
+// ExpectedSHA256 returns the digest the archive at archiveURL must match: the
+// MUI_PLATFORM_TOOLS_SHA256 environment variable, the archive's entry in the manifest at
+// MUI_PLATFORM_TOOLS_MANIFEST, or its entry in PinnedSHA256. It returns "" when none applies.
+func ExpectedSHA256(client *http.Client, archiveURL string) (string, error) {
+	if digest := os.Getenv("MUI_PLATFORM_TOOLS_SHA256"); digest != "" {
+		return digest, nil
+	}
+
+	name := path.Base(archiveURL)
+	manifestURL := os.Getenv("MUI_PLATFORM_TOOLS_MANIFEST")
+	if manifestURL == "" {
+		return PinnedSHA256[name], nil
+	}
+
+	resp, err := client.Get(manifestURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %s: %s", ErrHTTPStatus, manifestURL, resp.Status)
+	}
+
+	sums, err := ParseManifest(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	digest, ok := sums[name]
+	if !ok {
+		return "", fmt.Errorf("%s is not listed in %s", name, manifestURL)
+	}
+	return digest, nil
+}
@@ -0,0 +1,267 @@
+package platform
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// archiveServer serves content at /archive.zip with an ETag, honouring Range and If-Range, and
+// records the requests it gets
+type archiveServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	content  []byte
+	etag     string
+	requests []http.Header
+	// cut, when set, ends the first response after that many bytes
+	cut int
+}
+
+func newArchiveServer(t *testing.T, content []byte) *archiveServer {
+	s := &archiveServer{content: content, etag: `"v1"`}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *archiveServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Header.Clone())
+	content, etag, cut := s.content, s.etag, s.cut
+	s.cut = 0
+	s.mu.Unlock()
+
+	if r.URL.Path != "/archive.zip" {
+		http.NotFound(w, r)
+		return
+	}
+	if cut > 0 {
+		// Announce the whole file, then drop the connection part way
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content[:cut])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "archive.zip", time.Time{}, bytes.NewReader(content))
+}
+
+func (s *archiveServer) lastRequest() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+func digestOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func testDownloader(s *archiveServer) *Downloader {
+	return &Downloader{Client: s.Client(), MaxSize: DefaultMaxSize}
+}
+
+func TestDownloadStatus(t *testing.T) {
+	server := newArchiveServer(t, []byte("archive"))
+	dest := filepath.Join(t.TempDir(), "archive.zip")
+
+	err := testDownloader(server).Download(server.URL+"/missing.zip", dest, "")
+	if !errors.Is(err, ErrHTTPStatus) {
+		t.Fatalf("Download() error = %v, want %v", err, ErrHTTPStatus)
+	}
+	if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("destination exists after a failed download: %v", err)
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := bytes.Repeat([]byte("platform-tools "), 1000)
+	server := newArchiveServer(t, content)
+	server.cut = 4096
+	dest := filepath.Join(t.TempDir(), "archive.zip")
+	downloader := testDownloader(server)
+
+	if err := downloader.Download(server.URL+"/archive.zip", dest, digestOf(content)); err == nil {
+		t.Fatal("Download() of a dropped connection succeeded")
+	}
+	part, err := os.ReadFile(dest + ".part")
+	if err != nil || !bytes.Equal(part, content[:4096]) {
+		t.Fatalf("partial file = %d bytes, %v", len(part), err)
+	}
+
+	if err := downloader.Download(server.URL+"/archive.zip", dest, digestOf(content)); err != nil {
+		t.Fatalf("resumed Download() error = %v", err)
+	}
+	request := server.lastRequest()
+	if request.Get("Range") != "bytes=4096-" || request.Get("If-Range") != `"v1"` {
+		t.Errorf("resume request Range = %q, If-Range = %q", request.Get("Range"), request.Get("If-Range"))
+	}
+	if got, err := os.ReadFile(dest); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, %v, want %d", len(got), err, len(content))
+	}
+	for _, leftover := range []string{dest + ".part", validatorPath(dest + ".part")} {
+		if _, err := os.Stat(leftover); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left behind: %v", leftover, err)
+		}
+	}
+}
+
+func TestDownloadResumeChangedFile(t *testing.T) {
+	old := bytes.Repeat([]byte("r34 "), 1000)
+	content := bytes.Repeat([]byte("r35 "), 1000)
+	server := newArchiveServer(t, old)
+	server.cut = 1000
+	dest := filepath.Join(t.TempDir(), "archive.zip")
+	downloader := testDownloader(server)
+
+	downloader.Download(server.URL+"/archive.zip", dest, "")
+
+	// The mirror publishes a new file before the download is resumed
+	server.mu.Lock()
+	server.content, server.etag = content, `"v2"`
+	server.mu.Unlock()
+
+	if err := downloader.Download(server.URL+"/archive.zip", dest, digestOf(content)); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+		t.Errorf("downloaded file mixes both releases")
+	}
+}
+
+func TestDownloadPartWithoutValidator(t *testing.T) {
+	content := []byte("the whole archive")
+	server := newArchiveServer(t, content)
+	dest := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(dest+".part", []byte("unrelated bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testDownloader(server).Download(server.URL+"/archive.zip", dest, ""); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if request := server.lastRequest(); request.Get("Range") != "" {
+		t.Errorf("resumed a partial file of unknown origin: Range = %q", request.Get("Range"))
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+		t.Errorf("downloaded %q", got)
+	}
+}
+
+func TestDownloadTooLarge(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 1000)
+	server := newArchiveServer(t, content)
+	dest := filepath.Join(t.TempDir(), "archive.zip")
+	downloader := testDownloader(server)
+	downloader.MaxSize = 999
+
+	if err := downloader.Download(server.URL+"/archive.zip", dest, ""); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Download() error = %v, want %v", err, ErrTooLarge)
+	}
+
+	// A server that does not announce the size is cut off at the limit
+	unsized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for range 10 {
+			w.Write(content[:100])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer unsized.Close()
+
+	err := downloader.Download(unsized.URL+"/archive.zip", dest, "")
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Download() without Content-Length error = %v, want %v", err, ErrTooLarge)
+	}
+	if _, err := os.Stat(dest + ".part"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("oversized partial file kept: %v", err)
+	}
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	content := []byte("the whole archive")
+	server := newArchiveServer(t, content)
+	dest := filepath.Join(t.TempDir(), "archive.zip")
+	downloader := testDownloader(server)
+
+	err := downloader.Download(server.URL+"/archive.zip", dest, digestOf([]byte("another archive")))
+	if !errors.Is(err, ErrChecksum) {
+		t.Fatalf("Download() error = %v, want %v", err, ErrChecksum)
+	}
+	for _, path := range []string{dest, dest + ".part"} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s exists after a checksum mismatch: %v", path, err)
+		}
+	}
+
+	if err := downloader.Download(server.URL+"/archive.zip", dest, strings.ToUpper(digestOf(content))); err != nil {
+		t.Errorf("Download() with the right digest error = %v", err)
+	}
+}
+
+func TestExpectedSHA256(t *testing.T) {
+	manifest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(digestOf([]byte("linux")) + "  platform-tools_r35.0.2-linux.zip\n"))
+	}))
+	defer manifest.Close()
+
+	pinned := "platform-tools_r35.0.2-darwin.zip"
+	PinnedSHA256[pinned] = digestOf([]byte("darwin"))
+	t.Cleanup(func() { delete(PinnedSHA256, pinned) })
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		url      string
+		want     string
+		wantFail bool
+	}{
+		{name: "nothing known", url: DefaultMirror + "/platform-tools-latest-linux.zip"},
+		{name: "pinned release", url: DefaultMirror + "/" + pinned, want: digestOf([]byte("darwin"))},
+		{name: "pinned release on a mirror", url: "https://mirror.example/android/" + pinned, want: digestOf([]byte("darwin"))},
+		{
+			name: "environment",
+			env:  map[string]string{"MUI_PLATFORM_TOOLS_SHA256": "abc"},
+			url:  DefaultMirror + "/" + pinned,
+			want: "abc",
+		},
+		{
+			name: "manifest",
+			env:  map[string]string{"MUI_PLATFORM_TOOLS_MANIFEST": manifest.URL},
+			url:  DefaultMirror + "/platform-tools_r35.0.2-linux.zip",
+			want: digestOf([]byte("linux")),
+		},
+		{
+			name:     "not in the manifest",
+			env:      map[string]string{"MUI_PLATFORM_TOOLS_MANIFEST": manifest.URL},
+			url:      DefaultMirror + "/" + pinned,
+			wantFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MUI_PLATFORM_TOOLS_SHA256", "")
+			t.Setenv("MUI_PLATFORM_TOOLS_MANIFEST", "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			got, err := ExpectedSHA256(manifest.Client(), tt.url)
+			if (err != nil) != tt.wantFail || got != tt.want {
+				t.Errorf("ExpectedSHA256() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// Fastboot version errors; match them with errors.Is
+var (
+	ErrFastbootVersion = errors.New("cannot read the fastboot version")
+	ErrFastbootTooOld  = errors.New("fastboot is too old")
+	ErrFastbootPinned  = errors.New("fastboot is not the pinned release")
+)
+
+// Version is a fastboot release number such as 35.0.2
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// MinVersion is the oldest fastboot release known to support the "stage" command used to unlock
+var MinVersion = Version{Major: 28}
+
+// versionPattern matches "fastboot version 35.0.2-12147458", also with a Debian epoch ("1:29.0.6")
+var versionPattern = regexp.MustCompile(`version\s+(?:\d+:)?(\d+)\.(\d+)\.(\d+)`)
+
+// ParseVersion reads the release number from "fastboot --version" output
+func ParseVersion(output string) (Version, error) {
+	matches := versionPattern.FindStringSubmatch(output)
+	if matches == nil {
+		return Version{}, fmt.Errorf("%w: %q", ErrFastbootVersion, firstLine(output))
+	}
+
+	var parts [3]int
+	for i := range parts {
+		n, err := strconv.Atoi(matches[i+1])
+		if err != nil {
+			return Version{}, fmt.Errorf("%w: %q", ErrFastbootVersion, firstLine(output))
+		}
+		parts[i] = n
+	}
+	return Version{Major: parts[0], Minor: parts[1], Patch: parts[2]}, nil
+}
+
+// Less reports whether v is an older release than other
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// FastbootVersion runs "fastboot --version" and checks the binary is at least MinVersion
+func FastbootVersion(path string) (Version, error) {
+	output, err := exec.Command(path, "--version").CombinedOutput()
+	if err != nil {
+		return Version{}, fmt.Errorf("%w: %s --version: %v", ErrFastbootVersion, path, err)
+	}
+
+	version, err := ParseVersion(string(output))
+	if err != nil {
+		return Version{}, err
+	}
+	if version.Less(MinVersion) {
+		return version, fmt.Errorf("%w: %s is %s, need %s or newer", ErrFastbootTooOld, path, version, MinVersion)
+	}
+	return version, nil
+}
+
+// Fastboot is the binary chosen by Discover
+type Fastboot struct {
+	Path    string
+	Version Version
+	// Reason says where the binary was found
+	Reason string
+	// Skipped explains why earlier candidates were not used
+	Skipped []error
+}
+
+// Discover picks the fastboot binary to use: the explicit path when one is given, otherwise the
+// first usable one of fastboot on $PATH and the managed install. An explicit path that does
+// not pass the version check is an error. When the manager pins a release, only that release
+// is usable apart from an explicit path. ErrNotInstalled is returned, along with the skipped
+// candidates, when the managed install is needed but missing.
+func Discover(explicit string, manager *Manager) (*Fastboot, error) {
+	if explicit != "" {
+		version, err := FastbootVersion(explicit)
+		if err != nil {
+			return nil, err
+		}
+		return &Fastboot{Path: explicit, Version: version, Reason: "set with --fastboot"}, nil
+	}
+
+	found := &Fastboot{}
+	if path, err := exec.LookPath("fastboot"); err == nil {
+		version, err := FastbootVersion(path)
+		if err == nil {
+			err = manager.CheckPinned(path, version)
+		}
+		if err == nil {
+			found.Path, found.Version, found.Reason = path, version, "found on $PATH"
+			return found, nil
+		}
+		found.Skipped = append(found.Skipped, err)
+	}
+
+	if err := manager.Verify(); err != nil {
+		return found, err
+	}
+	managed, err := manager.CheckFastboot()
+	if err != nil {
+		return found, err
+	}
+	managed.Skipped = found.Skipped
+	return managed, nil
+}
+
+// CheckFastboot runs the managed fastboot and returns it when it is recent enough and, if a
+// release is pinned, that release
+func (m *Manager) CheckFastboot() (*Fastboot, error) {
+	version, err := FastbootVersion(m.FastbootPath())
+	if err == nil {
+		err = m.CheckPinned(m.FastbootPath(), version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Fastboot{Path: m.FastbootPath(), Version: version, Reason: "managed platform-tools"}, nil
+}
+
+// Prepare makes the managed install usable and returns its fastboot: it repairs a broken
+// install, installs a missing one and replaces one whose fastboot fails CheckFastboot
+func (m *Manager) Prepare() (*Fastboot, error) {
+	err := m.Verify()
+	if err == nil {
+		if found, checkErr := m.CheckFastboot(); checkErr == nil {
+			return found, nil
+		}
+		err = m.Install()
+	} else {
+		err = m.Repair()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m.CheckFastboot()
+}
+
+// CheckPinned returns ErrFastbootPinned when a release is pinned and the fastboot at path,
+// reporting version, is a different one
+func (m *Manager) CheckPinned(path string, version Version) error {
+	if m.Pinned == nil || version == *m.Pinned {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is %s, want %s", ErrFastbootPinned, path, version, *m.Pinned)
+}
+
+// firstLine returns the first line of command output, for error messages
+func firstLine(output string) string {
+	for i, c := range output {
+		if c == '\n' || c == '\r' {
+			return output[:i]
+		}
+	}
+	return output
+}
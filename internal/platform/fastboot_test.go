@@ -0,0 +1,151 @@
+package platform
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    Version
+		wantErr bool
+	}{
+		{
+			name:   "platform-tools",
+			output: "fastboot version 35.0.2-12147458\nInstalled as /home/user/platform-tools/fastboot\n",
+			want:   Version{Major: 35, Minor: 0, Patch: 2},
+		},
+		{
+			name:   "windows",
+			output: "fastboot version 34.0.5-10900879\r\nInstalled as C:\\platform-tools\\fastboot.exe\r\n",
+			want:   Version{Major: 34, Minor: 0, Patch: 5},
+		},
+		{
+			name:   "debian epoch",
+			output: "fastboot version 1:29.0.6-6\nInstalled as /usr/lib/android-sdk/platform-tools/fastboot\n",
+			want:   Version{Major: 29, Minor: 0, Patch: 6},
+		},
+		{
+			name:   "debian package",
+			output: "fastboot version 28.0.2-debian\nInstalled as /usr/lib/android-sdk/platform-tools/fastboot\n",
+			want:   Version{Major: 28, Minor: 0, Patch: 2},
+		},
+		{
+			name:   "before the stage command",
+			output: "fastboot version 27.0.1-4500957\nInstalled as /opt/platform-tools/fastboot\n",
+			want:   Version{Major: 27, Minor: 0, Patch: 1},
+		},
+		{name: "commit hash", output: "fastboot version 0e9850346394-android\n", wantErr: true},
+		{name: "no version flag", output: "fastboot: unrecognized option '--version'\nusage: fastboot [OPTION...] COMMAND...\n", wantErr: true},
+		{name: "empty", output: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVersion(tt.output)
+			if tt.wantErr {
+				if !errors.Is(err, ErrFastbootVersion) {
+					t.Errorf("ParseVersion() = %s, %v, want %v", got, err, ErrFastbootVersion)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseVersion() = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// fakeFastboot writes a fastboot script into dir that prints output for --version
+func fakeFastboot(t *testing.T, dir, output string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "fastboot")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho '"+output+"'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiscover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake fastboot is a shell script")
+	}
+
+	tests := []struct {
+		name     string
+		explicit string
+		path     string
+		managed  string
+		pinned   *Version
+		want     string
+		wantErr  error
+		skipped  []error
+	}{
+		{name: "explicit before $PATH", explicit: "36.0.0", path: "35.0.2", managed: "35.0.2", want: "explicit"},
+		{name: "explicit too old", explicit: "27.0.1", path: "35.0.2", wantErr: ErrFastbootTooOld},
+		{name: "$PATH before managed", path: "35.0.2", managed: "36.0.0", want: "path"},
+		{name: "minimum on $PATH", path: "28.0.0", managed: "36.0.0", want: "path"},
+		{name: "too old on $PATH", path: "27.0.1", managed: "36.0.0", want: "managed", skipped: []error{ErrFastbootTooOld}},
+		{name: "unreadable on $PATH", path: "0e9850346394-android", managed: "36.0.0", want: "managed", skipped: []error{ErrFastbootVersion}},
+		{name: "only managed", managed: "35.0.2", want: "managed"},
+		{name: "pinned", path: "36.0.0", managed: "35.0.2", pinned: &Version{Major: 35, Patch: 2}, want: "managed", skipped: []error{ErrFastbootPinned}},
+		{name: "managed missing", path: "27.0.1", wantErr: ErrNotInstalled, skipped: []error{ErrFastbootTooOld}},
+		{name: "managed too old", managed: "27.0.1", wantErr: ErrFastbootTooOld},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			paths := map[string]string{}
+			pathDir := filepath.Join(dir, "bin")
+			t.Setenv("PATH", pathDir)
+			if tt.path != "" {
+				paths["path"] = fakeFastboot(t, pathDir, "fastboot version "+tt.path+"-12147458")
+			}
+			if tt.explicit != "" {
+				paths["explicit"] = fakeFastboot(t, filepath.Join(dir, "explicit"), "fastboot version "+tt.explicit+"-12147458")
+			}
+
+			manager := NewManager(filepath.Join(dir, "managed"))
+			manager.Pinned = tt.pinned
+			if tt.managed != "" {
+				paths["managed"] = fakeFastboot(t, manager.ToolsDir(), "fastboot version "+tt.managed+"-12147458")
+				if err := os.WriteFile(filepath.Join(manager.ToolsDir(), "adb"), []byte("#!/bin/sh\n"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			found, err := Discover(paths["explicit"], manager)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Discover() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil || found.Path != paths[tt.want] {
+				t.Fatalf("Discover() = %+v, %v, want the %s fastboot", found, err, tt.want)
+			}
+
+			if found == nil {
+				if len(tt.skipped) != 0 {
+					t.Errorf("Discover() returned no skipped candidates, want %v", tt.skipped)
+				}
+				return
+			}
+			if len(found.Skipped) != len(tt.skipped) {
+				t.Fatalf("skipped = %v, want %v", found.Skipped, tt.skipped)
+			}
+			for i, want := range tt.skipped {
+				if !errors.Is(found.Skipped[i], want) {
+					t.Errorf("skipped[%d] = %v, want %v", i, found.Skipped[i], want)
+				}
+			}
+		})
+	}
+}
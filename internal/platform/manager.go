@@ -0,0 +1,364 @@
+package platform
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"muitoolunlock/internal/paths"
+)
+
+// Install state errors; match them with errors.Is
+var (
+	ErrNotInstalled = errors.New("platform-tools are not installed")
+	ErrBroken       = errors.New("platform-tools install is incomplete")
+)
+
+// ToolsDirName is the folder the platform-tools archive unpacks to
+const ToolsDirName = "platform-tools"
+
+// Step is the part of an install that a Progress update is about
+type Step string
+
+const (
+	StepDownload Step = "download"
+	StepVerify   Step = "verify"
+	StepExtract  Step = "extract"
+	StepDone     Step = "done"
+)
+
+// Progress reports how far an operation got. Done and Total count bytes while downloading
+// and files while extracting; Total is -1 when unknown.
+type Progress struct {
+	Step  Step
+	Done  int64
+	Total int64
+}
+
+// Manager installs, verifies, repairs and removes the platform-tools kept in Dir
+type Manager struct {
+	// Dir holds the platform-tools folder
+	Dir string
+	// URL is the archive to install from
+	URL string
+	// Archive, when set, is a local archive installed instead of downloading URL
+	Archive string
+	// Pinned, when set, is the only fastboot release Discover accepts
+	Pinned *Version
+	// Unverified allows installing an archive without a known SHA-256 digest, except a pinned
+	// release or a mirror download
+	Unverified bool
+	Downloader *Downloader
+	// Progress, when set, is called as an install advances
+	Progress func(Progress)
+}
+
+// NewManager creates a manager for the platform-tools in dir, installing Google's latest release
+func NewManager(dir string) *Manager {
+	return &Manager{
+		Dir:        dir,
+		URL:        ArchiveURL("", nil, runtime.GOOS),
+		Downloader: NewDownloader(),
+	}
+}
+
+// DefaultDir is where the platform-tools are kept: the cache directory
+func DefaultDir() (string, error) {
+	dir, err := paths.CacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the cache directory: %w", err)
+	}
+	return dir, nil
+}
+
+// MigrationMoves lists the platform-tools older versions kept in workDir
+func MigrationMoves(workDir string) ([]paths.Move, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return []paths.Move{{From: filepath.Join(workDir, ToolsDirName), To: filepath.Join(dir, ToolsDirName)}}, nil
+}
+
+// Configure selects where Install gets the platform-tools from and which release to accept
+func (m *Manager) Configure(src Source) error {
+	var release *Version
+	if src.Version != "" && src.Version != "latest" {
+		version, err := ParseRelease(src.Version)
+		if err != nil {
+			return err
+		}
+		release = &version
+	}
+
+	m.URL = ArchiveURL(src.Mirror, release, runtime.GOOS)
+	m.Archive = src.Zip
+	m.Pinned = release
+	m.Unverified = src.Unverified
+	return nil
+}
+
+// ToolsDir returns the platform-tools folder
+func (m *Manager) ToolsDir() string {
+	return filepath.Join(m.Dir, ToolsDirName)
+}
+
+// FastbootPath returns where the managed fastboot binary lives
+func (m *Manager) FastbootPath() string {
+	return filepath.Join(m.ToolsDir(), executable("fastboot"))
+}
+
+// binaries are the tools an install must contain
+func (m *Manager) binaries() []string {
+	return []string{
+		filepath.Join(m.ToolsDir(), executable("fastboot")),
+		filepath.Join(m.ToolsDir(), executable("adb")),
+	}
+}
+
+// Verify checks that fastboot and adb are present, non-empty and executable
+func (m *Manager) Verify() error {
+	if _, err := os.Stat(m.FastbootPath()); errors.Is(err, os.ErrNotExist) {
+		return ErrNotInstalled
+	}
+
+	for _, path := range m.binaries() {
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			return fmt.Errorf("%w: %v", ErrBroken, err)
+		case !info.Mode().IsRegular() || info.Size() == 0:
+			return fmt.Errorf("%w: %s is not a valid file", ErrBroken, path)
+		case runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0:
+			return fmt.Errorf("%w: %s is not executable", ErrBroken, path)
+		}
+	}
+	return nil
+}
+
+// Ensure installs the platform-tools unless a working install is present and returns the fastboot path
+func (m *Manager) Ensure() (string, error) {
+	if err := m.Verify(); err == nil {
+		return m.FastbootPath(), nil
+	}
+	if err := m.Repair(); err != nil {
+		return "", err
+	}
+	return m.FastbootPath(), nil
+}
+
+// needsDigest reports whether the archive must be verified even when Unverified is set: a
+// pinned release has to be the published archive, and a mirror is trusted no further than
+// what it serves
+func (m *Manager) needsDigest() bool {
+	if m.Pinned != nil {
+		return true
+	}
+	return m.Archive == "" && !strings.HasPrefix(m.URL, DefaultMirror+"/")
+}
+
+// Install downloads and unpacks the platform-tools, replacing any existing install
+func (m *Manager) Install() error {
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return fmt.Errorf("%w: %w", ErrDownload, err)
+	}
+	zipPath := m.downloadPath()
+	if m.Archive != "" {
+		zipPath = m.Archive
+	}
+
+	digest, err := ExpectedSHA256(m.Downloader.Client, filepath.ToSlash(m.Source()))
+	if err != nil {
+		return fmt.Errorf("%w: checksum: %w", ErrDownload, err)
+	}
+	if digest == "" && m.needsDigest() {
+		return fmt.Errorf("%w: %w for %s; pinned releases and mirror downloads must be verified, set MUI_PLATFORM_TOOLS_SHA256 or MUI_PLATFORM_TOOLS_MANIFEST",
+			ErrDownload, ErrNoChecksum, path.Base(filepath.ToSlash(m.Source())))
+	}
+	if digest == "" && !m.Unverified {
+		return fmt.Errorf("%w: %w for %s; set MUI_PLATFORM_TOOLS_SHA256 or MUI_PLATFORM_TOOLS_MANIFEST, or %s=1 to install it unverified",
+			ErrDownload, ErrNoChecksum, path.Base(filepath.ToSlash(m.Source())), EnvUnverified)
+	}
+
+	if m.Archive != "" {
+		if digest != "" {
+			if err := verifySHA256(zipPath, digest); err != nil {
+				return fmt.Errorf("%w: %w", ErrExtract, err)
+			}
+		}
+	} else {
+		m.Downloader.Progress = func(done, total int64) {
+			m.report(StepDownload, done, total)
+		}
+		if err := m.Downloader.Download(m.URL, zipPath, digest); err != nil {
+			return fmt.Errorf("%w: %w", ErrDownload, err)
+		}
+		defer os.Remove(zipPath)
+	}
+
+	// A verify step of 0 out of 0 says the archive is installed unverified, as allowed
+	if digest != "" {
+		m.report(StepVerify, 1, 1)
+	} else {
+		m.report(StepVerify, 0, 0)
+	}
+
+	if err := m.extract(zipPath); err != nil {
+		return fmt.Errorf("%w: %w", ErrExtract, err)
+	}
+	if err := m.Verify(); err != nil {
+		return fmt.Errorf("%w: %w", ErrExtract, err)
+	}
+
+	m.report(StepDone, 1, 1)
+	return nil
+}
+
+// downloadPath returns where Install downloads URL to. It is named after the archive so a
+// partial download is only ever resumed from the same release.
+func (m *Manager) downloadPath() string {
+	name := ToolsDirName + ".zip"
+	if u, err := url.Parse(m.URL); err == nil && strings.HasSuffix(u.Path, ".zip") {
+		name = path.Base(u.Path)
+	}
+	return filepath.Join(m.Dir, name)
+}
+
+// Source returns the local archive or URL Install uses
+func (m *Manager) Source() string {
+	if m.Archive != "" {
+		return m.Archive
+	}
+	return m.URL
+}
+
+// Repair makes a broken install work again: it restores the executable bits when only those
+// are missing and installs afresh otherwise
+func (m *Manager) Repair() error {
+	err := m.Verify()
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, ErrBroken) && runtime.GOOS != "windows" {
+		for _, path := range m.binaries() {
+			os.Chmod(path, 0755)
+		}
+		if m.Verify() == nil {
+			return nil
+		}
+	}
+	return m.Install()
+}
+
+// Uninstall removes the platform-tools folder and any leftover download
+func (m *Manager) Uninstall() error {
+	leftovers, _ := filepath.Glob(filepath.Join(m.Dir, ToolsDirName+"*.zip*"))
+	for _, leftover := range leftovers {
+		os.Remove(leftover)
+	}
+	return os.RemoveAll(m.ToolsDir())
+}
+
+// extract unpacks the archive into a temporary folder and swaps it in for the current install
+func (m *Manager) extract(zipPath string) error {
+	staging, err := os.MkdirTemp(m.Dir, "."+ToolsDirName+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := m.unzip(zipPath, staging); err != nil {
+		return err
+	}
+
+	unpacked := filepath.Join(staging, ToolsDirName)
+	if _, err := os.Stat(unpacked); err != nil {
+		return fmt.Errorf("archive has no %s folder", ToolsDirName)
+	}
+	if err := os.RemoveAll(m.ToolsDir()); err != nil {
+		return err
+	}
+	if err := os.Rename(unpacked, m.ToolsDir()); err != nil {
+		return err
+	}
+
+	// Archives without Unix permissions leave the tools non-executable
+	if runtime.GOOS != "windows" {
+		for _, path := range m.binaries() {
+			os.Chmod(path, 0755)
+		}
+	}
+	return nil
+}
+
+// unzip extracts every file of the archive below dest, keeping the archived permissions
+func (m *Manager) unzip(src, dest string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	total := int64(len(r.File))
+	for n, f := range r.File {
+		if err := unzipFile(f, dest); err != nil {
+			return err
+		}
+		m.report(StepExtract, int64(n+1), total)
+	}
+	return nil
+}
+
+// unzipFile writes one archive entry below dest; entries escaping dest are skipped
+func unzipFile(f *zip.File, dest string) error {
+	fpath := filepath.Join(dest, f.Name)
+	if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
+		return nil
+	}
+
+	if f.FileInfo().IsDir() {
+		return os.MkdirAll(fpath, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	outFile, err := os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode().Perm()|0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(outFile, rc); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
+
+// report passes a progress update to the Progress callback
+func (m *Manager) report(step Step, done, total int64) {
+	if m.Progress != nil {
+		m.Progress(Progress{Step: step, Done: done, Total: total})
+	}
+}
+
+// executable adds the platform's executable extension to a tool name
+func executable(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
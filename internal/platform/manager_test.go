@@ -0,0 +1,288 @@
+package platform
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// toolsArchive builds a platform-tools zip whose fastboot reports release
+func toolsArchive(t *testing.T, release string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	files := map[string]string{
+		ToolsDirName + "/fastboot": "#!/bin/sh\necho 'fastboot version " + release + "-12147458'\n",
+		ToolsDirName + "/adb":      "#!/bin/sh\n",
+	}
+	for name, content := range files {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(0755)
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testMirror serves archives by file name and records the names requested
+type testMirror struct {
+	*httptest.Server
+	mu        sync.Mutex
+	archives  map[string][]byte
+	requested []string
+}
+
+func newTestMirror(t *testing.T, archives map[string][]byte) *testMirror {
+	m := &testMirror{archives: archives}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.requested = append(m.requested, r.URL.Path)
+		m.mu.Unlock()
+
+		archive, ok := m.archives[filepath.Base(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// pinDigest lists the digest of archive under name in PinnedSHA256 for the test
+func pinDigest(t *testing.T, name string, archive []byte) {
+	t.Helper()
+	PinnedSHA256[name] = digestOf(archive)
+	t.Cleanup(func() { delete(PinnedSHA256, name) })
+}
+
+// testManager returns a manager in a temporary folder configured from src, downloading with client
+func testManager(t *testing.T, src Source, client *http.Client) *Manager {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake fastboot is a shell script")
+	}
+	t.Setenv("MUI_PLATFORM_TOOLS_SHA256", "")
+	t.Setenv("MUI_PLATFORM_TOOLS_MANIFEST", "")
+
+	manager := NewManager(t.TempDir())
+	manager.Downloader = &Downloader{Client: client, MaxSize: DefaultMaxSize}
+	if err := manager.Configure(src); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	return manager
+}
+
+func TestPrepareFromMirror(t *testing.T) {
+	archive := toolsArchive(t, "36.0.0")
+	mirror := newTestMirror(t, map[string][]byte{
+		ArchiveName(nil, runtime.GOOS): archive,
+	})
+	manager := testManager(t, Source{Mirror: mirror.URL + "/android/"}, mirror.Client())
+	t.Setenv("MUI_PLATFORM_TOOLS_SHA256", digestOf(archive))
+
+	found, err := manager.Prepare()
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	if found.Path != manager.FastbootPath() || found.Version != (Version{Major: 36}) {
+		t.Errorf("Prepare() = %+v", found)
+	}
+	if want := "/android/" + ArchiveName(nil, runtime.GOOS); len(mirror.requested) != 1 || mirror.requested[0] != want {
+		t.Errorf("requested %q, want %q", mirror.requested, want)
+	}
+
+	// A working install is kept
+	if _, err := manager.Prepare(); err != nil || len(mirror.requested) != 1 {
+		t.Errorf("second Prepare() error = %v, requests %q", err, mirror.requested)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(manager.Dir, "*.zip*")); len(leftovers) != 0 {
+		t.Errorf("downloads left behind: %q", leftovers)
+	}
+}
+
+func TestPreparePinned(t *testing.T) {
+	release := Version{Major: 35, Minor: 0, Patch: 2}
+	newer := Version{Major: 36}
+	archives := map[string][]byte{
+		ArchiveName(&release, runtime.GOOS): toolsArchive(t, "35.0.2"),
+		ArchiveName(&newer, runtime.GOOS):   toolsArchive(t, "36.0.0"),
+		ArchiveName(nil, runtime.GOOS):      toolsArchive(t, "36.0.0"),
+	}
+	for name, archive := range archives {
+		pinDigest(t, name, archive)
+	}
+	mirror := newTestMirror(t, archives)
+	manager := testManager(t, Source{Mirror: mirror.URL, Version: "r35.0.2"}, mirror.Client())
+
+	found, err := manager.Prepare()
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	if found.Version != release {
+		t.Errorf("Prepare() version = %s, want %s", found.Version, release)
+	}
+	if want := "/" + ArchiveName(&release, runtime.GOOS); len(mirror.requested) != 1 || mirror.requested[0] != want {
+		t.Errorf("requested %q, want %q", mirror.requested, want)
+	}
+
+	// Pinning another release replaces the install
+	other := testManager(t, Source{Mirror: mirror.URL, Version: "36.0.0"}, mirror.Client())
+	other.Dir = manager.Dir
+	if found, err := other.Prepare(); err != nil || found.Version != newer {
+		t.Errorf("Prepare() after changing the pin = %+v, %v", found, err)
+	}
+}
+
+func TestPreparePinnedMismatch(t *testing.T) {
+	release := Version{Major: 35, Minor: 0, Patch: 2}
+	// A mirror serving the wrong release under the pinned name, digest included
+	wrong := toolsArchive(t, "34.0.5")
+	pinDigest(t, ArchiveName(&release, runtime.GOOS), wrong)
+	mirror := newTestMirror(t, map[string][]byte{
+		ArchiveName(&release, runtime.GOOS): wrong,
+	})
+	manager := testManager(t, Source{Mirror: mirror.URL, Version: "35.0.2"}, mirror.Client())
+
+	if _, err := manager.Prepare(); !errors.Is(err, ErrFastbootPinned) {
+		t.Errorf("Prepare() error = %v, want %v", err, ErrFastbootPinned)
+	}
+}
+
+func TestPrepareFromLocalZip(t *testing.T) {
+	content := toolsArchive(t, "35.0.2")
+	archive := filepath.Join(t.TempDir(), "tools.zip")
+	if err := os.WriteFile(archive, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing may be downloaded
+	mirror := newTestMirror(t, nil)
+	manager := testManager(t, Source{Zip: archive, Mirror: mirror.URL}, mirror.Client())
+
+	if _, err := manager.Prepare(); !errors.Is(err, ErrNoChecksum) {
+		t.Fatalf("Prepare() without a digest error = %v, want %v", err, ErrNoChecksum)
+	}
+	t.Setenv("MUI_PLATFORM_TOOLS_SHA256", digestOf(content))
+
+	found, err := manager.Prepare()
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	if found.Version != (Version{Major: 35, Patch: 2}) || len(mirror.requested) != 0 {
+		t.Errorf("Prepare() = %+v, requests %q", found, mirror.requested)
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Errorf("local archive was removed: %v", err)
+	}
+
+	t.Setenv("MUI_PLATFORM_TOOLS_SHA256", digestOf([]byte("another archive")))
+	if err := manager.Install(); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Install() of a local zip with the wrong digest error = %v, want %v", err, ErrChecksum)
+	}
+}
+
+func TestPrepareMissingFromMirror(t *testing.T) {
+	release := Version{Major: 35, Minor: 0, Patch: 2}
+	pinDigest(t, ArchiveName(&release, runtime.GOOS), []byte("never served"))
+	mirror := newTestMirror(t, nil)
+	manager := testManager(t, Source{Mirror: mirror.URL, Version: "35.0.2"}, mirror.Client())
+
+	if _, err := manager.Prepare(); !errors.Is(err, ErrDownload) || !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("Prepare() error = %v, want %v and %v", err, ErrDownload, ErrHTTPStatus)
+	}
+	if err := manager.Verify(); !errors.Is(err, ErrNotInstalled) {
+		t.Errorf("Verify() after a failed install = %v, want %v", err, ErrNotInstalled)
+	}
+}
+
+func TestInstallNeedsDigest(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "tools.zip")
+	if err := os.WriteFile(archive, toolsArchive(t, "36.0.0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manager := testManager(t, Source{Zip: archive}, http.DefaultClient)
+	if err := manager.Install(); !errors.Is(err, ErrNoChecksum) {
+		t.Fatalf("Install() without a digest error = %v, want %v", err, ErrNoChecksum)
+	}
+
+	// Allowed explicitly, the archive is installed and the missing check reported
+	var steps []Progress
+	manager.Unverified = true
+	manager.Progress = func(p Progress) {
+		if p.Step == StepVerify {
+			steps = append(steps, p)
+		}
+	}
+	if err := manager.Install(); err != nil {
+		t.Fatalf("unverified Install() error = %v", err)
+	}
+	if len(steps) != 1 || steps[0].Total != 0 {
+		t.Errorf("verify steps = %+v, want one unverified step", steps)
+	}
+}
+
+func TestInstallAlwaysVerifiesPinnedAndMirrors(t *testing.T) {
+	release := Version{Major: 35, Minor: 0, Patch: 2}
+	mirror := newTestMirror(t, map[string][]byte{
+		ArchiveName(&release, runtime.GOOS): toolsArchive(t, "35.0.2"),
+		ArchiveName(nil, runtime.GOOS):      toolsArchive(t, "36.0.0"),
+	})
+
+	tests := []struct {
+		name string
+		src  Source
+	}{
+		{name: "pinned release", src: Source{Mirror: mirror.URL, Version: "35.0.2", Unverified: true}},
+		{name: "latest from a mirror", src: Source{Mirror: mirror.URL, Unverified: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := testManager(t, tt.src, mirror.Client())
+			if err := manager.Install(); !errors.Is(err, ErrNoChecksum) {
+				t.Errorf("Install() error = %v, want %v", err, ErrNoChecksum)
+			}
+			if err := manager.Verify(); !errors.Is(err, ErrNotInstalled) {
+				t.Errorf("Verify() after a refused install = %v, want %v", err, ErrNotInstalled)
+			}
+		})
+	}
+	if len(mirror.requested) != 0 {
+		t.Errorf("downloaded %q before refusing", mirror.requested)
+	}
+}
+
+func TestPrepareRejectsTamperedPinnedArchive(t *testing.T) {
+	release := Version{Major: 35, Minor: 0, Patch: 2}
+	name := ArchiveName(&release, runtime.GOOS)
+	genuine := toolsArchive(t, "35.0.2")
+	pinDigest(t, name, genuine)
+
+	// The mirror serves a modified archive that still reports the pinned release
+	tampered := append(bytes.Clone(genuine), "tampered"...)
+	mirror := newTestMirror(t, map[string][]byte{name: tampered})
+	manager := testManager(t, Source{Mirror: mirror.URL, Version: "35.0.2", Unverified: true}, mirror.Client())
+
+	if _, err := manager.Prepare(); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("Prepare() error = %v, want %v", err, ErrChecksum)
+	}
+	if err := manager.Verify(); !errors.Is(err, ErrNotInstalled) {
+		t.Errorf("Verify() after a tampered download = %v, want %v", err, ErrNotInstalled)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(manager.Dir, "*.zip*")); len(leftovers) != 0 {
+		t.Errorf("tampered download left behind: %q", leftovers)
+	}
+}
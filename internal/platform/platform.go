@@ -1,139 +1,108 @@
 package platform
 
 import (
-	"archive/zip"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
-	"runtime"
-	"strings"
 
-	"muitoolunlock/internal/colors"
+	"muitoolunlock/internal/report"
 )
 
-// Setup sets up platform-tools and returns the fastboot path
-func Setup() string {
-	fmt.Println(colors.Section("🔧 Platform Tools Setup"))
-	fmt.Println(colors.Package("Setting up platform-tools..."))
+// Setup errors; match them with errors.Is
+var (
+	ErrDownload = errors.New("failed to download platform-tools")
+	ErrExtract  = errors.New("failed to extract platform-tools")
+)
+
+// Setup finds the fastboot binary to use, installing the managed platform-tools from src when
+// neither explicit nor one on $PATH is usable, and returns its path
+func Setup(r report.Reporter, explicit string, src Source) (string, error) {
+	r.Section("🔧 Platform Tools Setup")
+	r.Progress("Looking for fastboot...")
 
-	baseDir, err := os.Getwd()
+	baseDir, err := DefaultDir()
 	if err != nil {
-		fmt.Println(colors.Error("Failed to get current directory"))
-		return ""
+		return "", err
 	}
-	platformToolsDir := filepath.Join(baseDir, "platform-tools")
-
-	// Check if platform-tools already exists
-	var fastbootName string
-	if runtime.GOOS == "windows" {
-		fastbootName = "fastboot.exe"
-	} else {
-		fastbootName = "fastboot"
+	manager := NewManager(baseDir)
+	if err := manager.Configure(src); err != nil {
+		return "", err
 	}
-
-	fastbootPath := filepath.Join(platformToolsDir, fastbootName)
-	if _, err := os.Stat(fastbootPath); err == nil {
-		fmt.Println(colors.Success("Platform-tools already available"))
-		return fastbootPath
+	if manager.Pinned != nil {
+		r.Field("Pinned release", manager.Pinned.String())
 	}
 
-	// Download platform-tools
-	osName := runtime.GOOS
-	if osName == "darwin" {
-		osName = "darwin"
+	found, err := Discover(explicit, manager)
+	if found != nil {
+		for _, skipped := range found.Skipped {
+			r.Warning(fmt.Sprintf("Skipping fastboot on $PATH: %v", skipped))
+		}
 	}
-
-	url := fmt.Sprintf("https://dl.google.com/android/repository/platform-tools-latest-%s.zip", osName)
-	zipPath := filepath.Join(baseDir, "platform-tools.zip")
-
-	fmt.Println(colors.Download("Downloading platform-tools..."))
-	fmt.Printf("%s %s\n", colors.Info("URL:"), colors.DimText(url))
-	if err := downloadFile(url, zipPath); err != nil {
-		fmt.Println(colors.Error(fmt.Sprintf("Failed to download platform-tools: %v", err)))
-		return ""
+	if err == nil {
+		reportFastboot(r, found)
+		return found.Path, nil
 	}
-
-	fmt.Println(colors.Package("Extracting platform-tools..."))
-	if err := unzipFile(zipPath, baseDir); err != nil {
-		fmt.Println(colors.Error(fmt.Sprintf("Failed to extract platform-tools: %v", err)))
-		os.Remove(zipPath)
-		return ""
+	if explicit != "" {
+		return "", err
 	}
 
-	// Clean up zip file
-	os.Remove(zipPath)
-	fmt.Println(colors.Info("Cleaned up temporary files"))
-
-	// Make fastboot executable on Unix systems
-	if runtime.GOOS != "windows" {
-		os.Chmod(fastbootPath, 0755)
-		fmt.Println(colors.Info("Set executable permissions"))
-	}
-
-	fmt.Println(colors.Success("Platform-tools setup completed"))
-	return fastbootPath
-}
-
-// downloadFile downloads a file from URL to filepath
-func downloadFile(url, filepath string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+	manager.Progress = ReportProgress(r)
+	switch {
+	case errors.Is(err, ErrNotInstalled):
+		if manager.Archive != "" {
+			r.Progress("Installing platform-tools from " + manager.Archive + "...")
+		} else {
+			r.Progress("Downloading platform-tools...")
+			r.Field("URL", manager.URL)
+		}
+	case errors.Is(err, ErrBroken):
+		r.Warning(fmt.Sprintf("Repairing platform-tools: %v", err))
+	default:
+		r.Warning(fmt.Sprintf("Reinstalling platform-tools: %v", err))
 	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(filepath)
+	managed, err := manager.Prepare()
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer out.Close()
+	r.Success("Platform-tools setup completed")
 
-	_, err = io.Copy(out, resp.Body)
-	return err
+	reportFastboot(r, managed)
+	return managed.Path, nil
 }
 
-// unzipFile extracts zip file to destination
-func unzipFile(src, dest string) error {
-	r, err := zip.OpenReader(src)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	for _, f := range r.File {
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		defer rc.Close()
-
-		fpath := filepath.Join(dest, f.Name)
-		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
-			continue
-		}
-
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, 0755)
-			continue
-		}
-
-		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
-			return err
-		}
-
-		outFile, err := os.Create(fpath)
-		if err != nil {
-			return err
-		}
-
-		_, err = io.Copy(outFile, rc)
-		outFile.Close()
+// reportFastboot reports which fastboot binary was chosen and why
+func reportFastboot(r report.Reporter, fastboot *Fastboot) {
+	r.Success(fmt.Sprintf("Using fastboot %s (%s)", fastboot.Version, fastboot.Reason))
+	r.Field("Fastboot", fastboot.Path)
+}
 
-		if err != nil {
-			return err
+// ReportProgress returns a Manager progress callback that reports each step and every
+// 10 percent of a download
+func ReportProgress(r report.Reporter) func(Progress) {
+	next := int64(10)
+	return func(p Progress) {
+		switch p.Step {
+		case StepDownload:
+			if p.Total <= 0 {
+				return
+			}
+			percent := p.Done * 100 / p.Total
+			if percent < next {
+				return
+			}
+			r.Info(fmt.Sprintf("Downloaded %d%% (%.1f of %.1f MB)", percent, float64(p.Done)/(1<<20), float64(p.Total)/(1<<20)))
+			next = percent/10*10 + 10
+		case StepVerify:
+			if p.Total == 0 {
+				r.Warning("Installing the archive without a SHA-256 check, as " + EnvUnverified + " allows")
+				return
+			}
+			r.Success("SHA-256 checksum verified")
+		case StepExtract:
+			if p.Done == 1 {
+				r.Progress("Extracting platform-tools...")
+			}
+		case StepDone:
+			r.Info("Set executable permissions and cleaned up temporary files")
 		}
 	}
-	return nil
 }
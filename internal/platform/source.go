@@ -0,0 +1,94 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRelease is returned for a pinned version that is not like 35.0.2
+var ErrInvalidRelease = errors.New("invalid platform-tools version")
+
+// DefaultMirror is Google's repository holding the platform-tools archives
+const DefaultMirror = "https://dl.google.com/android/repository"
+
+// Environment variables read by SourceFromEnv
+const (
+	EnvZip     = "MUI_PLATFORM_TOOLS_ZIP"
+	EnvMirror  = "MUI_PLATFORM_TOOLS_MIRROR"
+	EnvVersion = "MUI_PLATFORM_TOOLS_VERSION"
+	// EnvUnverified set to 1 or true allows installing an archive without a known SHA-256 digest
+	EnvUnverified = "MUI_PLATFORM_TOOLS_UNVERIFIED"
+)
+
+// Source says where the managed platform-tools are installed from
+type Source struct {
+	// Zip is a local archive to install from instead of downloading
+	Zip string
+	// Mirror is the base URL holding the archives; empty means DefaultMirror
+	Mirror string
+	// Version pins a release such as 35.0.2 so every machine runs the same fastboot;
+	// empty or "latest" installs the newest release
+	Version string
+	// Unverified allows installing the latest archive from Google or a local zip whose SHA-256
+	// digest is not known; pinned releases and mirrors are always verified
+	Unverified bool
+}
+
+// SourceFromEnv reads the source from MUI_PLATFORM_TOOLS_ZIP, MUI_PLATFORM_TOOLS_MIRROR,
+// MUI_PLATFORM_TOOLS_VERSION and MUI_PLATFORM_TOOLS_UNVERIFIED
+func SourceFromEnv() Source {
+	return Source{
+		Zip:        os.Getenv(EnvZip),
+		Mirror:     os.Getenv(EnvMirror),
+		Version:    os.Getenv(EnvVersion),
+		Unverified: UnverifiedFromEnv(),
+	}
+}
+
+// UnverifiedFromEnv reports whether MUI_PLATFORM_TOOLS_UNVERIFIED allows unverified archives
+func UnverifiedFromEnv() bool {
+	allow, _ := strconv.ParseBool(os.Getenv(EnvUnverified))
+	return allow
+}
+
+// releasePattern matches a pinned release, with or without the "r" of the archive names
+var releasePattern = regexp.MustCompile(`^r?(\d+)\.(\d+)\.(\d+)$`)
+
+// ParseRelease reads a pinned release such as "35.0.2" or "r35.0.2"
+func ParseRelease(release string) (Version, error) {
+	matches := releasePattern.FindStringSubmatch(strings.TrimSpace(release))
+	if matches == nil {
+		return Version{}, fmt.Errorf("%w %q, use a release such as 35.0.2", ErrInvalidRelease, release)
+	}
+
+	var parts [3]int
+	for i := range parts {
+		n, err := strconv.Atoi(matches[i+1])
+		if err != nil {
+			return Version{}, fmt.Errorf("%w %q", ErrInvalidRelease, release)
+		}
+		parts[i] = n
+	}
+	return Version{Major: parts[0], Minor: parts[1], Patch: parts[2]}, nil
+}
+
+// ArchiveName returns the file name of a platform-tools release for an operating system;
+// a nil release names the latest one
+func ArchiveName(release *Version, goos string) string {
+	if release == nil {
+		return fmt.Sprintf("platform-tools-latest-%s.zip", goos)
+	}
+	return fmt.Sprintf("platform-tools_r%s-%s.zip", release, goos)
+}
+
+// ArchiveURL returns the download URL of a release below a mirror; an empty mirror is DefaultMirror
+func ArchiveURL(mirror string, release *Version, goos string) string {
+	if mirror == "" {
+		mirror = DefaultMirror
+	}
+	return strings.TrimRight(mirror, "/") + "/" + ArchiveName(release, goos)
+}
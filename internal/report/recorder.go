@@ -0,0 +1,96 @@
+package report
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoAnswer is returned by Recorder.Secret when no scripted answer is left
+var ErrNoAnswer = errors.New("no scripted answer left")
+
+// Event is one message captured by a Recorder
+type Event struct {
+	// Kind is the Reporter method name: "section", "progress", "info", "success", "warning", "error", "field",
+	// or "confirm", "input", "secret" for prompts
+	Kind    string
+	Message string
+	Value   string
+}
+
+// Recorder captures every message and answers prompts from a script, for tests
+type Recorder struct {
+	mu      sync.Mutex
+	Events  []Event
+	answers []string
+}
+
+// NewRecorder creates a recorder that answers prompts with answers, in order.
+// Confirm treats "y" and "yes" as yes; an exhausted script answers with the defaults.
+func NewRecorder(answers ...string) *Recorder {
+	return &Recorder{answers: answers}
+}
+
+// Messages returns the messages recorded for kind, in order
+func (r *Recorder) Messages(kind string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var messages []string
+	for _, event := range r.Events {
+		if event.Kind == kind {
+			messages = append(messages, event.Message)
+		}
+	}
+	return messages
+}
+
+func (r *Recorder) Section(title string)      { r.record("section", title, "") }
+func (r *Recorder) Progress(message string)   { r.record("progress", message, "") }
+func (r *Recorder) Info(message string)       { r.record("info", message, "") }
+func (r *Recorder) Success(message string)    { r.record("success", message, "") }
+func (r *Recorder) Warning(message string)    { r.record("warning", message, "") }
+func (r *Recorder) Error(message string)      { r.record("error", message, "") }
+func (r *Recorder) Field(label, value string) { r.record("field", label, value) }
+
+func (r *Recorder) Confirm(question string, defaultYes bool) bool {
+	answer, ok := r.next()
+	r.record("confirm", question, answer)
+	if !ok || answer == "" {
+		return defaultYes
+	}
+	return answer == "y" || answer == "yes"
+}
+
+func (r *Recorder) Input(prompt string) string {
+	answer, _ := r.next()
+	r.record("input", prompt, answer)
+	return answer
+}
+
+func (r *Recorder) Secret(prompt string) (string, error) {
+	answer, ok := r.next()
+	r.record("secret", prompt, "")
+	if !ok {
+		return "", ErrNoAnswer
+	}
+	return answer, nil
+}
+
+// record appends one event
+func (r *Recorder) record(kind, message, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Events = append(r.Events, Event{Kind: kind, Message: message, Value: value})
+}
+
+// next pops the next scripted answer
+func (r *Recorder) next() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.answers) == 0 {
+		return "", false
+	}
+	answer := r.answers[0]
+	r.answers = r.answers[1:]
+	return answer, true
+}
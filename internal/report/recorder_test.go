@@ -0,0 +1,67 @@
+package report
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder("yes", "", "alice", "secret")
+	r.Section("Login")
+	r.Field("Account", "42")
+
+	if !r.Confirm("Continue?", false) {
+		t.Error("Confirm() with answer yes = false")
+	}
+	if !r.Confirm("Keep going?", true) {
+		t.Error("Confirm() with an empty answer ignored the default")
+	}
+	if got := r.Input("User: "); got != "alice" {
+		t.Errorf("Input() = %q, want alice", got)
+	}
+	if got, err := r.Secret("Password: "); err != nil || got != "secret" {
+		t.Errorf("Secret() = %q, %v", got, err)
+	}
+
+	// The script is exhausted
+	if r.Confirm("Again?", false) {
+		t.Error("Confirm() without answers ignored the default")
+	}
+	if _, err := r.Secret("Password: "); !errors.Is(err, ErrNoAnswer) {
+		t.Errorf("Secret() error = %v, want %v", err, ErrNoAnswer)
+	}
+
+	if got, want := r.Messages("confirm"), []string{"Continue?", "Keep going?", "Again?"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Messages(confirm) = %q, want %q", got, want)
+	}
+	if r.Events[1] != (Event{Kind: "field", Message: "Account", Value: "42"}) {
+		t.Errorf("field event = %+v", r.Events[1])
+	}
+	for _, event := range r.Events {
+		if event.Kind == "secret" && event.Value != "" {
+			t.Errorf("secret answer was recorded: %+v", event)
+		}
+	}
+}
+
+func TestUnattended(t *testing.T) {
+	recorder := NewRecorder("n")
+	u := &Unattended{Reporter: recorder, AssumeYes: true}
+
+	u.Warning("no terminal")
+	if !u.Confirm("Unlock?", false) {
+		t.Error("Confirm() with AssumeYes = false")
+	}
+	if u.Input("Account: ") != "" {
+		t.Error("Input() answered while unattended")
+	}
+	if _, err := u.Secret("Password: "); !errors.Is(err, ErrNeedsInput) {
+		t.Errorf("Secret() error = %v, want %v", err, ErrNeedsInput)
+	}
+
+	// Prompts never reach the wrapped reporter
+	if got := recorder.Messages("warning"); len(got) != 1 || len(recorder.Events) != 1 {
+		t.Errorf("recorded %+v, want only the warning", recorder.Events)
+	}
+}
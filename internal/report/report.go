@@ -0,0 +1,47 @@
+package report
+
+// Reporter receives progress and status messages from the internal packages
+type Reporter interface {
+	// Section starts a new titled block of output
+	Section(title string)
+	// Progress reports a step that is starting
+	Progress(message string)
+	Info(message string)
+	Success(message string)
+	Warning(message string)
+	Error(message string)
+	// Field reports a labelled value, such as a device property
+	Field(label, value string)
+}
+
+// Prompter asks the user for decisions and input
+type Prompter interface {
+	// Confirm asks a yes/no question; defaultYes is the answer when the user just presses Enter
+	Confirm(question string, defaultYes bool) bool
+	// Input asks for a line of text
+	Input(prompt string) string
+	// Secret asks for text without echoing it, such as a password
+	Secret(prompt string) (string, error)
+}
+
+// UI is a Reporter that can also prompt
+type UI interface {
+	Reporter
+	Prompter
+}
+
+// Discard is a UI that drops every message and answers every prompt with its default
+var Discard UI = discard{}
+
+type discard struct{}
+
+func (discard) Section(string)                {}
+func (discard) Progress(string)               {}
+func (discard) Info(string)                   {}
+func (discard) Success(string)                {}
+func (discard) Warning(string)                {}
+func (discard) Error(string)                  {}
+func (discard) Field(string, string)          {}
+func (discard) Confirm(_ string, d bool) bool { return d }
+func (discard) Input(string) string           { return "" }
+func (discard) Secret(string) (string, error) { return "", nil }
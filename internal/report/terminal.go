@@ -0,0 +1,97 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"muitoolunlock/internal/colors"
+
+	"golang.org/x/term"
+)
+
+// Terminal renders messages with the colors package and reads answers from a terminal
+type Terminal struct {
+	In  *bufio.Reader
+	Out io.Writer
+	// Fd is the file descriptor used to read secrets without echo
+	Fd int
+}
+
+// NewTerminal creates a terminal UI on stdin and stdout
+func NewTerminal() *Terminal {
+	return &Terminal{
+		In:  bufio.NewReader(os.Stdin),
+		Out: os.Stdout,
+		Fd:  int(os.Stdin.Fd()),
+	}
+}
+
+func (t *Terminal) Section(title string) {
+	fmt.Fprintln(t.Out, colors.Section(title))
+}
+
+func (t *Terminal) Progress(message string) {
+	fmt.Fprintln(t.Out, colors.Progress(message))
+}
+
+func (t *Terminal) Info(message string) {
+	fmt.Fprintln(t.Out, colors.Info(message))
+}
+
+func (t *Terminal) Success(message string) {
+	fmt.Fprintln(t.Out, colors.Success(message))
+}
+
+func (t *Terminal) Warning(message string) {
+	fmt.Fprintln(t.Out, colors.Warning(message))
+}
+
+func (t *Terminal) Error(message string) {
+	fmt.Fprintln(t.Out, colors.Error(message))
+}
+
+func (t *Terminal) Field(label, value string) {
+	fmt.Fprintf(t.Out, "%s %s\n", colors.Info(label+":"), colors.BoldText(value))
+}
+
+func (t *Terminal) Confirm(question string, defaultYes bool) bool {
+	choices := "(y/N)"
+	if defaultYes {
+		choices = "(Y/n)"
+	}
+	fmt.Fprint(t.Out, colors.Warning(question+" "+choices+": "))
+
+	answer := strings.ToLower(strings.TrimSpace(t.readLine()))
+	if answer == "" {
+		return defaultYes
+	}
+	return answer == "y" || answer == "yes"
+}
+
+func (t *Terminal) Input(prompt string) string {
+	fmt.Fprint(t.Out, colors.Prompt(prompt))
+	return strings.TrimSpace(t.readLine())
+}
+
+func (t *Terminal) Secret(prompt string) (string, error) {
+	fmt.Fprint(t.Out, colors.Key(prompt))
+	if !term.IsTerminal(t.Fd) {
+		return strings.TrimSpace(t.readLine()), nil
+	}
+
+	secret, err := term.ReadPassword(t.Fd)
+	fmt.Fprintln(t.Out)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// readLine reads one line, returning what was read before EOF
+func (t *Terminal) readLine() string {
+	line, _ := t.In.ReadString('\n')
+	return line
+}
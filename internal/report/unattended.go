@@ -0,0 +1,29 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNeedsInput is returned when an unattended run reaches a prompt only a person can answer
+var ErrNeedsInput = errors.New("input needed but running unattended")
+
+// Unattended is a UI for runs without a person at the terminal. Confirmations are answered
+// with AssumeYes; text prompts get no answer and secret prompts fail with ErrNeedsInput.
+type Unattended struct {
+	Reporter
+	AssumeYes bool
+}
+
+func (u *Unattended) Confirm(question string, _ bool) bool {
+	return u.AssumeYes
+}
+
+func (u *Unattended) Input(prompt string) string {
+	return ""
+}
+
+func (u *Unattended) Secret(prompt string) (string, error) {
+	return "", fmt.Errorf("%w: %s", ErrNeedsInput, strings.TrimRight(strings.TrimSpace(prompt), ":"))
+}
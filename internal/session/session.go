@@ -0,0 +1,116 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"muitoolunlock/internal/storage"
+	"muitoolunlock/internal/types"
+)
+
+// DefaultTTL is how long a serviceToken/ssecurity pair is reused before logging in again
+const DefaultTTL = 12 * time.Hour
+
+// ErrNoLogin is returned when a session must authenticate but no login function is set
+var ErrNoLogin = errors.New("session expired and no login method is available")
+
+// LoginFunc performs a fresh authentication for the account in data
+type LoginFunc func(data *types.UnlockData) (*types.XiaomiAuthResponse, error)
+
+// Session reuses the saved passToken, serviceToken and ssecurity while they are valid
+// and re-authenticates when they expire or the server rejects them
+type Session struct {
+	data  *types.UnlockData
+	login LoginFunc
+
+	// Now returns the current time
+	Now func() time.Time
+	// TTL is the lifetime given to new service tokens
+	TTL time.Duration
+	// Save persists data after the session changes
+	Save func(data *types.UnlockData) error
+}
+
+// New creates a session over the saved account data
+func New(data *types.UnlockData, login LoginFunc) *Session {
+	return &Session{
+		data:  data,
+		login: login,
+		Now:   time.Now,
+		TTL:   DefaultTTL,
+		Save:  storage.SaveUnlockData,
+	}
+}
+
+// Valid reports whether the saved service token can be reused
+func (s *Session) Valid() bool {
+	tokens := s.data.Session
+	return tokens != nil && tokens.ServiceToken != "" && tokens.SSecurity != "" &&
+		s.Now().Before(tokens.ExpiresAt)
+}
+
+// ExpiresAt returns when the saved service token expires (zero if there is none)
+func (s *Session) ExpiresAt() time.Time {
+	if s.data.Session == nil {
+		return time.Time{}
+	}
+	return s.data.Session.ExpiresAt
+}
+
+// AuthData returns credentials for the unlock API, reusing the saved session when valid.
+// reused reports whether no login was necessary.
+func (s *Session) AuthData() (authData *types.XiaomiAuthResponse, reused bool, err error) {
+	if s.Valid() {
+		return &types.XiaomiAuthResponse{
+			UserID:       s.data.UID,
+			PassToken:    s.data.PassToken,
+			SSecurity:    s.data.Session.SSecurity,
+			ServiceToken: s.data.Session.ServiceToken,
+		}, true, nil
+	}
+
+	authData, err = s.Refresh()
+	return authData, false, err
+}
+
+// Refresh discards the saved service token and authenticates again
+func (s *Session) Refresh() (*types.XiaomiAuthResponse, error) {
+	s.data.Session = nil
+	if s.login == nil {
+		return nil, ErrNoLogin
+	}
+
+	authData, err := s.login(s.data)
+	if err != nil {
+		// Keep the cleared tokens; the login error is the one worth reporting
+		_ = s.Save(s.data)
+		return nil, err
+	}
+
+	if err := s.Store(authData); err != nil {
+		return nil, err
+	}
+	return authData, nil
+}
+
+// Store records a fresh authentication result and persists it
+func (s *Session) Store(authData *types.XiaomiAuthResponse) error {
+	s.data.Login = "ok"
+	s.data.UID = authData.UserID
+	s.data.PassToken = authData.PassToken
+	s.data.Session = &types.SessionTokens{
+		ServiceToken: authData.ServiceToken,
+		SSecurity:    authData.SSecurity,
+		ExpiresAt:    s.Now().Add(s.TTL),
+	}
+	return s.Save(s.data)
+}
+
+// Logout clears every saved token so the next run logs in from scratch
+func (s *Session) Logout() error {
+	s.data.Login = ""
+	s.data.Password = ""
+	s.data.PassToken = ""
+	s.data.Session = nil
+	return s.Save(s.data)
+}
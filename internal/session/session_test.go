@@ -0,0 +1,175 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"muitoolunlock/internal/types"
+)
+
+var errRejected = errors.New("passToken rejected")
+
+// fakeLogin accepts passTokens listed in valid, falling back to a password login, and records
+// how each attempt was made
+type fakeLogin struct {
+	valid    map[string]bool
+	password error
+	attempts []string
+}
+
+func (f *fakeLogin) login(data *types.UnlockData) (*types.XiaomiAuthResponse, error) {
+	if data.PassToken != "" {
+		f.attempts = append(f.attempts, "passToken")
+		if f.valid[data.PassToken] {
+			return &types.XiaomiAuthResponse{UserID: "123", PassToken: data.PassToken, SSecurity: "ssecurity-2", ServiceToken: "service-2"}, nil
+		}
+		data.PassToken = ""
+	}
+
+	f.attempts = append(f.attempts, "password")
+	if f.password != nil {
+		return nil, f.password
+	}
+	return &types.XiaomiAuthResponse{UserID: "123", PassToken: "pass-token-3", SSecurity: "ssecurity-3", ServiceToken: "service-3"}, nil
+}
+
+// testSession returns a session at a fixed time whose saves are counted
+func testSession(data *types.UnlockData, login LoginFunc) (*Session, *time.Time, *int) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	saves := 0
+	s := New(data, login)
+	s.Now = func() time.Time { return now }
+	s.Save = func(*types.UnlockData) error {
+		saves++
+		return nil
+	}
+	return s, &now, &saves
+}
+
+func TestAuthDataReusesValidSession(t *testing.T) {
+	fake := &fakeLogin{}
+	data := &types.UnlockData{UID: "123", PassToken: "pass-token-1"}
+	s, now, saves := testSession(data, fake.login)
+	data.Session = &types.SessionTokens{ServiceToken: "service-1", SSecurity: "ssecurity-1", ExpiresAt: now.Add(time.Hour)}
+
+	authData, reused, err := s.AuthData()
+	if err != nil || !reused {
+		t.Fatalf("AuthData() reused = %v, error = %v", reused, err)
+	}
+	want := types.XiaomiAuthResponse{UserID: "123", PassToken: "pass-token-1", SSecurity: "ssecurity-1", ServiceToken: "service-1"}
+	if *authData != want {
+		t.Errorf("AuthData() = %+v, want %+v", authData, want)
+	}
+	if len(fake.attempts) != 0 || *saves != 0 {
+		t.Errorf("valid session logged in %q and saved %d times", fake.attempts, *saves)
+	}
+}
+
+func TestAuthDataExpiresAfterTTL(t *testing.T) {
+	fake := &fakeLogin{valid: map[string]bool{"pass-token-1": true}}
+	data := &types.UnlockData{UID: "123", PassToken: "pass-token-1"}
+	s, now, saves := testSession(data, fake.login)
+	s.TTL = time.Hour
+
+	// A fresh login is kept for the TTL
+	if _, reused, err := s.AuthData(); err != nil || reused {
+		t.Fatalf("first AuthData() reused = %v, error = %v", reused, err)
+	}
+	if got := s.ExpiresAt(); !got.Equal(now.Add(time.Hour)) {
+		t.Errorf("ExpiresAt() = %v, want an hour from now", got)
+	}
+	*now = now.Add(59 * time.Minute)
+	if _, reused, _ := s.AuthData(); !reused {
+		t.Error("session not reused before the TTL")
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if s.Valid() {
+		t.Error("session still valid after the TTL")
+	}
+	if _, reused, err := s.AuthData(); err != nil || reused {
+		t.Errorf("AuthData() after the TTL reused = %v, error = %v", reused, err)
+	}
+	if len(fake.attempts) != 2 || *saves != 2 {
+		t.Errorf("logins = %q, saves = %d, want two of each", fake.attempts, *saves)
+	}
+}
+
+func TestRefreshFallsBackToLogin(t *testing.T) {
+	tests := []struct {
+		name          string
+		passToken     string
+		password      error
+		wantAttempts  []string
+		wantErr       error
+		wantPassToken string
+	}{
+		{name: "passToken accepted", passToken: "pass-token-1", wantAttempts: []string{"passToken"}, wantPassToken: "pass-token-1"},
+		{name: "passToken rejected", passToken: "stale", wantAttempts: []string{"passToken", "password"}, wantPassToken: "pass-token-3"},
+		{name: "no passToken", wantAttempts: []string{"password"}, wantPassToken: "pass-token-3"},
+		{name: "password rejected", passToken: "stale", password: errRejected, wantAttempts: []string{"passToken", "password"}, wantErr: errRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeLogin{valid: map[string]bool{"pass-token-1": true}, password: tt.password}
+			data := &types.UnlockData{PassToken: tt.passToken}
+			s, now, saves := testSession(data, fake.login)
+			data.Session = &types.SessionTokens{ServiceToken: "old", SSecurity: "old", ExpiresAt: now.Add(time.Hour)}
+
+			authData, err := s.Refresh()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Refresh() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(fake.attempts) != len(tt.wantAttempts) {
+				t.Fatalf("attempts = %q, want %q", fake.attempts, tt.wantAttempts)
+			}
+			for i := range fake.attempts {
+				if fake.attempts[i] != tt.wantAttempts[i] {
+					t.Errorf("attempts = %q, want %q", fake.attempts, tt.wantAttempts)
+				}
+			}
+			if *saves != 1 {
+				t.Errorf("saved %d times, want once", *saves)
+			}
+
+			if tt.wantErr != nil {
+				// The rejected tokens are not kept
+				if authData != nil || data.Session != nil || data.PassToken != "" {
+					t.Errorf("after a failed login: %+v, data %+v", authData, data)
+				}
+				return
+			}
+			if data.PassToken != tt.wantPassToken || data.Session == nil || data.Session.ServiceToken != authData.ServiceToken || data.Login != "ok" {
+				t.Errorf("stored data = %+v, session %+v", data, data.Session)
+			}
+		})
+	}
+}
+
+func TestRefreshWithoutLogin(t *testing.T) {
+	s, _, _ := testSession(&types.UnlockData{}, nil)
+	if _, _, err := s.AuthData(); !errors.Is(err, ErrNoLogin) {
+		t.Errorf("AuthData() error = %v, want %v", err, ErrNoLogin)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	data := &types.UnlockData{User: "user", WbID: "wb_0123456789abcdef", Login: "ok", UID: "123", Password: "hunter2", PassToken: "pass-token"}
+	s, now, saves := testSession(data, nil)
+	data.Session = &types.SessionTokens{ServiceToken: "service", SSecurity: "ssecurity", ExpiresAt: now.Add(time.Hour)}
+
+	if err := s.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	if data.Login != "" || data.Password != "" || data.PassToken != "" || data.Session != nil || s.Valid() {
+		t.Errorf("data after Logout() = %+v", data)
+	}
+	if data.User != "user" || data.WbID == "" {
+		t.Errorf("Logout() forgot the account: %+v", data)
+	}
+	if *saves != 1 {
+		t.Errorf("saved %d times, want once", *saves)
+	}
+}
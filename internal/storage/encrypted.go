@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"muitoolunlock/internal/types"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// EncryptedFileName is the encrypted data file kept next to the legacy plaintext file
+const EncryptedFileName = "miunlockdata.enc"
+
+// Argon2id parameters for deriving the file key from the passphrase
+const (
+	kdfTime    = 3
+	kdfMemory  = 64 * 1024
+	kdfThreads = 4
+	kdfKeyLen  = 32
+	saltLen    = 16
+)
+
+// Encrypted store errors
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted data file")
+	ErrEmptyPassphrase = errors.New("passphrase must not be empty")
+)
+
+// envelope is the on-disk format of an encrypted data file
+type envelope struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	// Account names the account in the clear so profiles can be listed without the passphrase;
+	// it is authenticated along with the data
+	Account string `json:"account,omitempty"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// EncryptedFile stores unlock data encrypted with AES-256-GCM under an Argon2id-derived key
+type EncryptedFile struct {
+	Path       string
+	Passphrase []byte
+	// ForgetPassword drops the account password before saving so only the passToken is kept
+	ForgetPassword bool
+}
+
+// Load decrypts the file; a missing file yields empty data
+func (e *EncryptedFile) Load() (*types.UnlockData, error) {
+	raw, err := os.ReadFile(e.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &types.UnlockData{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := open(e.Passphrase, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.Path, err)
+	}
+
+	data := &types.UnlockData{}
+	if err := json.Unmarshal(plain, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Save encrypts data with a fresh salt and nonce and writes it with 0600 permissions
+func (e *EncryptedFile) Save(data *types.UnlockData) error {
+	stored := *data
+	if e.ForgetPassword {
+		stored.Password = ""
+	}
+
+	plain, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	raw, err := seal(e.Passphrase, plain, stored.User)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(e.Path, raw)
+}
+
+// seal encrypts plain into a JSON envelope with a fresh salt and nonce, naming account in the clear
+func seal(passphrase, plain []byte, account string) ([]byte, error) {
+	env := &envelope{
+		Version: 1,
+		KDF:     "argon2id",
+		Time:    kdfTime,
+		Memory:  kdfMemory,
+		Threads: kdfThreads,
+		Account: account,
+		Salt:    make([]byte, saltLen),
+	}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newCipher(passphrase, env)
+	if err != nil {
+		return nil, err
+	}
+	env.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Data = gcm.Seal(nil, env.Nonce, plain, []byte(env.Account))
+
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// open decrypts a JSON envelope produced by seal
+func open(passphrase, raw []byte) ([]byte, error) {
+	env := &envelope{}
+	if err := json.Unmarshal(raw, env); err != nil {
+		return nil, fmt.Errorf("invalid encrypted file: %w", err)
+	}
+	if env.Version != 1 || env.KDF != "argon2id" {
+		return nil, fmt.Errorf("unsupported encrypted file format %s v%d", env.KDF, env.Version)
+	}
+	// The parameters come from the file: never spend more than seal does on a crafted one
+	if env.Time < 1 || env.Time > kdfTime || env.Memory < 8*uint32(env.Threads) || env.Memory > kdfMemory ||
+		env.Threads < 1 || env.Threads > kdfThreads || len(env.Salt) != saltLen {
+		return nil, fmt.Errorf("invalid encrypted file: key derivation parameters t=%d m=%d p=%d out of range",
+			env.Time, env.Memory, env.Threads)
+	}
+
+	gcm, err := newCipher(passphrase, env)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plain, err := gcm.Open(nil, env.Nonce, env.Data, []byte(env.Account))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plain, nil
+}
+
+// encryptedAccount returns the account named in the clear by the encrypted file at path
+func encryptedAccount(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	env := &envelope{}
+	if err := json.Unmarshal(raw, env); err != nil {
+		return "", fmt.Errorf("invalid encrypted file: %w", err)
+	}
+	return env.Account, nil
+}
+
+// newCipher derives the file key for env and returns the AES-GCM AEAD
+func newCipher(passphrase []byte, env *envelope) (cipher.AEAD, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrEmptyPassphrase
+	}
+
+	key := argon2.IDKey(passphrase, env.Salt, env.Time, env.Memory, env.Threads, kdfKeyLen)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// MigratePlaintext moves a plaintext data file into dst and removes the plaintext copy.
+// It reports whether a migration took place.
+func MigratePlaintext(plainPath string, dst Backend) (bool, error) {
+	if _, err := os.Stat(plainPath); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	data, err := (&PlainFile{Path: plainPath}).Load()
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", plainPath, err)
+	}
+	if err := dst.Save(data); err != nil {
+		return false, fmt.Errorf("failed to write encrypted data: %w", err)
+	}
+
+	// Overwrite before removing so the password does not linger in the old file's blocks
+	if info, err := os.Stat(plainPath); err == nil {
+		os.WriteFile(plainPath, make([]byte, info.Size()), 0600)
+	}
+	if err := os.Remove(plainPath); err != nil {
+		return true, fmt.Errorf("encrypted copy written but failed to remove %s: %w", plainPath, err)
+	}
+
+	return true, nil
+}
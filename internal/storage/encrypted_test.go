@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"muitoolunlock/internal/types"
+)
+
+func TestEncryptedFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), EncryptedFileName)
+	store := &EncryptedFile{Path: path, Passphrase: []byte("correct horse")}
+	saved := &types.UnlockData{User: "user@example.com", UID: "123456", PassToken: "pass-token", WbID: "wb_0123456789abcdef"}
+
+	if err := store.Save(saved); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "pass-token") || strings.Contains(string(raw), "wb_0123456789abcdef") {
+		t.Errorf("encrypted file holds plaintext:\n%s", raw)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("encrypted file mode = %v, %v", info.Mode(), err)
+	}
+
+	loaded, err := (&EncryptedFile{Path: path, Passphrase: []byte("correct horse")}).Load()
+	if err != nil || *loaded != *saved {
+		t.Errorf("Load() = %+v, %v, want %+v", loaded, err, saved)
+	}
+
+	if data, err := (&EncryptedFile{Path: path, Passphrase: []byte("wrong horse")}).Load(); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Load() with the wrong passphrase = %+v, %v", data, err)
+	}
+	if _, err := (&EncryptedFile{Path: path}).Load(); !errors.Is(err, ErrEmptyPassphrase) {
+		t.Errorf("Load() without a passphrase error = %v, want %v", err, ErrEmptyPassphrase)
+	}
+	if data, err := (&EncryptedFile{Path: filepath.Join(t.TempDir(), "missing"), Passphrase: []byte("x")}).Load(); err != nil || *data != (types.UnlockData{}) {
+		t.Errorf("Load() of a missing file = %+v, %v", data, err)
+	}
+}
+
+func TestEncryptedFileForgetPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), EncryptedFileName)
+	store := &EncryptedFile{Path: path, Passphrase: []byte("passphrase"), ForgetPassword: true}
+
+	if err := store.Save(&types.UnlockData{User: "user", Password: "hunter2", PassToken: "pass-token"}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load()
+	if err != nil || loaded.Password != "" || loaded.PassToken != "pass-token" {
+		t.Errorf("Load() = %+v, %v, want the passToken without the password", loaded, err)
+	}
+}
+
+func TestOpenRejectsTamperedFiles(t *testing.T) {
+	sealed, err := seal([]byte("passphrase"), []byte(`{"user": "user"}`), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open([]byte("passphrase"), sealed); err != nil {
+		t.Fatalf("open() of an untouched file error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(env *envelope)
+	}{
+		{name: "flipped ciphertext bit", tamper: func(env *envelope) { env.Data[0] ^= 1 }},
+		{name: "flipped tag bit", tamper: func(env *envelope) { env.Data[len(env.Data)-1] ^= 1 }},
+		{name: "other salt", tamper: func(env *envelope) { env.Salt[0] ^= 1 }},
+		{name: "other nonce", tamper: func(env *envelope) { env.Nonce[0] ^= 1 }},
+		{name: "short nonce", tamper: func(env *envelope) { env.Nonce = env.Nonce[:4] }},
+		{name: "huge memory", tamper: func(env *envelope) { env.Memory = 1 << 31 }},
+		{name: "many passes", tamper: func(env *envelope) { env.Time = 1 << 20 }},
+		{name: "no threads", tamper: func(env *envelope) { env.Threads = 0 }},
+		{name: "too many threads", tamper: func(env *envelope) { env.Threads = 255 }},
+		{name: "short salt", tamper: func(env *envelope) { env.Salt = env.Salt[:1] }},
+		{name: "other account", tamper: func(env *envelope) { env.Account = "someone@example.com" }},
+		{name: "unknown kdf", tamper: func(env *envelope) { env.KDF = "scrypt" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &envelope{}
+			if err := json.Unmarshal(sealed, env); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(env)
+			raw, err := json.Marshal(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if plain, err := open([]byte("passphrase"), raw); err == nil {
+				t.Errorf("open() = %q, want an error", plain)
+			}
+		})
+	}
+
+	if _, err := open([]byte("passphrase"), []byte("not json")); err == nil {
+		t.Error("open() of garbage succeeded")
+	}
+}
+
+func TestMigratePlaintext(t *testing.T) {
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, PlainFileName)
+	legacy := `{"user": "user@example.com", "pwd": "hunter2", "pass_token": "pass-token"}`
+	if err := os.WriteFile(plainPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := &EncryptedFile{Path: filepath.Join(dir, EncryptedFileName), Passphrase: []byte("passphrase"), ForgetPassword: true}
+
+	migrated, err := MigratePlaintext(plainPath, store)
+	if err != nil || !migrated {
+		t.Fatalf("MigratePlaintext() = %v, %v", migrated, err)
+	}
+	if _, err := os.Stat(plainPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("plaintext file still exists: %v", err)
+	}
+	data, err := store.Load()
+	if err != nil || data.User != "user@example.com" || data.PassToken != "pass-token" || data.Password != "" {
+		t.Errorf("migrated data = %+v, %v", data, err)
+	}
+
+	// Nothing left to migrate
+	if migrated, err := MigratePlaintext(plainPath, store); err != nil || migrated {
+		t.Errorf("second MigratePlaintext() = %v, %v", migrated, err)
+	}
+}
+
+func TestMigratePlaintextKeepsUnreadableFile(t *testing.T) {
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, PlainFileName)
+	if err := os.WriteFile(plainPath, []byte(`{"user": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := &EncryptedFile{Path: filepath.Join(dir, EncryptedFileName), Passphrase: []byte("passphrase")}
+
+	if migrated, err := MigratePlaintext(plainPath, store); err == nil || migrated {
+		t.Errorf("MigratePlaintext() of a corrupt file = %v, %v", migrated, err)
+	}
+	if _, err := os.Stat(plainPath); err != nil {
+		t.Errorf("corrupt plaintext file removed: %v", err)
+	}
+}
+
+func TestPlainFileNeverWritesPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), PlainFileName)
+	store := &PlainFile{Path: path}
+	data := &types.UnlockData{User: "user", Password: "hunter2"}
+
+	if err := store.Save(data); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "hunter2") {
+		t.Errorf("plaintext file holds the password:\n%s", raw)
+	}
+	if data.Password != "hunter2" {
+		t.Errorf("Save() changed the caller's data: %+v", data)
+	}
+}
@@ -0,0 +1,187 @@
+//go:build linux
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Secret Service D-Bus names
+const (
+	secretServiceName   = "org.freedesktop.secrets"
+	secretServicePath   = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretDefaultAlias  = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	secretServiceIface  = "org.freedesktop.Secret.Service"
+	secretCollectionIfc = "org.freedesktop.Secret.Collection"
+	secretItemIface     = "org.freedesktop.Secret.Item"
+	secretPromptIface   = "org.freedesktop.Secret.Prompt"
+	secretApplication   = "mui-tool-unlock"
+)
+
+// noPrompt is returned by Secret Service calls that completed without user interaction
+const noPrompt = dbus.ObjectPath("/")
+
+// dbusSecret mirrors the Secret Service (oayays) secret struct
+type dbusSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// Keyring stores secrets in the freedesktop Secret Service (GNOME Keyring, KWallet)
+type Keyring struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+// OpenKeyring connects to the Secret Service on the user's session bus
+func OpenKeyring() (*Keyring, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyringUnavailable, err)
+	}
+	return NewKeyring(conn)
+}
+
+// NewKeyring opens a plain Secret Service session on conn, e.g. a private test bus
+func NewKeyring(conn *dbus.Conn) (*Keyring, error) {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyringUnavailable, err)
+	}
+
+	return &Keyring{conn: conn, session: session}, nil
+}
+
+// Get returns the secret or ErrSecretNotFound
+func (k *Keyring) Get(account, key string) (string, error) {
+	item, err := k.find(account, key)
+	if err != nil {
+		return "", err
+	}
+
+	var secret dbusSecret
+	if err := k.conn.Object(secretServiceName, item).
+		Call(secretItemIface+".GetSecret", 0, k.session).Store(&secret); err != nil {
+		return "", fmt.Errorf("failed to read keyring secret: %w", err)
+	}
+	return string(secret.Value), nil
+}
+
+// Set creates or replaces the secret in the default collection
+func (k *Keyring) Set(account, key, value string) error {
+	properties := map[string]dbus.Variant{
+		secretItemIface + ".Label":      dbus.MakeVariant("MUI Tool Unlock " + key + " (" + account + ")"),
+		secretItemIface + ".Attributes": dbus.MakeVariant(attributes(account, key)),
+	}
+	secret := dbusSecret{
+		Session:     k.session,
+		Value:       []byte(value),
+		ContentType: "text/plain",
+	}
+
+	var item, prompt dbus.ObjectPath
+	if err := k.conn.Object(secretServiceName, secretDefaultAlias).
+		Call(secretCollectionIfc+".CreateItem", 0, properties, secret, true).
+		Store(&item, &prompt); err != nil {
+		return fmt.Errorf("failed to write keyring secret: %w", err)
+	}
+	return k.prompt(prompt)
+}
+
+// Delete removes the secret; deleting a missing secret is not an error
+func (k *Keyring) Delete(account, key string) error {
+	item, err := k.find(account, key)
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var prompt dbus.ObjectPath
+	if err := k.conn.Object(secretServiceName, item).
+		Call(secretItemIface+".Delete", 0).Store(&prompt); err != nil {
+		return fmt.Errorf("failed to delete keyring secret: %w", err)
+	}
+	return k.prompt(prompt)
+}
+
+// find locates the item for account/key, unlocking it if necessary
+func (k *Keyring) find(account, key string) (dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	if err := k.conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceIface+".SearchItems", 0, attributes(account, key)).
+		Store(&unlocked, &locked); err != nil {
+		return "", fmt.Errorf("failed to search keyring: %w", err)
+	}
+
+	if len(unlocked) > 0 {
+		return unlocked[0], nil
+	}
+	if len(locked) == 0 {
+		return "", ErrSecretNotFound
+	}
+
+	var prompt dbus.ObjectPath
+	if err := k.conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceIface+".Unlock", 0, locked[:1]).
+		Store(&unlocked, &prompt); err != nil {
+		return "", fmt.Errorf("failed to unlock keyring: %w", err)
+	}
+	if err := k.prompt(prompt); err != nil {
+		return "", err
+	}
+	return locked[0], nil
+}
+
+// prompt runs a Secret Service prompt (e.g. keyring unlock dialog) and waits for completion
+func (k *Keyring) prompt(path dbus.ObjectPath) error {
+	if path == "" || path == noPrompt {
+		return nil
+	}
+
+	signals := make(chan *dbus.Signal, 1)
+	k.conn.Signal(signals)
+	defer k.conn.RemoveSignal(signals)
+
+	match := []dbus.MatchOption{dbus.WithMatchObjectPath(path), dbus.WithMatchInterface(secretPromptIface)}
+	if err := k.conn.AddMatchSignal(match...); err != nil {
+		return err
+	}
+	defer k.conn.RemoveMatchSignal(match...)
+
+	if err := k.conn.Object(secretServiceName, path).Call(secretPromptIface+".Prompt", 0, "").Err; err != nil {
+		return fmt.Errorf("keyring prompt failed: %w", err)
+	}
+
+	for signal := range signals {
+		if signal.Path != path || signal.Name != secretPromptIface+".Completed" {
+			continue
+		}
+		if len(signal.Body) > 0 {
+			if dismissed, ok := signal.Body[0].(bool); ok && dismissed {
+				return errors.New("keyring prompt dismissed")
+			}
+		}
+		return nil
+	}
+	return errors.New("keyring connection closed")
+}
+
+// attributes identifies this tool's secrets in the keyring
+func attributes(account, key string) map[string]string {
+	return map[string]string{
+		"application": secretApplication,
+		"account":     account,
+		"key":         key,
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package storage
+
+// Keyring is only implemented for the Linux Secret Service
+type Keyring struct{}
+
+// OpenKeyring reports that no keyring is available on this platform
+func OpenKeyring() (*Keyring, error) {
+	return nil, ErrKeyringUnavailable
+}
+
+// Get is never reached since OpenKeyring fails
+func (k *Keyring) Get(account, key string) (string, error) {
+	return "", ErrKeyringUnavailable
+}
+
+// Set is never reached since OpenKeyring fails
+func (k *Keyring) Set(account, key, value string) error {
+	return ErrKeyringUnavailable
+}
+
+// Delete is never reached since OpenKeyring fails
+func (k *Keyring) Delete(account, key string) error {
+	return ErrKeyringUnavailable
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"muitoolunlock/internal/paths"
+)
+
+// profileIndexName is the file in the config directory listing profiles and the default one
+const profileIndexName = "profiles.json"
+
+// profilesDirName is the folder in the state directory holding one folder per profile
+const profilesDirName = "profiles"
+
+// Profile errors
+var (
+	ErrInvalidProfileName = errors.New("profile names may only contain letters, digits, '.', '_' and '-'")
+	ErrProfileExists      = errors.New("profile already exists")
+	ErrProfileNotFound    = errors.New("profile not found")
+)
+
+// profileNamePattern restricts profile names to safe directory names
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// dataDir overrides the directory holding the data files (empty means the state directory)
+var dataDir string
+
+// profileIndex is the on-disk profile list
+type profileIndex struct {
+	Default  string   `json:"default"`
+	Profiles []string `json:"profiles"`
+}
+
+// DataDir returns the directory holding the account data files: the selected profile's, or
+// the state directory. It falls back to the working directory when there is no home directory.
+func DataDir() string {
+	if dataDir != "" {
+		return dataDir
+	}
+	if stateDir, err := paths.StateDir(); err == nil {
+		return stateDir
+	}
+	if baseDir, err := os.Getwd(); err == nil {
+		return baseDir
+	}
+	return "."
+}
+
+// ProfilesDir returns the per-user directory holding the account profiles' data
+func ProfilesDir() (string, error) {
+	stateDir, err := paths.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, profilesDirName), nil
+}
+
+// profileIndexPath returns where profiles.json is kept
+func profileIndexPath() (string, error) {
+	configDir, err := paths.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, profileIndexName), nil
+}
+
+// MigrationMoves lists the files older versions kept elsewhere: the data files in workDir and
+// the profiles, list included, in the platform's config folder
+func MigrationMoves(workDir string) ([]paths.Move, error) {
+	stateDir, err := paths.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	indexPath, err := profileIndexPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var moves []paths.Move
+	for _, name := range []string{PlainFileName, EncryptedFileName, SecretsFileName} {
+		moves = append(moves, paths.Move{From: filepath.Join(workDir, name), To: filepath.Join(stateDir, name)})
+	}
+
+	if configDir, err := os.UserConfigDir(); err == nil {
+		profilesDir := filepath.Join(stateDir, profilesDirName)
+		moves = append(moves,
+			paths.Move{From: filepath.Join(configDir, paths.AppName, profilesDirName), To: profilesDir},
+			paths.Move{From: filepath.Join(profilesDir, profileIndexName), To: indexPath},
+		)
+	}
+	return moves, nil
+}
+
+// ListProfiles returns the sorted profile names and the default profile
+func ListProfiles() ([]string, string, error) {
+	index, err := loadProfileIndex()
+	if err != nil {
+		return nil, "", err
+	}
+	return index.Profiles, index.Default, nil
+}
+
+// AddProfile creates an empty profile; the first profile becomes the default
+func AddProfile(name string) error {
+	if !profileNamePattern.MatchString(name) {
+		return ErrInvalidProfileName
+	}
+
+	index, err := loadProfileIndex()
+	if err != nil {
+		return err
+	}
+	if index.has(name) {
+		return fmt.Errorf("%w: %s", ErrProfileExists, name)
+	}
+
+	dir, err := profileDir(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	index.Profiles = append(index.Profiles, name)
+	sort.Strings(index.Profiles)
+	if index.Default == "" {
+		index.Default = name
+	}
+	return saveProfileIndex(index)
+}
+
+// RemoveProfile deletes a profile and all of its saved data
+func RemoveProfile(name string) error {
+	index, err := loadProfileIndex()
+	if err != nil {
+		return err
+	}
+	if !index.has(name) {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+
+	dir, err := profileDir(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	kept := index.Profiles[:0]
+	for _, profile := range index.Profiles {
+		if profile != name {
+			kept = append(kept, profile)
+		}
+	}
+	index.Profiles = kept
+	if index.Default == name {
+		index.Default = ""
+		if len(kept) > 0 {
+			index.Default = kept[0]
+		}
+	}
+	return saveProfileIndex(index)
+}
+
+// SetDefaultProfile selects the profile used when none is given
+func SetDefaultProfile(name string) error {
+	index, err := loadProfileIndex()
+	if err != nil {
+		return err
+	}
+	if !index.has(name) {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+
+	index.Default = name
+	return saveProfileIndex(index)
+}
+
+// UseProfile points the data directory and default backend at the profile's directory.
+// An empty name selects the default profile, if any; it returns the profile in use.
+func UseProfile(name string) (string, error) {
+	index, err := loadProfileIndex()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = index.Default
+		if name == "" {
+			return "", nil
+		}
+	}
+	if !index.has(name) {
+		return "", fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+
+	dir, err := profileDir(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	dataDir = dir
+	backend = nil
+	return name, nil
+}
+
+// ProfileAccount returns the account a profile is signed in with, without switching to it or
+// needing its passphrase; "" means none yet
+func ProfileAccount(name string) (string, error) {
+	dir, err := profileDir(name)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := (&PlainFile{Path: filepath.Join(dir, PlainFileName)}).Load()
+	if err != nil {
+		return "", err
+	}
+	if data.User != "" {
+		return data.User, nil
+	}
+
+	// Encrypted profiles name their account in the clear
+	account, err := encryptedAccount(filepath.Join(dir, EncryptedFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return account, err
+}
+
+// profileDir returns the directory holding a profile's data files
+func profileDir(name string) (string, error) {
+	if !profileNamePattern.MatchString(name) {
+		return "", ErrInvalidProfileName
+	}
+
+	dir, err := ProfilesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// has reports whether the index lists name
+func (p *profileIndex) has(name string) bool {
+	for _, profile := range p.Profiles {
+		if profile == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadProfileIndex reads profiles.json; a missing file yields an empty index
+func loadProfileIndex() (*profileIndex, error) {
+	indexPath, err := profileIndexPath()
+	if err != nil {
+		return nil, err
+	}
+
+	index := &profileIndex{}
+	raw, err := os.ReadFile(indexPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// saveProfileIndex writes profiles.json
+func saveProfileIndex(index *profileIndex) error {
+	indexPath, err := profileIndexPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0700); err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(indexPath, raw)
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"muitoolunlock/internal/paths"
+	"muitoolunlock/internal/types"
+)
+
+// tempDirs points the config and state directories at a temporary folder
+func tempDirs(t *testing.T) {
+	t.Helper()
+	root := t.TempDir()
+	paths.SetConfigDir(filepath.Join(root, "config"))
+	paths.SetStateDir(filepath.Join(root, "state"))
+	t.Cleanup(func() {
+		paths.SetConfigDir("")
+		paths.SetStateDir("")
+		dataDir = ""
+		SetBackend(nil)
+	})
+}
+
+func TestProfiles(t *testing.T) {
+	tempDirs(t)
+
+	if profiles, defaultProfile, err := ListProfiles(); err != nil || len(profiles) != 0 || defaultProfile != "" {
+		t.Fatalf("ListProfiles() = %q, %q, %v, want nothing", profiles, defaultProfile, err)
+	}
+
+	for _, name := range []string{"work", "home", "test-2.old"} {
+		if err := AddProfile(name); err != nil {
+			t.Fatalf("AddProfile(%q) error = %v", name, err)
+		}
+	}
+	if err := AddProfile("home"); !errors.Is(err, ErrProfileExists) {
+		t.Errorf("AddProfile() of an existing profile error = %v, want %v", err, ErrProfileExists)
+	}
+
+	profiles, defaultProfile, err := ListProfiles()
+	if err != nil || !reflect.DeepEqual(profiles, []string{"home", "test-2.old", "work"}) || defaultProfile != "work" {
+		t.Fatalf("ListProfiles() = %q, %q, %v", profiles, defaultProfile, err)
+	}
+
+	if err := SetDefaultProfile("home"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDefaultProfile("missing"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("SetDefaultProfile() of a missing profile error = %v", err)
+	}
+
+	// The default profile is used when none is named
+	name, err := UseProfile("")
+	if err != nil || name != "home" {
+		t.Fatalf("UseProfile(\"\") = %q, %v", name, err)
+	}
+	if err := SaveUnlockData(&types.UnlockData{User: "home@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := profileDir("home")
+	if _, err := os.Stat(filepath.Join(dir, PlainFileName)); err != nil {
+		t.Errorf("profile data not saved in its folder: %v", err)
+	}
+
+	if err := RemoveProfile("home"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("removed profile's folder still exists: %v", err)
+	}
+	profiles, defaultProfile, _ = ListProfiles()
+	if !reflect.DeepEqual(profiles, []string{"test-2.old", "work"}) || defaultProfile != "test-2.old" {
+		t.Errorf("after RemoveProfile() = %q, default %q", profiles, defaultProfile)
+	}
+	if err := RemoveProfile("home"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("second RemoveProfile() error = %v, want %v", err, ErrProfileNotFound)
+	}
+	if _, err := UseProfile("home"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("UseProfile() of a removed profile error = %v, want %v", err, ErrProfileNotFound)
+	}
+}
+
+func TestProfileNames(t *testing.T) {
+	tempDirs(t)
+
+	for _, name := range []string{"", ".", "..", ".hidden", "-flag", "a/b", `a\b`, "../escape", "with space", "ünicode"} {
+		if err := AddProfile(name); !errors.Is(err, ErrInvalidProfileName) {
+			t.Errorf("AddProfile(%q) error = %v, want %v", name, err, ErrInvalidProfileName)
+		}
+		if _, err := ProfileAccount(name); !errors.Is(err, ErrInvalidProfileName) {
+			t.Errorf("ProfileAccount(%q) error = %v, want %v", name, err, ErrInvalidProfileName)
+		}
+	}
+	for _, name := range []string{"a", "Work", "team_1", "v2.0-old"} {
+		if err := AddProfile(name); err != nil {
+			t.Errorf("AddProfile(%q) error = %v", name, err)
+		}
+	}
+}
+
+func TestProfileAccount(t *testing.T) {
+	tempDirs(t)
+	for _, name := range []string{"plain", "encrypted", "keyring", "empty"} {
+		if err := AddProfile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := func(name string) string {
+		dir, err := profileDir(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	saves := map[string]Backend{
+		"plain":     &PlainFile{Path: filepath.Join(dir("plain"), PlainFileName)},
+		"encrypted": &EncryptedFile{Path: filepath.Join(dir("encrypted"), EncryptedFileName), Passphrase: []byte("passphrase")},
+		"keyring": &SecretBackend{
+			Data:    &PlainFile{Path: filepath.Join(dir("keyring"), PlainFileName)},
+			Secrets: NewMemorySecrets(),
+		},
+	}
+	for name, store := range saves {
+		if err := store.Save(&types.UnlockData{User: name + "@example.com", PassToken: "pass-token"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"plain", "encrypted", "keyring", "empty"} {
+		want := name + "@example.com"
+		if name == "empty" {
+			want = ""
+		}
+		if account, err := ProfileAccount(name); err != nil || account != want {
+			t.Errorf("ProfileAccount(%q) = %q, %v, want %q", name, account, err, want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"muitoolunlock/internal/types"
+)
+
+// SecretsFileName is the file fallback for secrets when no keyring is available
+const SecretsFileName = "misecrets.json"
+
+// Secret keys stored per account
+const (
+	SecretPassToken    = "passToken"
+	SecretServiceToken = "serviceToken"
+	SecretSSecurity    = "ssecurity"
+)
+
+// Secret backend names accepted by OpenSecretStore
+const (
+	SecretBackendAuto    = "auto"
+	SecretBackendKeyring = "keyring"
+	SecretBackendFile    = "file"
+)
+
+// Secret store errors
+var (
+	ErrSecretNotFound       = errors.New("secret not found")
+	ErrKeyringUnavailable   = errors.New("secret service keyring is not available")
+	ErrUnknownSecretBackend = errors.New("unknown secret backend")
+	ErrPlaintextSecrets     = errors.New("no keyring is available and the secrets file would not be encrypted")
+)
+
+// SecretStore keeps tokens outside the account data file
+type SecretStore interface {
+	Get(account, key string) (string, error)
+	Set(account, key, value string) error
+	Delete(account, key string) error
+}
+
+// OpenSecretStore selects a secret backend by name. "auto" prefers the OS keyring and falls
+// back to an encrypted file at fallbackPath; without a passphrase it fails with
+// ErrPlaintextSecrets rather than writing tokens in the clear. The chosen backend name is
+// returned alongside the store.
+func OpenSecretStore(name, fallbackPath string, passphrase []byte) (SecretStore, string, error) {
+	switch name {
+	case SecretBackendKeyring:
+		store, err := OpenKeyring()
+		if err != nil {
+			return nil, "", err
+		}
+		return store, SecretBackendKeyring, nil
+	case SecretBackendFile:
+		return &FileSecrets{Path: fallbackPath, Passphrase: passphrase}, SecretBackendFile, nil
+	case "", SecretBackendAuto:
+		store, err := OpenKeyring()
+		if err == nil {
+			return store, SecretBackendKeyring, nil
+		}
+		if len(passphrase) == 0 {
+			return nil, "", fmt.Errorf("%w: %v", ErrPlaintextSecrets, err)
+		}
+		return &FileSecrets{Path: fallbackPath, Passphrase: passphrase}, SecretBackendFile, nil
+	}
+
+	return nil, "", fmt.Errorf("%w: %q", ErrUnknownSecretBackend, name)
+}
+
+// MemorySecrets is an in-memory SecretStore, useful as a fake in tests
+type MemorySecrets struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+// NewMemorySecrets creates an empty in-memory store
+func NewMemorySecrets() *MemorySecrets {
+	return &MemorySecrets{secrets: map[string]string{}}
+}
+
+// Get returns the secret or ErrSecretNotFound
+func (m *MemorySecrets) Get(account, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.secrets[account+"/"+key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// Set stores the secret
+func (m *MemorySecrets) Set(account, key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.secrets[account+"/"+key] = value
+	return nil
+}
+
+// Delete removes the secret; deleting a missing secret is not an error
+func (m *MemorySecrets) Delete(account, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.secrets, account+"/"+key)
+	return nil
+}
+
+// FileSecrets is the file fallback: a 0600 JSON map, sealed when Passphrase is set
+type FileSecrets struct {
+	Path       string
+	Passphrase []byte
+}
+
+// Get returns the secret or ErrSecretNotFound
+func (f *FileSecrets) Get(account, key string) (string, error) {
+	secrets, err := f.read()
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := secrets[account+"/"+key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// Set stores the secret
+func (f *FileSecrets) Set(account, key, value string) error {
+	secrets, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	secrets[account+"/"+key] = value
+	return f.write(secrets)
+}
+
+// Delete removes the secret; deleting a missing secret is not an error
+func (f *FileSecrets) Delete(account, key string) error {
+	secrets, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[account+"/"+key]; !ok {
+		return nil
+	}
+
+	delete(secrets, account+"/"+key)
+	return f.write(secrets)
+}
+
+// read loads the secret map; a missing file yields an empty map
+func (f *FileSecrets) read() (map[string]string, error) {
+	secrets := map[string]string{}
+	raw, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f.Passphrase) > 0 {
+		if raw, err = open(f.Passphrase, raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Path, err)
+		}
+	}
+	if err := json.Unmarshal(raw, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// write saves the secret map with 0600 permissions
+func (f *FileSecrets) write(secrets map[string]string) error {
+	raw, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if len(f.Passphrase) > 0 {
+		if raw, err = seal(f.Passphrase, raw, ""); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(f.Path, raw)
+}
+
+// SecretBackend wraps a data Backend and moves the passToken, serviceToken and ssecurity into
+// a SecretStore, so neither the tokens nor the password are written to the data file
+type SecretBackend struct {
+	Data    Backend
+	Secrets SecretStore
+}
+
+// Load reads the data file and fills in the tokens from the secret store
+func (s *SecretBackend) Load() (*types.UnlockData, error) {
+	data, err := s.Data.Load()
+	if err != nil {
+		return nil, err
+	}
+	if data.User == "" {
+		return data, nil
+	}
+
+	if data.PassToken, err = s.get(data.User, SecretPassToken, data.PassToken); err != nil {
+		return nil, err
+	}
+	if data.Session != nil {
+		if data.Session.ServiceToken, err = s.get(data.User, SecretServiceToken, data.Session.ServiceToken); err != nil {
+			return nil, err
+		}
+		if data.Session.SSecurity, err = s.get(data.User, SecretSSecurity, data.Session.SSecurity); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Save stores the tokens as secrets and writes the rest without password or tokens
+func (s *SecretBackend) Save(data *types.UnlockData) error {
+	stored := *data
+	if stored.User != "" {
+		var serviceToken, ssecurity string
+		if stored.Session != nil {
+			serviceToken, ssecurity = stored.Session.ServiceToken, stored.Session.SSecurity
+		}
+		if err := s.put(stored.User, SecretPassToken, stored.PassToken); err != nil {
+			return err
+		}
+		if err := s.put(stored.User, SecretServiceToken, serviceToken); err != nil {
+			return err
+		}
+		if err := s.put(stored.User, SecretSSecurity, ssecurity); err != nil {
+			return err
+		}
+	}
+
+	stored.PassToken = ""
+	stored.Password = ""
+	if stored.Session != nil {
+		stored.Session = &types.SessionTokens{ExpiresAt: stored.Session.ExpiresAt}
+	}
+	return s.Data.Save(&stored)
+}
+
+// get returns the secret for key, or current when none is stored
+func (s *SecretBackend) get(account, key, current string) (string, error) {
+	value, err := s.Secrets.Get(account, key)
+	if errors.Is(err, ErrSecretNotFound) {
+		return current, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// put stores value under key, deleting the secret when value is empty
+func (s *SecretBackend) put(account, key, value string) error {
+	if value == "" {
+		return s.Secrets.Delete(account, key)
+	}
+	return s.Secrets.Set(account, key, value)
+}
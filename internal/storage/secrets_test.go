@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"muitoolunlock/internal/types"
+)
+
+func TestSecretBackendKeepsTokensOutOfDataFile(t *testing.T) {
+	dataPath := filepath.Join(t.TempDir(), PlainFileName)
+	secrets := NewMemorySecrets()
+	store := &SecretBackend{Data: &PlainFile{Path: dataPath}, Secrets: secrets}
+
+	expires := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	saved := &types.UnlockData{
+		User:      "user@example.com",
+		Password:  "hunter2",
+		WbID:      "wb-id",
+		PassToken: "pass-token",
+		Session:   &types.SessionTokens{ServiceToken: "service-token", SSecurity: "ssecurity", ExpiresAt: expires},
+	}
+	if err := store.Save(saved); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	raw, err := os.ReadFile(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "pass-token", "service-token", "ssecurity\""} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("data file contains %q:\n%s", secret, raw)
+		}
+	}
+	if value, err := secrets.Get("user@example.com", SecretPassToken); err != nil || value != "pass-token" {
+		t.Errorf("secret passToken = %q, %v", value, err)
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Password != "" || loaded.PassToken != "pass-token" || loaded.WbID != "wb-id" {
+		t.Errorf("Load() = %+v", loaded)
+	}
+	if loaded.Session == nil || loaded.Session.ServiceToken != "service-token" || loaded.Session.SSecurity != "ssecurity" || !loaded.Session.ExpiresAt.Equal(expires) {
+		t.Errorf("Load() session = %+v", loaded.Session)
+	}
+}
+
+func TestSecretBackendSaveWithoutTokensDeletesSecrets(t *testing.T) {
+	secrets := NewMemorySecrets()
+	secrets.Set("user", SecretPassToken, "old-token")
+	store := &SecretBackend{Data: &PlainFile{Path: filepath.Join(t.TempDir(), PlainFileName)}, Secrets: secrets}
+
+	if err := store.Save(&types.UnlockData{User: "user"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := secrets.Get("user", SecretPassToken); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Get() after logout error = %v, want %v", err, ErrSecretNotFound)
+	}
+}
+
+func TestSecretBackendLoadError(t *testing.T) {
+	dataPath := filepath.Join(t.TempDir(), PlainFileName)
+	if err := os.WriteFile(dataPath, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := &SecretBackend{Data: &PlainFile{Path: dataPath}, Secrets: NewMemorySecrets()}
+
+	if _, err := store.Load(); err == nil {
+		t.Error("Load() of a corrupt data file succeeded")
+	}
+}
+
+func TestFileSecretsEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SecretsFileName)
+	store := &FileSecrets{Path: path, Passphrase: []byte("passphrase")}
+
+	if err := store.Set("user", SecretPassToken, "pass-token"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "pass-token") {
+		t.Errorf("secrets file is not encrypted: %s", raw)
+	}
+
+	if value, err := store.Get("user", SecretPassToken); err != nil || value != "pass-token" {
+		t.Errorf("Get() = %q, %v", value, err)
+	}
+	wrong := &FileSecrets{Path: path, Passphrase: []byte("wrong")}
+	if _, err := wrong.Get("user", SecretPassToken); err == nil {
+		t.Error("Get() with the wrong passphrase succeeded")
+	}
+}
+
+func TestOpenSecretStoreAuto(t *testing.T) {
+	// Point the session bus at nothing so the keyring is unavailable
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path="+filepath.Join(t.TempDir(), "missing"))
+	path := filepath.Join(t.TempDir(), SecretsFileName)
+
+	if _, _, err := OpenSecretStore(SecretBackendAuto, path, nil); !errors.Is(err, ErrPlaintextSecrets) {
+		t.Errorf("OpenSecretStore(auto) without a passphrase error = %v, want %v", err, ErrPlaintextSecrets)
+	}
+
+	store, chosen, err := OpenSecretStore(SecretBackendAuto, path, []byte("passphrase"))
+	if err != nil {
+		t.Fatalf("OpenSecretStore(auto) error = %v", err)
+	}
+	if file, ok := store.(*FileSecrets); !ok || chosen != SecretBackendFile || len(file.Passphrase) == 0 {
+		t.Errorf("OpenSecretStore(auto) = %T %q, want an encrypted file", store, chosen)
+	}
+
+	if _, _, err := OpenSecretStore("vault", path, nil); !errors.Is(err, ErrUnknownSecretBackend) {
+		t.Errorf("OpenSecretStore(vault) error = %v, want %v", err, ErrUnknownSecretBackend)
+	}
+}
@@ -2,36 +2,125 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"muitoolunlock/internal/types"
 )
 
-// LoadUnlockData loads unlock data from local file
-func LoadUnlockData() *types.UnlockData {
-	baseDir, err := os.Getwd()
+// PlainFileName is the legacy plaintext data file kept in the data directory
+const PlainFileName = "miunlockdata.json"
+
+// CookiesFileName keeps the HTTP cookies of the account's login next to its data
+const CookiesFileName = "micookies.json"
+
+// Backend persists unlock data
+type Backend interface {
+	Load() (*types.UnlockData, error)
+	Save(data *types.UnlockData) error
+}
+
+// backend is the store used by LoadUnlockData and SaveUnlockData
+var backend Backend
+
+// SetBackend selects the store used by LoadUnlockData and SaveUnlockData
+func SetBackend(b Backend) {
+	backend = b
+}
+
+// LoadUnlockData loads unlock data from the selected store; nothing saved yet yields empty data.
+// A store that cannot be read is an error, so callers never save over data they could not load.
+func LoadUnlockData() (*types.UnlockData, error) {
+	data, err := CurrentBackend().Load()
 	if err != nil {
-		return &types.UnlockData{}
+		return nil, fmt.Errorf("failed to load account data: %w", err)
+	}
+	if data == nil {
+		return &types.UnlockData{}, nil
+	}
+
+	return data, nil
+}
+
+// SaveUnlockData saves unlock data to local file
+func SaveUnlockData(data *types.UnlockData) error {
+	if err := CurrentBackend().Save(data); err != nil {
+		return fmt.Errorf("failed to save account data: %w", err)
 	}
-	dataFile := filepath.Join(baseDir, "miunlockdata.json")
+	return nil
+}
+
+// CurrentBackend returns the selected backend, defaulting to the plaintext file
+func CurrentBackend() Backend {
+	if backend != nil {
+		return backend
+	}
+
+	return &PlainFile{Path: filepath.Join(DataDir(), PlainFileName)}
+}
 
+// PlainFile stores unlock data as unencrypted JSON
+type PlainFile struct {
+	Path string
+}
+
+// Load reads the JSON file; a missing file yields empty data
+func (p *PlainFile) Load() (*types.UnlockData, error) {
 	data := &types.UnlockData{}
-	if fileData, err := os.ReadFile(dataFile); err == nil {
-		json.Unmarshal(fileData, data)
+	fileData, err := os.ReadFile(p.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return data
+	if err := json.Unmarshal(fileData, data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
-// SaveUnlockData saves unlock data to local file
-func SaveUnlockData(data *types.UnlockData) {
-	baseDir, err := os.Getwd()
+// Save writes the JSON file readable by the owner only. The account password is never written
+// in plaintext; a password saved by older versions is dropped.
+func (p *PlainFile) Save(data *types.UnlockData) error {
+	stored := *data
+	stored.Password = ""
+
+	jsonData, err := json.MarshalIndent(&stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(p.Path, jsonData)
+}
+
+// writeFileAtomic replaces path with data via a 0600 temporary file in the same directory,
+// creating the directory when needed
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
 	if err != nil {
-		return
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
 	}
-	dataFile := filepath.Join(baseDir, "miunlockdata.json")
 
-	jsonData, _ := json.MarshalIndent(data, "", "  ")
-	os.WriteFile(dataFile, jsonData, 0644)
+	return os.Rename(tmp.Name(), path)
 }
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"muitoolunlock/internal/types"
+)
+
+func TestLoadUnlockData(t *testing.T) {
+	t.Cleanup(func() { SetBackend(nil) })
+	dataPath := filepath.Join(t.TempDir(), PlainFileName)
+	secrets := NewMemorySecrets()
+	secrets.Set("user", SecretPassToken, "pass-token")
+	SetBackend(&SecretBackend{Data: &PlainFile{Path: dataPath}, Secrets: secrets})
+
+	// Nothing saved yet
+	data, err := LoadUnlockData()
+	if err != nil || *data != (types.UnlockData{}) {
+		t.Fatalf("LoadUnlockData() = %+v, %v, want empty data", data, err)
+	}
+
+	if err := os.WriteFile(dataPath, []byte(`{"user": "user", "wb_id": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := LoadUnlockData(); err == nil {
+		t.Fatalf("LoadUnlockData() of a corrupt file = %+v, want an error", data)
+	}
+	if value, err := secrets.Get("user", SecretPassToken); err != nil || value != "pass-token" {
+		t.Errorf("passToken after a failed load = %q, %v", value, err)
+	}
+}
@@ -1,22 +1,48 @@
 package types
 
+import "time"
+
 const AppVersion = "1.5.9"
 
 // UnlockData represents stored unlock data
 type UnlockData struct {
-	User     string `json:"user"`
-	Password string `json:"pwd"`
-	WbID     string `json:"wb_id"`
-	Login    string `json:"login"`
-	UID      string `json:"uid"`
+	User      string         `json:"user"`
+	Password  string         `json:"pwd"`
+	WbID      string         `json:"wb_id"`
+	Login     string         `json:"login"`
+	UID       string         `json:"uid"`
+	PassToken string         `json:"pass_token,omitempty"`
+	Session   *SessionTokens `json:"session,omitempty"`
+}
+
+// SessionTokens holds the short-lived unlock API credentials
+type SessionTokens struct {
+	ServiceToken string    `json:"service_token,omitempty"`
+	SSecurity    string    `json:"ssecurity,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
 }
 
 // DeviceInfo represents device information
 type DeviceInfo struct {
-	Unlocked string
-	Product  string
-	SoC      string
-	Token    string
+	Unlocked string `json:"unlocked"`
+	Product  string `json:"product"`
+	SoC      string `json:"soc,omitempty"`
+	Token    string `json:"token,omitempty"`
+
+	// Fields below come from a single "getvar all"; zero values mean not reported
+	Serial           string `json:"serial,omitempty"`
+	CriticalUnlocked string `json:"critical_unlocked,omitempty"`
+	AntiRollback     int    `json:"anti_rollback,omitempty"`
+	SlotCount        int    `json:"slot_count,omitempty"`
+	CurrentSlot      string `json:"current_slot,omitempty"`
+	Secure           string `json:"secure,omitempty"`
+	Variant          string `json:"variant,omitempty"`
+	HWRevision       string `json:"hw_revision,omitempty"`
+	MaxDownloadSize  int64  `json:"max_download_size,omitempty"`
+	// BatteryVoltage is in millivolts
+	BatteryVoltage int `json:"battery_voltage,omitempty"`
+	// Vars holds every variable reported by the bootloader
+	Vars map[string]string `json:"vars,omitempty"`
 }
 
 // XiaomiAuthResponse represents Xiaomi authentication response
@@ -29,6 +55,7 @@ type XiaomiAuthResponse struct {
 	Location        string `json:"location"`
 	PassToken       string `json:"passToken"`
 	UserID          string `json:"userId"`
+	ServiceToken    string `json:"serviceToken"`
 }
 
 // UnlockResponse represents unlock API response
@@ -39,4 +66,5 @@ type UnlockResponse struct {
 	Data        struct {
 		WaitHour int `json:"waitHour"`
 	} `json:"data"`
+	WaitUntil time.Time `json:"-"`
 }
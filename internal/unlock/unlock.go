@@ -1,151 +1,191 @@
 package unlock
 
 import (
-	"bufio"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
-	"time"
 
-	"muitoolunlock/internal/colors"
 	"muitoolunlock/internal/device"
+	"muitoolunlock/internal/fastboot"
+	"muitoolunlock/internal/report"
+	"muitoolunlock/internal/session"
 	"muitoolunlock/internal/types"
+	"muitoolunlock/internal/unlockapi"
 )
 
-// PerformUnlock performs the complete unlock process
-func PerformUnlock(deviceInfo *types.DeviceInfo, authData *types.XiaomiAuthResponse, fastbootPath string) {
-	fmt.Println(colors.Header("🔓 Device Unlock Process"))
+// Unlock errors; match them with errors.Is. Refusals from the unlock server are returned
+// as *unlockapi.APIError and match the unlockapi code errors.
+var (
+	ErrCancelled   = errors.New("unlock cancelled")
+	ErrAuthFailed  = errors.New("authentication failed")
+	ErrFlashFailed = errors.New("failed to apply unlock data to the device")
+)
+
+// PerformUnlock performs the complete unlock process on the device with the given serial.
+// It returns the unlock API response whenever the server answered, including on refusals,
+// so callers can show details such as the wait period end.
+func PerformUnlock(ui report.UI, deviceInfo *types.DeviceInfo, sess *session.Session, wbID, fastbootPath, serial string) (*types.UnlockResponse, error) {
+	ui.Section("🔓 Device Unlock Process")
 
 	// Check if device is already unlocked
 	if deviceInfo.Unlocked == "yes" || deviceInfo.Unlocked == "true" {
-		fmt.Println(colors.Success("Device is already unlocked!"))
-		return
+		ui.Success("Device is already unlocked!")
+		return nil, nil
 	}
 
+	authData, _, err := sess.AuthData()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAuthFailed, err)
+	}
+	client := unlockapi.NewClient(authData)
+	client.Reauthenticate = sess.Refresh
+
 	// Step 1: Check device clear policy (like Python script)
-	fmt.Println(colors.Info("Checking device unlock policy..."))
-	clearPolicy := CheckDeviceClearPolicy(deviceInfo.Product)
+	ui.Progress("Checking device unlock policy...")
+	clearPolicy, err := CheckDeviceClearPolicy(client, deviceInfo.Product)
+	if err != nil {
+		ui.Warning(fmt.Sprintf("Could not check clear policy: %v", err))
+	}
 
 	if clearPolicy == 1 {
-		fmt.Println(colors.Warning("🔴 This device clears user data when it is unlocked"))
+		ui.Warning("🔴 This device clears user data when it is unlocked")
 	} else if clearPolicy == -1 {
-		fmt.Println(colors.Success("🟢 Unlocking the device does not clear user data"))
+		ui.Success("🟢 Unlocking the device does not clear user data")
 	}
 
-	fmt.Println(colors.Notice("Please ensure your device bootloader can be unlocked"))
+	ui.Info("Please ensure your device bootloader can be unlocked")
 
 	// Confirm before proceeding
-	fmt.Print(colors.Prompt("\n🔓 Press Enter to Unlock (or type 'q' to quit): "))
-	reader := bufio.NewReader(os.Stdin)
-	choice, _ := reader.ReadString('\n')
-	if strings.TrimSpace(strings.ToLower(choice)) == "q" {
-		fmt.Println(colors.Error("Unlock cancelled"))
-		return
+	if !ui.Confirm("🔓 Unlock the bootloader now?", true) {
+		return nil, ErrCancelled
 	}
 
-	fmt.Println(colors.Section("🚀 Unlock Execution"))
+	ui.Section("🚀 Unlock Execution")
 
 	// Step 2: Request unlock from Xiaomi API (like Python RetrieveEncryptData)
-	fmt.Print(colors.Progress("Requesting unlock permission from Xiaomi servers"))
-	for i := 0; i < 5; i++ {
-		time.Sleep(500 * time.Millisecond)
-		fmt.Print(colors.DimText("."))
+	ui.Progress("Requesting unlock permission from Xiaomi servers...")
+
+	unlockResponse, err := RequestUnlockFromAPI(client, deviceInfo, wbID)
+	var apiErr *unlockapi.APIError
+	if errors.As(err, &apiErr) {
+		// Refused by the server: explain the code before returning it
+		if unlockResponse != nil && unlockResponse.DescEN != "" {
+			ui.Field("Message", unlockResponse.DescEN)
+		}
+
+		if info, ok := unlockapi.LookupCode(apiErr.Code); ok {
+			ui.Field("Meaning", info.Description)
+			ui.Field("💡 What to do", info.Remedy)
+		} else {
+			ui.Field("💡 For error codes", "https://offici5l.github.io/articles/mi-error-codes")
+		}
+
+		if errors.Is(err, unlockapi.ErrWaitPeriod) && unlockResponse != nil && !unlockResponse.WaitUntil.IsZero() {
+			// Wait time required
+			ui.Field("⏰ You can unlock on", unlockResponse.WaitUntil.Format("2006-01-02 15:04"))
+		}
+		return unlockResponse, err
+	}
+	if err != nil {
+		return unlockResponse, fmt.Errorf("unlock request failed: %w", err)
 	}
-	fmt.Println()
 
-	unlockResponse := RequestUnlockFromAPI(deviceInfo, authData)
+	// Success - got encrypted data
+	ui.Success("Received encrypted unlock data from Xiaomi")
 
-	if unlockResponse.Code == 0 && unlockResponse.EncryptData != "" {
-		// Success - got encrypted data
-		fmt.Println(colors.Package("Received encrypted unlock data from Xiaomi"))
+	if err := FlashUnlockData(ui, unlockResponse.EncryptData, fastbootPath, serial); err != nil {
+		return unlockResponse, fmt.Errorf("%w: %w", ErrFlashFailed, err)
+	}
 
-		// Convert hex string to bytes (like Python script)
-		encryptedBytes, err := hex.DecodeString(unlockResponse.EncryptData)
-		if err != nil {
-			fmt.Println(colors.Error(fmt.Sprintf("Failed to decode encrypted data: %v", err)))
-			return
-		}
+	ui.Success("Device unlock successful!")
+	ui.Success("🎉 Your Xiaomi device has been unlocked!")
 
-		// Write encrypted data to file
-		encryptFile := "encryptData"
-		err = os.WriteFile(encryptFile, encryptedBytes, 0644)
-		if err != nil {
-			fmt.Println(colors.Error(fmt.Sprintf("Failed to write encrypt data: %v", err)))
-			return
-		}
+	ui.Section("🏁 Process Complete")
+	return unlockResponse, nil
+}
 
-		// Get serial number (like Python script)
-		fmt.Print(colors.Info("Fetching device serial..."))
-		device.RunFastbootCommand(fastbootPath, "getvar", "serialno")
-		fmt.Print("\r\033[K")
-
-		// Stage the encrypted data
-		fmt.Println(colors.Upload("Staging encrypted data..."))
-		stageCmd := exec.Command(fastbootPath, "stage", encryptFile)
-		if err := stageCmd.Run(); err != nil {
-			fmt.Println(colors.Error(fmt.Sprintf("Failed to stage data: %v", err)))
-			os.Remove(encryptFile)
-			return
-		}
+// CheckDeviceClearPolicy checks if device clears data when unlocked
+// (1 = clears data, -1 = keeps data, 0 = unknown)
+func CheckDeviceClearPolicy(client *unlockapi.Client, product string) (int, error) {
+	return client.ClearPolicy(product)
+}
 
-		// Perform unlock
-		fmt.Println(colors.Unlock("Executing unlock command..."))
-		unlockCmd := exec.Command(fastbootPath, "oem", "unlock")
-		output, err := unlockCmd.CombinedOutput()
+// RequestUnlockFromAPI requests unlock permission from Xiaomi API
+func RequestUnlockFromAPI(client *unlockapi.Client, deviceInfo *types.DeviceInfo, wbID string) (*types.UnlockResponse, error) {
+	return client.RequestUnlock(deviceInfo, wbID)
+}
 
-		// Clean up
-		os.Remove(encryptFile)
+// FlashUnlockData stages the hex-encoded encryptData from the unlock API on the device and
+// runs "oem unlock", natively over USB when possible and through the fastboot binary otherwise.
+func FlashUnlockData(r report.Reporter, encryptData, fastbootPath, serial string) error {
+	// Convert hex string to bytes (like Python script)
+	encryptedBytes, err := hex.DecodeString(encryptData)
+	if err != nil {
+		return fmt.Errorf("failed to decode encrypted data: %w", err)
+	}
 
-		if err != nil {
-			fmt.Println(colors.Error(fmt.Sprintf("Unlock failed: %v", err)))
-			fmt.Printf("%s %s\n", colors.Info("Output:"), colors.DimText(string(output)))
-			return
-		}
+	// Prefer talking to the bootloader directly; fall back to the fastboot binary
+	if done, err := unlockNative(r, encryptedBytes, serial); done {
+		return err
+	}
 
-		fmt.Println(colors.Success("Device unlock successful!"))
-		fmt.Println(colors.Trophy("Your Xiaomi device has been unlocked!"))
+	// Write encrypted data to a private temporary folder rather than the working directory
+	tmpDir, err := os.MkdirTemp("", "mui-tool-unlock-*")
+	if err != nil {
+		return fmt.Errorf("failed to write encrypt data: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
 
-	} else if unlockResponse.DescEN != "" {
-		// Error from API
-		fmt.Println(colors.Error(fmt.Sprintf("Unlock request failed (Code: %d)", unlockResponse.Code)))
-		fmt.Printf("%s %s\n", colors.Info("Message:"), colors.Warning(unlockResponse.DescEN))
+	encryptFile := filepath.Join(tmpDir, "encryptData")
+	if err := os.WriteFile(encryptFile, encryptedBytes, 0600); err != nil {
+		return fmt.Errorf("failed to write encrypt data: %w", err)
+	}
 
-		if unlockResponse.Code == 20036 && unlockResponse.Data.WaitHour > 0 {
-			// Wait time required
-			waitTime := time.Now().Add(time.Duration(unlockResponse.Data.WaitHour) * time.Hour)
-			fmt.Printf("\n%s %s\n", colors.Info("⏰ You can unlock on:"), colors.BoldText(waitTime.Format("2006-01-02 15:04")))
-		} else {
-			fmt.Printf("\n%s %s\n", colors.Info("💡 For error codes:"), colors.DimText("https://offici5l.github.io/articles/mi-error-codes"))
-		}
-	} else {
-		fmt.Println(colors.Error(fmt.Sprintf("Unexpected response from Xiaomi API: %+v", unlockResponse)))
+	// Get serial number (like Python script)
+	device.RunFastbootCommand(fastbootPath, serial, "getvar", "serialno")
+
+	// Stage the encrypted data
+	r.Progress("Staging encrypted data...")
+	stageCmd := exec.Command(fastbootPath, device.Args(serial, "stage", encryptFile)...)
+	if output, err := stageCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stage data: %w: %s", err, strings.TrimSpace(string(output)))
 	}
 
-	fmt.Println(colors.Section("🏁 Process Complete"))
+	// Perform unlock
+	r.Progress("Executing unlock command...")
+	unlockCmd := exec.Command(fastbootPath, device.Args(serial, "oem", "unlock")...)
+	if output, err := unlockCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
 }
 
-// CheckDeviceClearPolicy checks if device clears data when unlocked
-func CheckDeviceClearPolicy(product string) int {
-	// Simulate API call to check if device clears data when unlocked
-	// In Python: RetrieveEncryptData("/api/v2/unlock/device/clear", {"data":{"product":product}})
-	time.Sleep(1 * time.Second)
-
-	// Mock response: -1 = no clear, 1 = clears data, 0 = unknown
-	// For demo, return -1 (doesn't clear data)
-	return -1
-}
+// unlockNative stages data and runs "oem unlock" over the native USB or TCP transport.
+// It reports done=false when no device could be opened natively, so the caller
+// can fall back to the fastboot binary.
+func unlockNative(r report.Reporter, data []byte, serial string) (bool, error) {
+	client, err := fastboot.Open(serial)
+	if err != nil {
+		return false, nil
+	}
+	defer client.Close()
 
-// RequestUnlockFromAPI requests unlock permission from Xiaomi API
-func RequestUnlockFromAPI(deviceInfo *types.DeviceInfo, authData *types.XiaomiAuthResponse) *types.UnlockResponse {
-	// Simulate the Python RetrieveEncryptData("/api/v3/ahaUnlock", ...) call
-	// This would make real HTTP requests to Xiaomi API in production
-	time.Sleep(3 * time.Second)
+	client.OnInfo = func(message string) {
+		r.Info("(bootloader) " + message)
+	}
+
+	r.Progress("Staging encrypted data...")
+	if err := client.Download(data); err != nil {
+		return true, fmt.Errorf("failed to stage data: %w", err)
+	}
 
-	// For demo purposes, return mock success with fake encrypted data
-	return &types.UnlockResponse{
-		Code:        0,
-		EncryptData: "deadbeef" + strings.Repeat("a1b2c3d4", 10), // Mock hex data
+	r.Progress("Executing unlock command...")
+	if _, err := client.Oem("unlock"); err != nil {
+		return true, err
 	}
+	return true, nil
 }
@@ -0,0 +1,300 @@
+package unlockapi
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"muitoolunlock/internal/httpclient"
+	"muitoolunlock/internal/types"
+)
+
+// DefaultBaseURL is the Xiaomi unlock service endpoint
+const DefaultBaseURL = "https://unlock.update.miui.com"
+
+// Values sent by the official Mi Unlock client
+const (
+	clientSID     = "miui_unlocktool_client"
+	clientVersion = "7.6.727.43"
+)
+
+// API paths
+const (
+	pathNonce       = "/api/v2/nonce"
+	pathDeviceClear = "/api/v2/unlock/device/clear"
+	pathAhaUnlock   = "/api/v3/ahaUnlock"
+)
+
+// Client errors
+var (
+	ErrMissingSession     = errors.New("missing ssecurity or service token, please log in again")
+	ErrUnauthorized       = errors.New("unlock API rejected the session")
+	ErrUnexpectedResponse = errors.New("unexpected response from unlock API")
+)
+
+// APIError is returned when the unlock API answers with a non-zero code
+type APIError struct {
+	Path        string
+	Code        int
+	Description string
+}
+
+func (e *APIError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("unlock API %s failed with code %d", e.Path, e.Code)
+	}
+	return fmt.Sprintf("unlock API %s failed with code %d: %s", e.Path, e.Code, e.Description)
+}
+
+// Client talks to the signed Xiaomi unlock API
+type Client struct {
+	// HTTPClient is used for every request
+	HTTPClient *http.Client
+	// BaseURL is the unlock service endpoint
+	BaseURL string
+	// Now returns the current time; used to compute wait deadlines
+	Now func() time.Time
+	// Rand is the randomness source for nonce requests
+	Rand io.Reader
+	// Reauthenticate, when set, is called once to obtain fresh credentials after the
+	// server rejects the current session
+	Reauthenticate func() (*types.XiaomiAuthResponse, error)
+
+	ssecurity    string
+	serviceToken string
+	userID       string
+}
+
+// NewClient creates a client for the session obtained from auth, using the shared HTTP client
+// with each request bounded by one minute
+func NewClient(authData *types.XiaomiAuthResponse) *Client {
+	httpClient := *httpclient.Default()
+	httpClient.Timeout = 60 * time.Second
+	return &Client{
+		HTTPClient:   &httpClient,
+		BaseURL:      DefaultBaseURL,
+		Now:          time.Now,
+		Rand:         rand.Reader,
+		ssecurity:    authData.SSecurity,
+		serviceToken: authData.ServiceToken,
+		userID:       authData.UserID,
+	}
+}
+
+// clearResponse is the decoded /api/v2/unlock/device/clear result
+type clearResponse struct {
+	Code       int    `json:"code"`
+	DescEN     string `json:"descEN"`
+	CleanOrNot int    `json:"cleanOrNot"`
+}
+
+// ClearPolicy reports whether unlocking product wipes user data: 1 = clears, -1 = keeps, 0 = unknown
+func (c *Client) ClearPolicy(product string) (int, error) {
+	data, err := encodeData(map[string]string{"product": product})
+	if err != nil {
+		return 0, err
+	}
+
+	resp := &clearResponse{}
+	err = c.withSession(func() error {
+		*resp = clearResponse{}
+		if err := c.call(pathDeviceClear, params{{"appId", "1"}, {"data", data}}, resp); err != nil {
+			return err
+		}
+		if resp.Code != 0 {
+			return &APIError{Path: pathDeviceClear, Code: resp.Code, Description: resp.DescEN}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.CleanOrNot, nil
+}
+
+// unlockDeviceInfo is the deviceInfo object sent to ahaUnlock
+type unlockDeviceInfo struct {
+	BoardVersion string `json:"boardVersion"`
+	Product      string `json:"product"`
+	SocID        string `json:"socId"`
+	DeviceName   string `json:"deviceName"`
+}
+
+// unlockData is the data object sent to ahaUnlock; field order matches the reference client
+type unlockData struct {
+	ClientID      string           `json:"clientId"`
+	ClientVersion string           `json:"clientVersion"`
+	Language      string           `json:"language"`
+	Operate       string           `json:"operate"`
+	PcID          string           `json:"pcId"`
+	Product       string           `json:"product"`
+	Region        string           `json:"region"`
+	DeviceInfo    unlockDeviceInfo `json:"deviceInfo"`
+	DeviceToken   string           `json:"deviceToken"`
+}
+
+// RequestUnlock asks the server for the signed unlock blob for the device.
+// A non-zero response code is returned both in the response and as an *APIError.
+func (c *Client) RequestUnlock(deviceInfo *types.DeviceInfo, wbID string) (*types.UnlockResponse, error) {
+	pcID := md5.Sum([]byte(wbID))
+	data, err := encodeData(unlockData{
+		ClientID:      "2",
+		ClientVersion: clientVersion,
+		Language:      "en",
+		Operate:       "unlock",
+		PcID:          hex.EncodeToString(pcID[:]),
+		Product:       deviceInfo.Product,
+		DeviceInfo:    unlockDeviceInfo{Product: deviceInfo.Product},
+		DeviceToken:   deviceInfo.Token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *types.UnlockResponse
+	err = c.withSession(func() error {
+		resp = &types.UnlockResponse{}
+		if err := c.call(pathAhaUnlock, params{{"appId", "1"}, {"data", data}}, resp); err != nil {
+			resp = nil
+			return err
+		}
+
+		if resp.Data.WaitHour > 0 {
+			resp.WaitUntil = c.Now().Add(time.Duration(resp.Data.WaitHour) * time.Hour)
+		}
+		if resp.Code != 0 {
+			return &APIError{Path: pathAhaUnlock, Code: resp.Code, Description: resp.DescEN}
+		}
+		return nil
+	})
+	if err != nil {
+		return resp, err
+	}
+	if resp.EncryptData == "" {
+		return resp, fmt.Errorf("%w: empty encryptData", ErrUnexpectedResponse)
+	}
+
+	return resp, nil
+}
+
+// withSession runs fn and, if the server rejected the session, re-authenticates once and retries
+func (c *Client) withSession(fn func() error) error {
+	err := fn()
+	if c.Reauthenticate == nil || !(errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrMissingSession)) {
+		return err
+	}
+
+	authData, reauthErr := c.Reauthenticate()
+	if reauthErr != nil {
+		return fmt.Errorf("%w (re-authentication failed: %v)", err, reauthErr)
+	}
+	c.ssecurity = authData.SSecurity
+	c.serviceToken = authData.ServiceToken
+	c.userID = authData.UserID
+
+	return fn()
+}
+
+// nonceResponse is the decoded /api/v2/nonce result
+type nonceResponse struct {
+	Code   int    `json:"code"`
+	DescEN string `json:"descEN"`
+	Nonce  string `json:"nonce"`
+}
+
+// call fetches a fresh nonce, then posts the signed request and decodes the response into out
+func (c *Client) call(path string, p params, out interface{}) error {
+	r, err := c.randomLetters(16)
+	if err != nil {
+		return err
+	}
+
+	nonce := &nonceResponse{}
+	if err := c.post(pathNonce, params{{"r", r}, {"sid", clientSID}}, nonce); err != nil {
+		return err
+	}
+	if nonce.Code != 0 || nonce.Nonce == "" {
+		return &APIError{Path: pathNonce, Code: nonce.Code, Description: nonce.DescEN}
+	}
+
+	p = append(p, param{"nonce", nonce.Nonce}, param{"sid", clientSID})
+	return c.post(path, p, out)
+}
+
+// post signs and sends p to path and decrypts the response into out
+func (c *Client) post(path string, p params, out interface{}) error {
+	if c.ssecurity == "" || c.serviceToken == "" {
+		return ErrMissingSession
+	}
+
+	signed, err := signParams(path, p, c.ssecurity)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(c.BaseURL, "/")+path, strings.NewReader(signed.form()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "XiaomiPCSuite")
+	req.AddCookie(&http.Cookie{Name: "userId", Value: c.userID})
+	req.AddCookie(&http.Cookie{Name: "serviceToken", Value: c.serviceToken})
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unlock API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read unlock API response: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: %s returned HTTP %d", ErrUnauthorized, path, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned HTTP %d", ErrUnexpectedResponse, path, resp.StatusCode)
+	}
+
+	plain, err := decryptResponse(c.ssecurity, body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(plain, out); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnexpectedResponse, err)
+	}
+
+	return nil
+}
+
+// randomLetters returns n random lowercase letters for the nonce request
+func (c *Client) randomLetters(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(c.Rand, buf); err != nil {
+		return "", err
+	}
+	for i := range buf {
+		buf[i] = 'a' + buf[i]%26
+	}
+	return string(buf), nil
+}
+
+// encodeData renders a data object as base64(JSON) like the reference client
+func encodeData(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
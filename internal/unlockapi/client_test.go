@@ -0,0 +1,202 @@
+package unlockapi
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"muitoolunlock/internal/types"
+)
+
+// fakeUnlockServer decrypts signed requests and answers path with the JSON from respond;
+// requests without the session cookie are answered with HTTP 401
+type fakeUnlockServer struct {
+	t         *testing.T
+	ssecurity string
+	// respond returns the JSON answer for path given the decrypted request params
+	respond func(path string, form map[string]string) any
+}
+
+func (f *fakeUnlockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie("serviceToken"); err != nil || cookie.Value != "service-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+
+	// Keep the wire order; the signature covers the params in the order they were sent
+	var signed params
+	var signature string
+	form := map[string]string{}
+	for _, pair := range strings.Split(string(body), "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		key, _ = url.QueryUnescape(key)
+		value, _ = url.QueryUnescape(value)
+		if key == "signature" {
+			signature = value
+			continue
+		}
+		signed = append(signed, param{key, value})
+		form[key] = f.decryptValue(value)
+	}
+	digest := sha1.Sum([]byte(signed.join("&", r.URL.Path) + "&" + f.ssecurity))
+	if want := base64.StdEncoding.EncodeToString(digest[:]); signature != want {
+		f.t.Errorf("%s signature = %s, want %s", r.URL.Path, signature, want)
+	}
+
+	raw, err := json.Marshal(f.respond(r.URL.Path, form))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	key, _ := base64.StdEncoding.DecodeString(f.ssecurity)
+	answer, err := encrypt(key, []byte(base64.StdEncoding.EncodeToString(raw)))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	io.WriteString(w, answer)
+}
+
+// decryptValue reverses encrypt for one request parameter
+func (f *fakeUnlockServer) decryptValue(value string) string {
+	key, _ := base64.StdEncoding.DecodeString(f.ssecurity)
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		f.t.Fatalf("parameter %q is not base64: %v", value, err)
+	}
+	block, _ := aes.NewCipher(key)
+	cipher.NewCBCDecrypter(block, []byte(cipherIV)).CryptBlocks(data, data)
+	return string(data[:len(data)-int(data[len(data)-1])])
+}
+
+func newTestClient(t *testing.T, respond func(path string, form map[string]string) any) *Client {
+	t.Helper()
+	server := httptest.NewServer(&fakeUnlockServer{t: t, ssecurity: testSSecurity, respond: respond})
+	t.Cleanup(server.Close)
+
+	client := NewClient(&types.XiaomiAuthResponse{SSecurity: testSSecurity, ServiceToken: "service-token", UserID: "42"})
+	client.HTTPClient = server.Client()
+	client.BaseURL = server.URL
+	client.Rand = strings.NewReader(strings.Repeat("r", 64))
+	return client
+}
+
+// nonceOK answers the nonce request that precedes every call
+func nonceOK(t *testing.T, form map[string]string) any {
+	if form["sid"] != clientSID || len(form["r"]) != 16 {
+		t.Errorf("nonce request = %v", form)
+	}
+	return map[string]any{"code": 0, "nonce": "nonce-1"}
+}
+
+func TestClearPolicy(t *testing.T) {
+	client := newTestClient(t, func(path string, form map[string]string) any {
+		if path == pathNonce {
+			return nonceOK(t, form)
+		}
+		if path != pathDeviceClear {
+			t.Errorf("unexpected request to %s", path)
+		}
+		data, _ := base64.StdEncoding.DecodeString(form["data"])
+		if form["appId"] != "1" || string(data) != `{"product":"alioth"}` || form["nonce"] != "nonce-1" {
+			t.Errorf("clear request = %v, data %s", form, data)
+		}
+		return map[string]any{"code": 0, "cleanOrNot": 1}
+	})
+
+	policy, err := client.ClearPolicy("alioth")
+	if err != nil {
+		t.Fatalf("ClearPolicy() error = %v", err)
+	}
+	if policy != 1 {
+		t.Errorf("ClearPolicy() = %d, want 1", policy)
+	}
+}
+
+func TestRequestUnlock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		response      map[string]any
+		wantErr       error
+		wantWaitUntil time.Time
+	}{
+		{
+			name:     "success",
+			response: map[string]any{"code": 0, "encryptData": "00ff"},
+		},
+		{
+			name:          "wait period",
+			response:      map[string]any{"code": 20036, "descEN": "wait", "data": map[string]any{"waitHour": 168}},
+			wantErr:       ErrWaitPeriod,
+			wantWaitUntil: now.Add(168 * time.Hour),
+		},
+		{
+			name:     "empty blob",
+			response: map[string]any{"code": 0},
+			wantErr:  ErrUnexpectedResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(path string, form map[string]string) any {
+				if path == pathNonce {
+					return nonceOK(t, form)
+				}
+				if form["appId"] != "1" {
+					t.Errorf("ahaUnlock request = %v", form)
+				}
+				return tt.response
+			})
+			client.Now = func() time.Time { return now }
+
+			resp, err := client.RequestUnlock(&types.DeviceInfo{Product: "alioth", Token: "token"}, "wb-id")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RequestUnlock() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("RequestUnlock() error = %v", err)
+			}
+			if resp == nil {
+				t.Fatal("RequestUnlock() returned no response")
+			}
+			if !resp.WaitUntil.Equal(tt.wantWaitUntil) {
+				t.Errorf("WaitUntil = %v, want %v", resp.WaitUntil, tt.wantWaitUntil)
+			}
+		})
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	client := newTestClient(t, func(path string, form map[string]string) any {
+		if path == pathNonce {
+			return nonceOK(t, form)
+		}
+		return map[string]any{"code": 0, "cleanOrNot": -1}
+	})
+	client.serviceToken = "expired"
+	calls := 0
+	client.Reauthenticate = func() (*types.XiaomiAuthResponse, error) {
+		calls++
+		return &types.XiaomiAuthResponse{SSecurity: testSSecurity, ServiceToken: "service-token", UserID: "42"}, nil
+	}
+
+	policy, err := client.ClearPolicy("alioth")
+	if err != nil {
+		t.Fatalf("ClearPolicy() error = %v", err)
+	}
+	if policy != -1 || calls != 1 {
+		t.Errorf("ClearPolicy() = %d after %d re-authentications, want -1 after 1", policy, calls)
+	}
+}
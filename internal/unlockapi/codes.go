@@ -0,0 +1,135 @@
+package unlockapi
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Errors for known unlock API response codes; match them with errors.Is on an *APIError
+var (
+	ErrBadRequest         = errors.New("request parameter error")
+	ErrSignature          = errors.New("request signature rejected")
+	ErrTooManyRequests    = errors.New("too many requests from this IP")
+	ErrServer             = errors.New("unlock server internal error")
+	ErrTokenExpired       = errors.New("login session expired")
+	ErrInvalidNonce       = errors.New("invalid request nonce")
+	ErrClientOutdated     = errors.New("unlock client version is outdated")
+	ErrRecentlyUnlocked   = errors.New("account recently unlocked another device")
+	ErrAccountNotBound    = errors.New("device is not bound to this account")
+	ErrLowTrustScore      = errors.New("account is not eligible for unlocking")
+	ErrRegionMismatch     = errors.New("account cannot unlock this device")
+	ErrWaitPeriod         = errors.New("unlock wait period has not elapsed")
+	ErrDeviceLimitReached = errors.New("account reached its unlock limit")
+	ErrPhoneNotLinked     = errors.New("account has no linked phone number")
+)
+
+// CodeInfo describes a known unlock API response code
+type CodeInfo struct {
+	Code int
+	Err  error
+	// Key is the translation key; Key+"_remedy" holds the remediation text
+	Key         string
+	Description string
+	Remedy      string
+}
+
+// codes is the catalogue of response codes returned by /api/v3/ahaUnlock and friends
+var codes = map[int]CodeInfo{
+	10000: {
+		Err:         ErrBadRequest,
+		Description: "The unlock request was rejected because of invalid parameters.",
+		Remedy:      "Reconnect the device in fastboot mode and retry; if it persists, update this tool.",
+	},
+	10001: {
+		Err:         ErrSignature,
+		Description: "The server rejected the request signature.",
+		Remedy:      "Log out and log in again to refresh the ssecurity key.",
+	},
+	10002: {
+		Err:         ErrTooManyRequests,
+		Description: "Too many requests were sent from this network.",
+		Remedy:      "Wait a few minutes before trying again.",
+	},
+	10003: {
+		Err:         ErrServer,
+		Description: "The Xiaomi unlock server reported an internal error.",
+		Remedy:      "Try again later.",
+	},
+	10004: {
+		Err:         ErrTokenExpired,
+		Description: "The login session has expired.",
+		Remedy:      "Log in again and retry the unlock.",
+	},
+	10005: {
+		Err:         ErrInvalidNonce,
+		Description: "The request nonce was invalid or already used.",
+		Remedy:      "Check that the system clock is correct and retry.",
+	},
+	10006: {
+		Err:         ErrClientOutdated,
+		Description: "The server no longer accepts this client version.",
+		Remedy:      "Update MUI Tool Unlock to the latest release.",
+	},
+	20030: {
+		Err:         ErrRecentlyUnlocked,
+		Description: "This account has already unlocked a device recently.",
+		Remedy:      "Wait until the account is allowed to unlock again, or use another account.",
+	},
+	20031: {
+		Err:         ErrAccountNotBound,
+		Description: "This device is not bound to your Xiaomi account.",
+		Remedy:      "On the phone, open Settings > Developer options > Mi Unlock status and add this account, then retry.",
+	},
+	20033: {
+		Err:         ErrLowTrustScore,
+		Description: "This account is not eligible to unlock devices.",
+		Remedy:      "Use an older, actively used Xiaomi account.",
+	},
+	20034: {
+		Err:         ErrRegionMismatch,
+		Description: "This account cannot unlock this device, usually because the account and device regions differ.",
+		Remedy:      "Use an account from the device's region or bind the device with a matching account.",
+	},
+	20035: {
+		Err:         ErrClientOutdated,
+		Description: "This unlock tool version is outdated.",
+		Remedy:      "Update MUI Tool Unlock to the latest release.",
+	},
+	20036: {
+		Err:         ErrWaitPeriod,
+		Description: "The unlock wait period for this device has not elapsed yet.",
+		Remedy:      "Keep the device bound and retry after the displayed date; do not rebind the account or the timer restarts.",
+	},
+	20037: {
+		Err:         ErrDeviceLimitReached,
+		Description: "This account has reached the maximum number of unlocked devices.",
+		Remedy:      "Wait for the limit to reset or use another Xiaomi account.",
+	},
+	20041: {
+		Err:         ErrPhoneNotLinked,
+		Description: "Your Xiaomi account is not linked to a phone number.",
+		Remedy:      "Link a phone number in your Xiaomi account settings and retry.",
+	},
+}
+
+func init() {
+	for code, info := range codes {
+		info.Code = code
+		info.Key = "unlock_error_" + strconv.Itoa(code)
+		codes[code] = info
+	}
+}
+
+// LookupCode returns the catalogue entry for a response code
+func LookupCode(code int) (CodeInfo, bool) {
+	info, ok := codes[code]
+	return info, ok
+}
+
+// Unwrap exposes the catalogue error so callers can use errors.Is
+func (e *APIError) Unwrap() error {
+	if info, ok := codes[e.Code]; ok {
+		return info.Err
+	}
+	return nil
+}
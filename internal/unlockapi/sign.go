@@ -0,0 +1,134 @@
+package unlockapi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// signKey is the HMAC key used by the official unlock tool to sign requests
+const signKey = "2tBeoEyJTunmWUGq7bQH2Abn0k2NhhurOaqBfyxCuLVgn4AVj7swcawe53uDUno"
+
+// cipherIV is the fixed AES-CBC IV used for params and responses
+const cipherIV = "0102030405060708"
+
+// ErrDecrypt is returned when a response cannot be decrypted with ssecurity
+var ErrDecrypt = errors.New("failed to decrypt unlock API response")
+
+// param is one ordered request parameter; the order is part of the signature
+type param struct {
+	key   string
+	value string
+}
+
+// params keeps request parameters in insertion order
+type params []param
+
+// join renders "POST<sep>path<sep>k=v&k=v" as signed by the server
+func (p params) join(sep, path string) string {
+	var buf bytes.Buffer
+	buf.WriteString("POST" + sep + path + sep)
+	for i, kv := range p {
+		if i > 0 {
+			buf.WriteByte('&')
+		}
+		buf.WriteString(kv.key + "=" + kv.value)
+	}
+	return buf.String()
+}
+
+// form encodes the params as an application/x-www-form-urlencoded body, keeping order
+func (p params) form() string {
+	var buf bytes.Buffer
+	for i, kv := range p {
+		if i > 0 {
+			buf.WriteByte('&')
+		}
+		buf.WriteString(url.QueryEscape(kv.key) + "=" + url.QueryEscape(kv.value))
+	}
+	return buf.String()
+}
+
+// signParams signs, encrypts and counter-signs params the same way as the reference tool:
+// sign = hex(HMAC-SHA1(signKey, "POST\npath\nk=v&...")), every value is then AES-CBC
+// encrypted with base64-decoded ssecurity, and signature = base64(SHA1("POST&path&k=enc&...&ssecurity"))
+func signParams(path string, p params, ssecurity string) (params, error) {
+	key, err := base64.StdEncoding.DecodeString(ssecurity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssecurity: %w", err)
+	}
+
+	mac := hmac.New(sha1.New, []byte(signKey))
+	mac.Write([]byte(p.join("\n", path)))
+	signed := append(append(params{}, p...), param{"sign", hex.EncodeToString(mac.Sum(nil))})
+
+	encrypted := make(params, 0, len(signed)+1)
+	for _, kv := range signed {
+		value, err := encrypt(key, []byte(kv.value))
+		if err != nil {
+			return nil, err
+		}
+		encrypted = append(encrypted, param{kv.key, value})
+	}
+
+	digest := sha1.Sum([]byte(encrypted.join("&", path) + "&" + ssecurity))
+	encrypted = append(encrypted, param{"signature", base64.StdEncoding.EncodeToString(digest[:])})
+
+	return encrypted, nil
+}
+
+// encrypt returns base64(AES-CBC(key, IV, PKCS#7(plain)))
+func encrypt(key, plain []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid ssecurity key: %w", err)
+	}
+
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	cipher.NewCBCEncrypter(block, []byte(cipherIV)).CryptBlocks(data, data)
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// decryptResponse reverses the response encoding: base64 -> AES-CBC -> unpad -> base64 -> JSON bytes
+func decryptResponse(ssecurity string, body []byte) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(ssecurity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssecurity: %w", err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(body)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: invalid ciphertext length %d", ErrDecrypt, len(data))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssecurity key: %w", err)
+	}
+	cipher.NewCBCDecrypter(block, []byte(cipherIV)).CryptBlocks(data, data)
+
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(data) {
+		return nil, fmt.Errorf("%w: bad padding", ErrDecrypt)
+	}
+	data = data[:len(data)-padding]
+
+	plain, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+
+	return plain, nil
+}
@@ -0,0 +1,88 @@
+package unlockapi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testSSecurity is base64("0123456789abcdef"); the vectors below were computed independently
+// with openssl dgst -hmac and openssl enc -aes-128-cbc
+const testSSecurity = "MDEyMzQ1Njc4OWFiY2RlZg=="
+
+func TestSignParams(t *testing.T) {
+	p := params{{"r", "abcdefghijklmnop"}, {"sid", "miui_unlocktool_client"}}
+
+	got, err := signParams("/api/v2/nonce", p, testSSecurity)
+	if err != nil {
+		t.Fatalf("signParams() error = %v", err)
+	}
+
+	want := params{
+		{"r", "0n2hSRbbKvf/O80KoyXELOuY+lmli0EE7VyGLpX+954="},
+		{"sid", "3ON/uzr9/hx7NR4d9i1uG8g1890CipCkmTrPO14A0iI="},
+		// encrypted hex(HMAC-SHA1) = 84200d3a8e6f77469fde6fcc9654ccdbd6192e9c
+		{"sign", "XFv1P9ZNVnpcSmiLr6qagzk9mbNl8+I8ZiNAhzYdai4a5siB1WbPx0YtlPWwCd8y"},
+		{"signature", "rL9oqbyaxIk982Izm6yjIkL9PaU="},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("signParams() =\n%v\nwant\n%v", got, want)
+	}
+	if len(p) != 2 {
+		t.Errorf("signParams() modified its input: %v", p)
+	}
+}
+
+func TestSignParamsInvalidSSecurity(t *testing.T) {
+	if _, err := signParams("/api/v2/nonce", nil, "not base64!"); err == nil {
+		t.Error("signParams() with invalid ssecurity succeeded")
+	}
+}
+
+func TestDecryptResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "valid",
+			body: "Pf2pu9ZFqWS5nkGPvg5qOMbl6fd6Vs7UBVSEsZNIDsigrlVqWhkBSGJhfC4ds0Cn\n",
+			want: `{"code":0,"nonce":"n-1"}`,
+		},
+		{
+			name:    "not base64",
+			body:    "<html>",
+			wantErr: ErrDecrypt,
+		},
+		{
+			name:    "partial block",
+			body:    "AAAAAAAA",
+			wantErr: ErrDecrypt,
+		},
+		{
+			name:    "garbage ciphertext",
+			body:    "rL9oqbyaxIk982Izm6yjIkL9PaU3ON/uzr9/hx7NR4c=",
+			wantErr: ErrDecrypt,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptResponse(testSSecurity, []byte(tt.body))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("decryptResponse() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decryptResponse() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("decryptResponse() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
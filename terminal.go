@@ -5,28 +5,67 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"strings"
 
 	"muitoolunlock/internal/colors"
+	"muitoolunlock/internal/httpclient"
 	interfaces "muitoolunlock/internal/interface"
+	"muitoolunlock/internal/paths"
 	"muitoolunlock/internal/platform"
+	"muitoolunlock/internal/report"
 	"muitoolunlock/internal/types"
 )
 
 func main() {
+	// Network settings from the environment, overridden by the flags below
+	httpOpts, httpErr := httpclient.OptionsFromEnv()
+
 	// CLI flags
 	var (
 		version    = flag.Bool("version", false, "Show version information")
 		help       = flag.Bool("help", false, "Show help information")
 		unlock     = flag.Bool("unlock", false, "Start unlock process")
 		account    = flag.String("account", "", "Xiaomi account (email/phone/ID)")
-		password   = flag.String("password", "", "Account password")
+		passFile   = flag.String("password-file", "", "Read the account password from this file")
+		wbID       = flag.String("wb-id", os.Getenv("MUI_WB_ID"), "Device ID from the Xiaomi web login (the d= parameter)")
+		yes        = flag.Bool("yes", false, "Confirm the unlock without asking (for --unlock)")
 		deviceMode = flag.Bool("device", false, "Interactive device unlock mode")
+		serial     = flag.String("serial", os.Getenv("ANDROID_SERIAL"), "Serial of the device to use when several are connected, or tcp:host[:port]")
+		encrypt    = flag.Bool("encrypt", false, "Store account data encrypted with a passphrase")
+		forgetPass = flag.Bool("forget-password", false, "Never store the password, keep only the passToken (implies --encrypt)")
+		profile    = flag.String("profile", "", "Account profile to use (defaults to the default profile)")
+		profiles   = flag.Bool("profiles", false, "List saved account profiles")
+		profileAdd = flag.String("profile-add", "", "Create a new account profile")
+		profileRm  = flag.String("profile-remove", "", "Delete an account profile and its saved data")
+		profileDef = flag.String("profile-default", "", "Set the default account profile")
+		whoami     = flag.Bool("whoami", false, "Show the saved account and session")
+		logout     = flag.Bool("logout", false, "Clear the saved session and tokens")
+		secrets    = flag.String("secret-backend", os.Getenv("MUI_SECRET_BACKEND"), "Where to keep the passToken: auto, keyring or file")
+		fastboot   = flag.String("fastboot", os.Getenv("MUI_FASTBOOT"), "Path of the fastboot binary to use instead of searching $PATH and the managed install")
+		udev       = flag.String("udev", "", "Linux USB access: check it, print the udev rules or install them")
+		tools      = flag.String("platform-tools", "", "Manage the platform-tools: install, verify, repair or uninstall")
+		toolsZip   = flag.String("platform-tools-zip", os.Getenv(platform.EnvZip), "Install the platform-tools from this local archive instead of downloading")
+		toolsURL   = flag.String("platform-tools-mirror", os.Getenv(platform.EnvMirror), "Base URL to download the platform-tools archives from")
+		toolsPin   = flag.String("platform-tools-version", os.Getenv(platform.EnvVersion), "Platform-tools release to install and require, such as 35.0.2")
+		toolsAny   = flag.Bool("platform-tools-unverified", platform.UnverifiedFromEnv(), "Allow installing the latest platform-tools or a local archive without a known SHA-256 digest")
+		jsonOut    = flag.Bool("json", false, "Print the result as one JSON document on stdout (progress goes to stderr)")
+		proxy      = flag.String("proxy", httpOpts.Proxy, "Proxy URL for every request (default HTTPS_PROXY/HTTP_PROXY, hosts in NO_PROXY go direct)")
+		caBundle   = flag.String("ca-bundle", httpOpts.CABundle, "PEM file of extra trusted certificates, such as an intercepting proxy's")
+		connectTO  = flag.Duration("connect-timeout", httpOpts.ConnectTimeout, "Time allowed to connect to a server (0 means 30s)")
+		readTO     = flag.Duration("read-timeout", httpOpts.ReadTimeout, "Time allowed to wait for a server's data (0 means 60s)")
+		configDir  = flag.String("config-dir", "", "Folder for settings such as the profile list (env MUI_CONFIG_DIR)")
+		stateDir   = flag.String("state-dir", "", "Folder for account data and tokens (env MUI_STATE_DIR)")
+		cacheDir   = flag.String("cache-dir", "", "Folder for the downloaded platform-tools (env MUI_CACHE_DIR)")
 	)
 
 	flag.Parse()
 
 	// Handle version flag
 	if *version {
+		if *jsonOut {
+			exit(nil, true, interfaces.NewResult(), interfaces.ExitOK, nil)
+		}
 		fmt.Printf("%s v%s\n", colors.BoldText("MUI Tool Unlock CLI"), colors.BoldText(types.AppVersion))
 		fmt.Println(colors.DimText("Built with Go - Xiaomi Device Unlocker"))
 		return
@@ -38,31 +77,158 @@ func main() {
 		return
 	}
 
-	// Start CLI interface
-	fmt.Println(colors.Rainbow("🔓 MUI Tool Unlock - Xiaomi Device Unlocker"))
-	fmt.Println(colors.Gradient("============================================"))
-	fmt.Printf("%s%s%s %s\n",
-		colors.DimText("[V"), colors.BoldText(types.AppVersion), colors.DimText("] For issues:"),
-		colors.UnderlineText("github.com/offici5l/MiUnlockTool"))
-	fmt.Println(colors.Section("System Initialization"))
+	// Print the udev rules alone so they can be redirected to a file
+	if *udev == "print" {
+		if err := interfaces.ManageUdevRules(report.Discard, *udev, os.Stdout); err != nil {
+			os.Exit(interfaces.ExitFailure)
+		}
+		return
+	}
 
-	// Setup platform tools first
-	fastbootPath := platform.Setup()
-	if fastbootPath == "" {
-		fmt.Println(colors.Error("Failed to setup fastboot tools"))
+	ui := report.NewTerminal()
+	if *jsonOut {
+		// Keep stdout for the JSON document
+		ui.Out = os.Stderr
+	} else {
+		// Start CLI interface
+		fmt.Println(colors.Rainbow("🔓 MUI Tool Unlock - Xiaomi Device Unlocker"))
+		fmt.Println(colors.Gradient("============================================"))
+		fmt.Printf("%s%s%s %s\n",
+			colors.DimText("[V"), colors.BoldText(types.AppVersion), colors.DimText("] For issues:"),
+			colors.UnderlineText("github.com/offici5l/MiUnlockTool"))
+	}
+	fmt.Fprintln(ui.Out, colors.Section("System Initialization"))
+
+	// Resolve the per-user folders and move files older versions kept in the working directory
+	paths.SetConfigDir(*configDir)
+	paths.SetStateDir(*stateDir)
+	paths.SetCacheDir(*cacheDir)
+	if err := interfaces.MigrateLegacyFiles(ui); err != nil {
+		ui.Warning(fmt.Sprintf("Could not move old files, retrying next time: %v", err))
+	}
+
+	// Network settings apply to the platform-tools download; cookies are set up with the profile
+	httpOpts = httpclient.Options{Proxy: *proxy, CABundle: *caBundle, ConnectTimeout: *connectTO, ReadTimeout: *readTO}
+	if httpErr == nil {
+		httpErr = httpclient.Configure(httpOpts)
+	}
+	if httpErr != nil {
+		exit(ui, *jsonOut, interfaces.NewResult(), interfaces.ExitSetup, fmt.Errorf("invalid network settings: %w", httpErr))
+	}
+
+	toolsSource := platform.Source{Zip: *toolsZip, Mirror: *toolsURL, Version: *toolsPin, Unverified: *toolsAny}
+
+	// Platform-tools management does not need an account
+	if *tools != "" {
+		err := interfaces.ManagePlatformTools(ui, *tools, toolsSource)
+		exit(ui, false, nil, interfaces.ExitCode(err), err)
+	}
+
+	// USB permission checks do not need fastboot or an account
+	if *udev != "" {
+		err := interfaces.ManageUdevRules(ui, *udev, os.Stdout)
+		exit(ui, false, nil, interfaces.ExitCode(err), err)
+	}
+
+	// Profile management commands
+	if *profileAdd != "" || *profileRm != "" || *profileDef != "" {
+		if err := interfaces.ManageProfile(ui, *profileAdd, *profileRm, *profileDef); err != nil {
+			exit(ui, false, nil, interfaces.ExitFailure, fmt.Errorf("profile command failed: %w", err))
+		}
+		return
+	}
+	if *profiles {
+		if err := interfaces.ListProfiles(ui); err != nil {
+			exit(ui, false, nil, interfaces.ExitFailure, err)
+		}
 		return
 	}
 
-	if *unlock && *account != "" && *password != "" {
-		// Direct unlock mode with parameters
-		interfaces.ProcessDirectUnlock(*account, *password, fastbootPath)
+	// Select the account profile before opening any store
+	if err := interfaces.SelectProfile(ui, *profile); err != nil {
+		exit(ui, *jsonOut, interfaces.NewResult(), interfaces.ExitSetup, fmt.Errorf("failed to select profile: %w", err))
+	}
+	if err := interfaces.ConfigureHTTP(httpOpts); err != nil {
+		exit(ui, *jsonOut, interfaces.NewResult(), interfaces.ExitSetup, fmt.Errorf("failed to open cookie jar: %w", err))
+	}
+
+	// Open the encrypted store when requested, migrating plaintext data
+	if *encrypt || *forgetPass || os.Getenv("MUI_STORE_PASSPHRASE") != "" {
+		if err := interfaces.SetupEncryptedStore(ui, *forgetPass); err != nil {
+			exit(ui, *jsonOut, interfaces.NewResult(), interfaces.ExitSetup, fmt.Errorf("failed to open encrypted store: %w", err))
+		}
+	}
+
+	// Move tokens into the keyring (or secrets file) when requested
+	if *secrets != "" {
+		if err := interfaces.SetupSecretStore(ui, *secrets); err != nil {
+			exit(ui, *jsonOut, interfaces.NewResult(), interfaces.ExitSetup, fmt.Errorf("failed to open secret store: %w", err))
+		}
+	}
+
+	// Session commands do not need fastboot
+	if *whoami {
+		if err := interfaces.ShowSession(ui); err != nil {
+			exit(ui, false, nil, interfaces.ExitFailure, err)
+		}
+		return
+	}
+	if *logout {
+		if err := interfaces.Logout(ui); err != nil {
+			exit(ui, false, nil, interfaces.ExitFailure, fmt.Errorf("logout failed: %w", err))
+		}
+		return
+	}
+
+	// Setup platform tools first
+	fastbootPath, err := platform.Setup(ui, *fastboot, toolsSource)
+	if err != nil {
+		exit(ui, *jsonOut, interfaces.NewResult(), interfaces.ExitSetup, fmt.Errorf("failed to setup fastboot tools: %w", err))
+	}
+
+	var result *interfaces.Result
+	if *unlock {
+		// Unattended unlock mode with parameters
+		opts := interfaces.DirectUnlockOptions{Account: *account, WbID: *wbID, Serial: *serial, Yes: *yes}
+		opts.Password, err = directPassword(*passFile)
+		if err != nil {
+			exit(ui, *jsonOut, interfaces.NewResult(), interfaces.ExitSetup, err)
+		}
+		result, err = interfaces.ProcessDirectUnlock(ui, opts, fastbootPath)
 	} else if *deviceMode {
 		// Device interaction mode
-		interfaces.RunDeviceMode(fastbootPath)
+		result, err = interfaces.RunDeviceMode(ui, fastbootPath, *serial)
 	} else {
 		// Interactive mode
-		interfaces.RunInteractiveUnlock(fastbootPath)
+		result, err = interfaces.RunInteractiveUnlock(ui, fastbootPath, *serial)
+	}
+	exit(ui, *jsonOut, result, interfaces.ExitCode(err), err)
+}
+
+// directPassword returns the password for --unlock from --password-file or MUI_PASSWORD.
+// There is no flag taking the password itself, so it never appears in the process list.
+func directPassword(file string) (string, error) {
+	if file != "" {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
 	}
+	return os.Getenv("MUI_PASSWORD"), nil
+}
+
+// exit reports err, or prints result as JSON when asJSON is set, and exits with code
+func exit(r report.Reporter, asJSON bool, result *interfaces.Result, code int, err error) {
+	if asJSON {
+		result.Finish(code, err)
+		if writeErr := result.WriteJSON(os.Stdout); writeErr != nil && code == interfaces.ExitOK {
+			code = interfaces.ExitFailure
+		}
+	} else if err != nil {
+		r.Error(err.Error())
+	}
+	os.Exit(code)
 }
 
 func printHelp() {
@@ -74,14 +240,57 @@ func printHelp() {
 	fmt.Println(colors.BoldText("Flags:"))
 	fmt.Printf("  %s                %s\n", colors.Info("--version"), colors.DimText("Show version information"))
 	fmt.Printf("  %s                   %s\n", colors.Info("--help"), colors.DimText("Show this help message"))
-	fmt.Printf("  %s                 %s\n", colors.Info("--unlock"), colors.DimText("Start unlock process"))
-	fmt.Printf("  %s      %s\n", colors.Info("--account <account>"), colors.DimText("Xiaomi account (email/phone/ID)"))
-	fmt.Printf("  %s    %s\n", colors.Info("--password <password>"), colors.DimText("Account password"))
+	fmt.Printf("  %s                 %s\n", colors.Info("--unlock"), colors.DimText("Unlock without prompting, failing if input is needed"))
+	fmt.Printf("  %s      %s\n", colors.Info("--account <account>"), colors.DimText("Xiaomi account (email/phone/ID), defaults to the profile's"))
+	fmt.Printf("  %s   %s\n", colors.Info("--password-file <file>"), colors.DimText("Read the account password from a file (or set MUI_PASSWORD)"))
+	fmt.Printf("  %s             %s\n", colors.Info("--wb-id <id>"), colors.DimText("Device ID from the web login, defaults to the profile's (env MUI_WB_ID)"))
+	fmt.Printf("  %s                    %s\n", colors.Info("--yes"), colors.DimText("Confirm the unlock without asking"))
 	fmt.Printf("  %s                 %s\n", colors.Info("--device"), colors.DimText("Interactive device unlock mode"))
+	fmt.Printf("  %s        %s\n", colors.Info("--serial <serial>"), colors.DimText("Device to use when several are connected, or tcp:host[:port] (env ANDROID_SERIAL)"))
+	fmt.Printf("  %s                %s\n", colors.Info("--encrypt"), colors.DimText("Store account data encrypted (passphrase from MUI_STORE_PASSPHRASE or prompt)"))
+	fmt.Printf("  %s        %s\n", colors.Info("--forget-password"), colors.DimText("Keep only the passToken, never store the password"))
+	fmt.Printf("  %s       %s\n", colors.Info("--profile <name>"), colors.DimText("Use a saved account profile"))
+	fmt.Printf("  %s               %s\n", colors.Info("--profiles"), colors.DimText("List account profiles"))
+	fmt.Printf("  %s   %s\n", colors.Info("--profile-add <name>"), colors.DimText("Create an account profile"))
+	fmt.Printf("  %s %s\n", colors.Info("--profile-remove <name>"), colors.DimText("Delete an account profile"))
+	fmt.Printf("  %s %s\n", colors.Info("--profile-default <name>"), colors.DimText("Set the default profile"))
+	fmt.Printf("  %s                 %s\n", colors.Info("--whoami"), colors.DimText("Show the saved account and session"))
+	fmt.Printf("  %s                 %s\n", colors.Info("--logout"), colors.DimText("Clear the saved session and tokens"))
+	fmt.Printf("  %s %s\n", colors.Info("--secret-backend <name>"), colors.DimText("Keep the passToken in auto, keyring or file (env MUI_SECRET_BACKEND)"))
+	fmt.Printf("  %s        %s\n", colors.Info("--fastboot <path>"), colors.DimText("Use this fastboot instead of $PATH or the managed install (env MUI_FASTBOOT)"))
+	fmt.Printf("  %s         %s\n", colors.Info("--udev <action>"), colors.DimText("Check Linux USB access, print the udev rules or install them"))
+	fmt.Printf("  %s %s\n", colors.Info("--platform-tools <action>"), colors.DimText("Install, verify, repair or uninstall the platform-tools"))
+	fmt.Printf("  %s %s\n", colors.Info("--platform-tools-zip <file>"), colors.DimText("Install the platform-tools from a local archive (env MUI_PLATFORM_TOOLS_ZIP)"))
+	fmt.Printf("  %s %s\n", colors.Info("--platform-tools-mirror <url>"), colors.DimText("Download the archives from this base URL (env MUI_PLATFORM_TOOLS_MIRROR)"))
+	fmt.Printf("  %s %s\n", colors.Info("--platform-tools-version <release>"), colors.DimText("Install and require this release, e.g. 35.0.2 (env MUI_PLATFORM_TOOLS_VERSION)"))
+	fmt.Printf("  %s %s\n", colors.Info("--platform-tools-unverified"), colors.DimText("Allow the latest or a local archive without a known SHA-256 digest (env MUI_PLATFORM_TOOLS_UNVERIFIED)"))
+	fmt.Printf("  %s            %s\n", colors.Info("--proxy <url>"), colors.DimText("Proxy for every request, default HTTPS_PROXY/HTTP_PROXY; NO_PROXY hosts go direct (env MUI_PROXY)"))
+	fmt.Printf("  %s       %s\n", colors.Info("--ca-bundle <file>"), colors.DimText("Also trust the PEM certificates in this file (env MUI_CA_BUNDLE)"))
+	fmt.Printf("  %s    %s\n", colors.Info("--connect-timeout <d>"), colors.DimText("Connection timeout such as 30s (env MUI_CONNECT_TIMEOUT)"))
+	fmt.Printf("  %s       %s\n", colors.Info("--read-timeout <d>"), colors.DimText("Timeout waiting for server data such as 60s (env MUI_READ_TIMEOUT)"))
+	fmt.Printf("  %s       %s\n", colors.Info("--config-dir <dir>"), colors.DimText("Settings folder, default $XDG_CONFIG_HOME/mui-tool-unlock (env MUI_CONFIG_DIR)"))
+	fmt.Printf("  %s        %s\n", colors.Info("--state-dir <dir>"), colors.DimText("Account data folder, default $XDG_STATE_HOME/mui-tool-unlock (env MUI_STATE_DIR)"))
+	fmt.Printf("  %s        %s\n", colors.Info("--cache-dir <dir>"), colors.DimText("Platform-tools folder, default $XDG_CACHE_HOME/mui-tool-unlock (env MUI_CACHE_DIR)"))
+	fmt.Printf("  %s                   %s\n", colors.Info("--json"), colors.DimText("Print --version, --device and unlock results as JSON on stdout"))
+	fmt.Println()
+	fmt.Println(colors.BoldText("Exit codes:"))
+	fmt.Printf("  %s  %s\n", colors.Info("0"), colors.DimText("Success"))
+	fmt.Printf("  %s  %s\n", colors.Info("1"), colors.DimText("Other failure, including a cancelled unlock"))
+	fmt.Printf("  %s  %s\n", colors.Info("2"), colors.DimText("Setup failed (platform-tools, USB permissions, profile or account store)"))
+	fmt.Printf("  %s  %s\n", colors.Info("3"), colors.DimText("Authentication failed"))
+	fmt.Printf("  %s  %s\n", colors.Info("4"), colors.DimText("Device not found in fastboot mode"))
+	fmt.Printf("  %s  %s\n", colors.Info("5"), colors.DimText("Unlock refused by the server"))
+	fmt.Printf("  %s  %s\n", colors.Info("6"), colors.DimText("Unlock wait period has not elapsed"))
+	fmt.Printf("  %s  %s\n", colors.Info("7"), colors.DimText("Fastboot failure"))
+	fmt.Printf("  %s  %s\n", colors.Info("8"), colors.DimText("Input needed while running with --unlock"))
 	fmt.Println()
 	fmt.Println(colors.BoldText("Examples:"))
 	fmt.Printf("  %s\n", colors.Success("mui-tool-unlock-terminal"))
-	fmt.Printf("  %s\n", colors.Success("mui-tool-unlock-terminal --unlock --account user@mi.com --password mypass"))
+	fmt.Printf("  %s\n", colors.Success("MUI_PASSWORD=mypass mui-tool-unlock-terminal --unlock --account user@mi.com --wb-id <id> --yes"))
+	fmt.Printf("  %s\n", colors.Success("mui-tool-unlock-terminal --profile-add work && mui-tool-unlock-terminal --profile work"))
 	fmt.Printf("  %s\n", colors.Success("mui-tool-unlock-terminal --device"))
+	fmt.Printf("  %s\n", colors.Success("mui-tool-unlock-terminal --device --serial 1a2b3c4d"))
+	fmt.Printf("  %s\n", colors.Success("mui-tool-unlock-terminal --device --json"))
+	fmt.Printf("  %s\n", colors.Success("mui-tool-unlock-terminal --platform-tools install --platform-tools-zip platform-tools_r35.0.2-linux.zip"))
 	fmt.Printf("  %s\n", colors.Success("mui-tool-unlock-terminal --version"))
 }
@@ -1,16 +1,16 @@
 package ui
 
 import (
-	"archive/zip"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-	"path/filepath"
-	"runtime"
-	"strings"
+	"sync/atomic"
 	"time"
 
+	"muitoolunlock/internal/httpclient"
+	interfaces "muitoolunlock/internal/interface"
+	"muitoolunlock/internal/platform"
+	"muitoolunlock/internal/report"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
@@ -122,17 +122,34 @@ func (i *InitScreen) createContent() *fyne.Container {
 // startProgress performs real platform setup with progress tracking
 func (i *InitScreen) startProgress() {
 	go func() {
-		// Quick check first - if tools exist, skip all UI and go straight to login
-		if i.checkPlatformToolsExist() {
-			i.transitionToLoginScreen()
-			return
+		// Move files older versions kept in the working directory; a failure is retried next start
+		interfaces.MigrateLegacyFiles(report.Discard)
+
+		// Proxy and timeout settings apply to the platform-tools download
+		err := configureHTTP()
+
+		var manager *platform.Manager
+		if err == nil {
+			manager, err = newManager()
 		}
 
-		// Tools don't exist, show download progress
-		success := i.downloadAndSetupPlatformTools()
+		// Quick check first - if a usable fastboot exists, skip all UI and go straight to login
+		if err == nil {
+			if found, discoverErr := platform.Discover(os.Getenv("MUI_FASTBOOT"), manager); discoverErr == nil {
+				setFastbootPath(found.Path)
+				i.transitionToLoginScreen()
+				return
+			}
+		}
+
+		// Tools missing or broken, show download progress
+		if err == nil {
+			err = i.setupPlatformTools(manager)
+		}
 
 		fyne.Do(func() {
-			if success {
+			if err == nil {
+				setFastbootPath(manager.FastbootPath())
 				// Setup completed successfully
 				i.statusLabel.SetText("✅ Setup completed!")
 				i.progressBar.SetValue(1.0)
@@ -148,7 +165,7 @@ func (i *InitScreen) startProgress() {
 				i.progressBar.SetValue(0.0)
 
 				errorDialog := dialog.NewError(
-					fmt.Errorf("❌ Platform Tools Setup Failed\n\nPossible causes:\n• No internet connection\n• Firewall blocking downloads\n• Insufficient disk space\n\nPlease check your connection and try again."),
+					fmt.Errorf("❌ Platform Tools Setup Failed\n\nPossible causes:\n• No internet connection\n• Firewall blocking downloads\n• Insufficient disk space\n\nPlease check your connection and try again.\n\n%v", err),
 					i.window,
 				)
 				errorDialog.SetDismissText("Retry")
@@ -161,159 +178,85 @@ func (i *InitScreen) startProgress() {
 	}()
 }
 
-// checkPlatformToolsExist checks if platform tools already exist (no UI updates)
-func (i *InitScreen) checkPlatformToolsExist() bool {
-	baseDir, err := os.Getwd()
-	if err != nil {
-		return false
-	}
-
-	var fastbootName string
-	if runtime.GOOS == "windows" {
-		fastbootName = "fastboot.exe"
-	} else {
-		fastbootName = "fastboot"
-	}
+// chosenFastboot is the fastboot binary picked by the init screen
+var chosenFastboot atomic.Value
 
-	fastbootPath := filepath.Join(baseDir, "platform-tools", fastbootName)
-	_, err = os.Stat(fastbootPath)
-	return err == nil
+// setFastbootPath records the fastboot binary the other screens use
+func setFastbootPath(path string) {
+	chosenFastboot.Store(path)
 }
 
-// downloadAndSetupPlatformTools performs download and setup with minimal UI updates
-func (i *InitScreen) downloadAndSetupPlatformTools() bool {
-	baseDir, err := os.Getwd()
-	if err != nil {
-		return false
-	}
-
-	// Show download status
-	fyne.Do(func() {
-		i.statusLabel.SetText("⬇️ Downloading platform tools...")
-		i.progressBar.SetValue(0.3)
-	})
-
-	osName := runtime.GOOS
-	if osName == "darwin" {
-		osName = "darwin"
-	}
-
-	url := fmt.Sprintf("https://dl.google.com/android/repository/platform-tools-latest-%s.zip", osName)
-	zipPath := filepath.Join(baseDir, "platform-tools.zip")
-
-	// Download
-	if err := i.downloadFileWithProgress(url, zipPath); err != nil {
-		return false
-	}
-
-	// Show extraction status
-	fyne.Do(func() {
-		i.statusLabel.SetText("📦 Extracting...")
-		i.progressBar.SetValue(0.7)
-	})
-
-	// Extract with optimized progress
-	if err := i.unzipFileOptimized(zipPath, baseDir); err != nil {
-		os.Remove(zipPath)
-		return false
+// fastbootPath returns the fastboot binary picked by the init screen
+func fastbootPath() (string, error) {
+	path, _ := chosenFastboot.Load().(string)
+	if path == "" {
+		return "", platform.ErrNotInstalled
 	}
-
-	// Cleanup and permissions
-	os.Remove(zipPath)
-	if runtime.GOOS != "windows" {
-		fastbootPath := filepath.Join(baseDir, "platform-tools", "fastboot")
-		os.Chmod(fastbootPath, 0755)
-	}
-
-	return true
+	return path, nil
 }
 
-// downloadFileWithProgress downloads a file with simplified progress updates
-func (i *InitScreen) downloadFileWithProgress(url, filepath string) error {
-	resp, err := http.Get(url)
+// newManager creates the manager for the platform-tools, installing from the environment's source
+func newManager() (*platform.Manager, error) {
+	dir, err := platform.DefaultDir()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	// Simple progress update during download (no delays)
-	fyne.Do(func() {
-		i.statusLabel.SetText("📊 Downloading...")
-		i.progressBar.SetValue(0.5)
-	})
-
-	_, err = io.Copy(out, resp.Body)
-
-	if err == nil {
-		fyne.Do(func() {
-			i.statusLabel.SetText("✅ Download completed!")
-			i.progressBar.SetValue(0.7)
-		})
+	manager := platform.NewManager(dir)
+	if err := manager.Configure(platform.SourceFromEnv()); err != nil {
+		return nil, err
 	}
-
-	return err
+	return manager, nil
 }
 
-// unzipFileOptimized extracts zip file with minimal UI updates for speed
-func (i *InitScreen) unzipFileOptimized(src, dest string) error {
-	r, err := zip.OpenReader(src)
+// configureHTTP sets up the shared HTTP client from the environment, keeping cookies with the
+// selected profile
+func configureHTTP() error {
+	opts, err := httpclient.OptionsFromEnv()
 	if err != nil {
 		return err
 	}
-	defer r.Close()
+	return interfaces.ConfigureHTTP(opts)
+}
 
-	// Simple progress update - no per-file updates
+// setupPlatformTools repairs or installs the platform-tools, moving the progress bar as it goes
+func (i *InitScreen) setupPlatformTools(manager *platform.Manager) error {
 	fyne.Do(func() {
-		i.statusLabel.SetText("📦 Extracting files...")
-		i.progressBar.SetValue(0.8)
+		i.statusLabel.SetText("⬇️ Downloading platform tools...")
+		i.progressBar.SetValue(0.3)
 	})
 
-	for _, f := range r.File {
-		rc, err := f.Open()
-		if err != nil {
-			return err
+	var lastStep platform.Step
+	lastPercent := int64(-1)
+	manager.Progress = func(p platform.Progress) {
+		if p.Total <= 0 {
+			return
 		}
-		defer rc.Close()
-
-		fpath := filepath.Join(dest, f.Name)
-		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
-			continue
+		percent := p.Done * 100 / p.Total
+		if p.Step == lastStep && percent == lastPercent {
+			return
 		}
+		lastStep, lastPercent = p.Step, percent
 
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, 0755)
-		} else {
-			if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
-				return err
-			}
-
-			outFile, err := os.Create(fpath)
-			if err != nil {
-				return err
-			}
-
-			_, err = io.Copy(outFile, rc)
-			outFile.Close()
-
-			if err != nil {
-				return err
+		fyne.Do(func() {
+			switch p.Step {
+			case platform.StepDownload:
+				i.statusLabel.SetText(fmt.Sprintf("📊 Downloading... %d%%", percent))
+				i.progressBar.SetValue(0.3 + 0.4*float64(percent)/100)
+			case platform.StepVerify:
+				i.statusLabel.SetText("🔐 Checksum verified")
+				i.progressBar.SetValue(0.7)
+			case platform.StepExtract:
+				i.statusLabel.SetText(fmt.Sprintf("📦 Extracting files... %d%%", percent))
+				i.progressBar.SetValue(0.7 + 0.25*float64(percent)/100)
+			case platform.StepDone:
+				i.statusLabel.SetText("✅ Extraction completed!")
+				i.progressBar.SetValue(0.95)
 			}
-		}
+		})
 	}
 
-	// Single completion update
-	fyne.Do(func() {
-		i.statusLabel.SetText("✅ Extraction completed!")
-		i.progressBar.SetValue(0.95)
-	})
-
-	return nil
+	_, err := manager.Prepare()
+	return err
 }
 
 // transitionToLoginScreen handles the transition from init to login screen
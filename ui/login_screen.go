@@ -1,6 +1,15 @@
 package ui
 
 import (
+	"context"
+	"errors"
+	"strings"
+
+	"muitoolunlock/internal/auth"
+	"muitoolunlock/internal/session"
+	"muitoolunlock/internal/storage"
+	"muitoolunlock/internal/types"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
@@ -22,6 +31,11 @@ type LoginScreen struct {
 	backButton    *widget.Button
 	isLinkMode    bool
 	mainContainer *fyne.Container
+	profileSelect *widget.Select
+	profileRow    *fyne.Container
+	profile       string
+	// callback receives the web login from the browser while the link form is shown
+	callback *auth.CallbackServer
 }
 
 // NewLoginScreen creates a new login screen
@@ -47,6 +61,7 @@ func (l *LoginScreen) Show() {
 	l.window.SetContent(content)
 
 	// Show window
+	l.window.SetOnClosed(l.stopCapture)
 	l.window.Show()
 }
 
@@ -98,6 +113,21 @@ func (l *LoginScreen) createContent() *fyne.Container {
 	l.linkEntry = widget.NewEntry()
 	l.linkEntry.SetPlaceHolder(lang.L("link_placeholder"))
 
+	// Profile dropdown with a button to add a new profile
+	profileLabel := widget.NewLabelWithStyle(
+		lang.L("profile"),
+		fyne.TextAlignLeading,
+		fyne.TextStyle{Bold: true},
+	)
+	l.profileSelect = widget.NewSelect(nil, l.handleProfileSelected)
+	l.profileSelect.PlaceHolder = lang.L("profile_placeholder")
+	addProfileButton := widget.NewButtonWithIcon("", theme.ContentAddIcon(), l.handleAddProfile)
+	l.profileRow = container.NewVBox(
+		profileLabel,
+		container.NewBorder(nil, nil, nil, addProfileButton, l.profileSelect),
+	)
+	l.refreshProfiles("")
+
 	// Login button
 	l.loginButton = widget.NewButton(lang.L("login_mui"), l.handleLogin)
 	l.loginButton.Importance = widget.HighImportance
@@ -131,6 +161,7 @@ func (l *LoginScreen) createLoginForm(logoContainer *fyne.Container, titleLabel,
 		titleLabel,
 		subtitleLabel,
 		widget.NewSeparator(),
+		l.profileRow,
 		layout.NewSpacer(),
 		emailLabel,
 		l.emailEntry,
@@ -256,69 +287,236 @@ func (l *LoginScreen) switchToLoginMode() {
 	l.mainContainer.Refresh()
 }
 
-// handleLogin processes login attempt
+// handleLogin saves the account and asks for the web authentication link
 func (l *LoginScreen) handleLogin() {
-	email := l.emailEntry.Text
+	email := strings.TrimSpace(l.emailEntry.Text)
 	password := l.passEntry.Text
 
 	// Basic validation
 	if email == "" || password == "" {
-		dialog.ShowInformation(
-			"Error",
-			"Please enter both email and password",
-			l.window,
-		)
+		dialog.ShowInformation(lang.L("error"), lang.L("enter_email_password"), l.window)
+		return
+	}
+
+	data, err := storage.LoadUnlockData()
+	if err != nil {
+		dialog.ShowInformation(lang.L("error"), err.Error(), l.window)
+		return
+	}
+	if data.User != email {
+		// A different account invalidates everything saved for the previous one
+		*data = types.UnlockData{User: email}
+	}
+	if err := storage.SaveUnlockData(data); err != nil {
+		dialog.ShowInformation(lang.L("error"), err.Error(), l.window)
+		return
+	}
+
+	// The device ID from an earlier web login can be reused
+	if data.WbID != "" {
+		l.authenticate(data, password)
 		return
 	}
 
-	// Direct switch to link verification mode (no credential validation)
 	l.switchToLinkMode()
+	l.captureLink()
+}
+
+// captureLink opens the login helper page and verifies the link as soon as the browser sends
+// it back. Without the helper it opens the Xiaomi login page; pasting the link keeps working.
+func (l *LoginScreen) captureLink() {
+	l.stopCapture()
+
+	server, err := auth.StartCallbackServer()
+	if err == nil {
+		if err = server.Open(); err != nil {
+			server.Close()
+		}
+	}
+	if err != nil {
+		if err := auth.OpenWebAuth(); err != nil {
+			dialog.ShowInformation(lang.L("error"), lang.L("browser_open_failed")+"\n"+auth.WebAuthURL, l.window)
+		}
+		return
+	}
+	l.callback = server
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), auth.CallbackTimeout)
+		defer cancel()
+		wbID, err := server.Wait(ctx)
+		if err != nil {
+			return
+		}
+
+		fyne.Do(func() {
+			if l.callback != server || !l.isLinkMode {
+				return
+			}
+			l.stopCapture()
+			l.linkEntry.SetText(wbID)
+			l.handleVerifyLink()
+		})
+	}()
 }
 
-// handleVerifyLink processes link verification
+// stopCapture shuts down the login helper, if one is running
+func (l *LoginScreen) stopCapture() {
+	if l.callback != nil {
+		l.callback.Close()
+		l.callback = nil
+	}
+}
+
+// handleVerifyLink extracts the device ID from the pasted link and logs in
 func (l *LoginScreen) handleVerifyLink() {
 	link := l.linkEntry.Text
 
 	// Basic validation
-	if link == "" {
-		dialog.ShowInformation(
-			"Error",
-			"Please enter a link to verify",
-			l.window,
-		)
+	if strings.TrimSpace(link) == "" {
+		dialog.ShowInformation(lang.L("error"), lang.L("enter_link"), l.window)
+		return
+	}
+
+	wbID := auth.ParseWebBrowserID(link)
+	if wbID == "" {
+		dialog.ShowInformation(lang.L("error"), lang.L("invalid_link"), l.window)
+		return
+	}
+
+	data, err := storage.LoadUnlockData()
+	if err != nil {
+		dialog.ShowInformation(lang.L("error"), err.Error(), l.window)
+		return
+	}
+	data.WbID = wbID
+	if err := storage.SaveUnlockData(data); err != nil {
+		dialog.ShowInformation(lang.L("error"), err.Error(), l.window)
 		return
 	}
 
-	// Simple validation for demo
-	if l.validateLink(link) {
-		// Close login window and open unlock screen
-		l.window.Close()
-		
-		// Create and show unlock screen
-		unlockScreen := NewUnlockScreen(l.app)
-		unlockScreen.Show()
-	} else {
-		dialog.ShowInformation(
-			"Error",
-			"Invalid link. Please check and try again.",
-			l.window,
-		)
+	l.authenticate(data, l.passEntry.Text)
+}
+
+// authenticate logs in (or reuses the saved session) and opens the unlock screen. The
+// password is only kept in memory for the session's logins.
+func (l *LoginScreen) authenticate(data *types.UnlockData, password string) {
+	progress := dialog.NewCustomWithoutButtons(lang.L("signing_in"), widget.NewProgressBarInfinite(), l.window)
+	progress.Show()
+	l.loginButton.Disable()
+	l.verifyButton.Disable()
+
+	go func() {
+		sess := session.New(data, login(password))
+		_, _, err := sess.AuthData()
+
+		fyne.Do(func() {
+			progress.Hide()
+			l.loginButton.Enable()
+			l.verifyButton.Enable()
+
+			if err != nil {
+				dialog.ShowInformation(lang.L("login_failed"), loginErrorMessage(err), l.window)
+				return
+			}
+
+			// Close login window and open unlock screen
+			l.window.Close()
+			unlockScreen := NewUnlockScreen(l.app, sess, data.WbID)
+			unlockScreen.Show()
+		})
+	}()
+}
+
+// login returns a login that tries the saved passToken, falling back to password
+func login(password string) session.LoginFunc {
+	return func(data *types.UnlockData) (*types.XiaomiAuthResponse, error) {
+		if data.PassToken != "" {
+			client := auth.NewClient()
+			client.UserID = data.UID
+			client.PassToken = data.PassToken
+			if authData, err := client.LoginWithPassToken(data.WbID); err == nil {
+				return authData, nil
+			}
+			data.PassToken = ""
+		}
+		return auth.NewClient().Login(data.User, password, data.WbID)
 	}
 }
 
-// handleBack handles back button press
-func (l *LoginScreen) handleBack() {
-	l.switchToLoginMode()
+// loginErrorMessage renders a login failure for the user
+func loginErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return lang.L("login_invalid_credentials")
+	case errors.Is(err, auth.ErrCaptchaRequired):
+		return lang.L("login_captcha")
+	case errors.Is(err, auth.ErrTwoFactorRequired):
+		return lang.L("login_two_factor")
+	default:
+		return err.Error()
+	}
+}
+
+// refreshProfiles reloads the profile list and selects selected (or the default profile)
+func (l *LoginScreen) refreshProfiles(selected string) {
+	profiles, defaultProfile, err := storage.ListProfiles()
+	if err != nil {
+		return
+	}
+
+	l.profileSelect.Options = profiles
+	if selected == "" {
+		selected = defaultProfile
+	}
+	if selected != "" {
+		l.profileSelect.SetSelected(selected)
+	}
+	l.profileSelect.Refresh()
 }
 
-// validateLink validates the provided link
-func (l *LoginScreen) validateLink(link string) bool {
-	// Simple validation for demo - in a real app, you'd verify against your system
-	// For demo purposes, accept links that contain "mui" or start with "http"
-	if len(link) < 5 {
-		return false
+// handleProfileSelected switches storage to the chosen profile and fills in its account
+func (l *LoginScreen) handleProfileSelected(name string) {
+	if _, err := storage.UseProfile(name); err != nil {
+		dialog.ShowError(err, l.window)
+		return
 	}
+	if err := configureHTTP(); err != nil {
+		dialog.ShowError(err, l.window)
+		return
+	}
+	l.profile = name
 
-	// Accept any reasonable URL format or containing "mui"
-	return link[:4] == "http" || len(link) > 10
+	account, err := storage.ProfileAccount(name)
+	if err != nil {
+		dialog.ShowError(err, l.window)
+		return
+	}
+	l.emailEntry.SetText(account)
+	l.passEntry.SetText("")
+}
+
+// handleAddProfile asks for a profile name and creates it
+func (l *LoginScreen) handleAddProfile() {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder(lang.L("profile_name_placeholder"))
+
+	dialog.ShowForm(lang.L("new_profile"), lang.L("add"), lang.L("cancel"),
+		[]*widget.FormItem{widget.NewFormItem(lang.L("profile_name"), nameEntry)},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := storage.AddProfile(nameEntry.Text); err != nil {
+				dialog.ShowError(err, l.window)
+				return
+			}
+			l.refreshProfiles(nameEntry.Text)
+		}, l.window)
+}
+
+// handleBack handles back button press
+func (l *LoginScreen) handleBack() {
+	l.stopCapture()
+	l.switchToLoginMode()
 }
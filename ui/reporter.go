@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"errors"
+
+	"muitoolunlock/internal/report"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/widget"
+)
+
+// errCancelled is returned when the user dismisses a prompt
+var errCancelled = errors.New("cancelled by user")
+
+// fyneUI shows messages from the internal packages in a status label and asks questions
+// with dialogs. It must be used from a background goroutine: prompts block until answered.
+type fyneUI struct {
+	window fyne.Window
+	status *widget.Label
+}
+
+var _ report.UI = (*fyneUI)(nil)
+
+// newFyneUI creates a UI reporting into status, with dialogs on window
+func newFyneUI(window fyne.Window, status *widget.Label) *fyneUI {
+	return &fyneUI{window: window, status: status}
+}
+
+func (f *fyneUI) Section(title string)    { f.setStatus(title) }
+func (f *fyneUI) Progress(message string) { f.setStatus(message) }
+func (f *fyneUI) Info(message string)     { f.setStatus(message) }
+func (f *fyneUI) Success(message string)  { f.setStatus(message) }
+func (f *fyneUI) Warning(message string)  { f.setStatus(message) }
+
+func (f *fyneUI) Field(label, value string) {
+	f.setStatus(label + ": " + value)
+}
+
+// Error shows the message in a dialog as well as the status label
+func (f *fyneUI) Error(message string) {
+	f.setStatus(message)
+	fyne.Do(func() {
+		dialog.ShowError(errors.New(message), f.window)
+	})
+}
+
+func (f *fyneUI) Confirm(question string, defaultYes bool) bool {
+	answer := make(chan bool, 1)
+	fyne.Do(func() {
+		dialog.ShowConfirm(lang.L("title"), question, func(ok bool) {
+			answer <- ok
+		}, f.window)
+	})
+	return <-answer
+}
+
+func (f *fyneUI) Input(prompt string) string {
+	text, _ := f.ask(prompt, widget.NewEntry())
+	return text
+}
+
+func (f *fyneUI) Secret(prompt string) (string, error) {
+	return f.ask(prompt, widget.NewPasswordEntry())
+}
+
+// ask shows a one-field form and waits for it to be submitted or cancelled
+func (f *fyneUI) ask(prompt string, entry *widget.Entry) (string, error) {
+	type result struct {
+		text string
+		ok   bool
+	}
+	answer := make(chan result, 1)
+
+	fyne.Do(func() {
+		dialog.ShowForm(prompt, lang.L("ok"), lang.L("cancel"),
+			[]*widget.FormItem{widget.NewFormItem("", entry)},
+			func(ok bool) {
+				answer <- result{text: entry.Text, ok: ok}
+			}, f.window)
+	})
+
+	r := <-answer
+	if !r.ok {
+		return "", errCancelled
+	}
+	return r.text, nil
+}
+
+// setStatus updates the status label on the UI goroutine
+func (f *fyneUI) setStatus(message string) {
+	fyne.Do(func() {
+		f.status.SetText(message)
+	})
+}
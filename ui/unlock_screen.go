@@ -1,7 +1,16 @@
 package ui
 
 import (
-	"time"
+	"errors"
+	"fmt"
+	"strings"
+
+	"muitoolunlock/internal/device"
+	"muitoolunlock/internal/platform"
+	"muitoolunlock/internal/session"
+	"muitoolunlock/internal/types"
+	"muitoolunlock/internal/unlock"
+	"muitoolunlock/internal/unlockapi"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -17,16 +26,29 @@ type UnlockScreen struct {
 	app           fyne.App
 	window        fyne.Window
 	waitingLabel  *widget.Label
+	deviceLabel   *widget.Label
+	deviceSelect  *widget.Select
 	unlockButton  *widget.Button
 	mainContainer *fyne.Container
 	isWaiting     bool
+	devices       []device.Device
+	serial        string
+	// source lists attached phones; tests can swap in a device.FakeSource
+	source  device.Source
+	watcher *device.Watcher
+	info    *types.DeviceInfo
+	sess    *session.Session
+	wbID    string
+	busy    bool
 }
 
-// NewUnlockScreen creates a new unlock screen
-func NewUnlockScreen(app fyne.App) *UnlockScreen {
+// NewUnlockScreen creates a new unlock screen for the logged-in session
+func NewUnlockScreen(app fyne.App, sess *session.Session, wbID string) *UnlockScreen {
 	return &UnlockScreen{
 		app:       app,
 		isWaiting: true,
+		sess:      sess,
+		wbID:      wbID,
 	}
 }
 
@@ -45,8 +67,9 @@ func (u *UnlockScreen) Show() {
 	// Show window
 	u.window.Show()
 
-	// Start waiting sequence
-	go u.startWaitingSequence()
+	// Follow phones being attached and detached
+	u.window.SetOnClosed(u.stopWatching)
+	u.startWatching()
 }
 
 // createContent creates the unlock screen content
@@ -70,11 +93,21 @@ func (u *UnlockScreen) createContent() *fyne.Container {
 		fyne.TextStyle{Italic: true},
 	)
 
-	// Unlock button (initially hidden)
+	// Device picker (shown when more than one phone is attached)
+	u.deviceSelect = widget.NewSelect(nil, u.handleDeviceSelected)
+	u.deviceSelect.PlaceHolder = lang.L("device_select_placeholder")
+	u.deviceSelect.Hide()
+
+	// Device details (filled in once a device answers)
+	u.deviceLabel = widget.NewLabel("")
+	u.deviceLabel.Alignment = fyne.TextAlignCenter
+	u.deviceLabel.Hide()
+
+	// Unlock button (disabled until a phone is connected)
 	u.unlockButton = widget.NewButton(lang.L("unlock"), u.handleUnlock)
 	u.unlockButton.Importance = widget.HighImportance
 	u.unlockButton.Resize(fyne.NewSize(200, 60))
-	u.unlockButton.Hide() // Start hidden
+	u.unlockButton.Disable()
 
 	// Main container that will show either waiting text or unlock button
 	u.mainContainer = container.NewVBox(
@@ -83,6 +116,8 @@ func (u *UnlockScreen) createContent() *fyne.Container {
 		titleLabel,
 		layout.NewSpacer(),
 		u.waitingLabel,
+		container.NewCenter(u.deviceSelect),
+		u.deviceLabel,
 		layout.NewSpacer(),
 		container.NewCenter(u.unlockButton),
 		layout.NewSpacer(),
@@ -96,32 +131,258 @@ func (u *UnlockScreen) createContent() *fyne.Container {
 	)
 }
 
-// startWaitingSequence handles the waiting -> unlock button sequence
-func (u *UnlockScreen) startWaitingSequence() {
-	// Wait 1 second
-	time.Sleep(1 * time.Second)
+// startWatching starts the device watcher and applies its events on the UI thread
+func (u *UnlockScreen) startWatching() {
+	if u.source == nil {
+		path, err := fastbootPath()
+		if err != nil {
+			u.repairFastboot(err)
+			return
+		}
+		u.source = &device.FastbootSource{Path: path}
+	}
+
+	u.watcher = device.NewWatcher(u.source, device.DefaultPollInterval)
+	events := u.watcher.Start()
+	go func() {
+		for event := range events {
+			fyne.Do(func() {
+				u.handleDeviceEvent(event)
+			})
+		}
+	}()
+}
+
+// repairFastboot reports why there is no fastboot to talk to devices with and offers to install
+// or repair the platform-tools until one works, then starts watching
+func (u *UnlockScreen) repairFastboot(cause error) {
+	ui := newFyneUI(u.window, u.waitingLabel)
+
+	go func() {
+		ui.Warning(fmt.Sprintf("No usable fastboot: %v", cause))
+		for ui.Confirm(lang.L("repair_platform_tools"), true) {
+			manager, err := newManager()
+			if err == nil {
+				manager.Progress = platform.ReportProgress(ui)
+				var found *platform.Fastboot
+				if found, err = manager.Prepare(); err == nil {
+					setFastbootPath(found.Path)
+					ui.Success(lang.L("waiting_to_connect"))
+					fyne.Do(u.startWatching)
+					return
+				}
+			}
+			ui.Error(fmt.Sprintf("Platform-tools setup failed: %v", err))
+		}
+	}()
+}
+
+// stopWatching stops the device watcher when the window closes
+func (u *UnlockScreen) stopWatching() {
+	if u.watcher != nil {
+		u.watcher.Stop()
+	}
+}
+
+// handleDeviceEvent updates the device list and the connection state
+func (u *UnlockScreen) handleDeviceEvent(event device.Event) {
+	devices := make([]device.Device, 0, len(u.devices)+1)
+	for _, d := range u.devices {
+		if d.Serial != event.Device.Serial {
+			devices = append(devices, d)
+		}
+	}
+	if event.Type == device.Attached {
+		devices = append(devices, event.Device)
+	}
+	u.setDevices(devices)
 
-	// Use fyne.Do to ensure UI operations happen on main thread
-	fyne.Do(func() {
-		// Hide waiting text and show unlock button
+	// Waiting text while no phone is attached, Unlock button once one is
+	u.isWaiting = len(devices) == 0
+	if u.isWaiting {
+		u.serial = ""
+		u.info = nil
+		u.waitingLabel.Show()
+		u.deviceLabel.Hide()
+		u.unlockButton.Disable()
+	} else {
 		u.waitingLabel.Hide()
-		u.unlockButton.Show()
-		u.isWaiting = false
-		
-		// Refresh the container
-		u.mainContainer.Refresh()
-	})
+		if !u.busy && u.info != nil {
+			u.unlockButton.Enable()
+		}
+	}
+
+	// Refresh the container
+	u.mainContainer.Refresh()
+}
+
+// setDevices fills the device picker and selects the first device
+func (u *UnlockScreen) setDevices(devices []device.Device) {
+	u.devices = devices
+
+	options := make([]string, len(devices))
+	for i, d := range devices {
+		options[i] = deviceOption(d)
+	}
+	u.deviceSelect.SetOptions(options)
+
+	if len(devices) > 1 {
+		u.deviceSelect.Show()
+	} else {
+		u.deviceSelect.Hide()
+	}
+	// Keep the current device selected while it stays attached
+	for _, d := range devices {
+		if d.Serial == u.serial {
+			if u.deviceSelect.Selected != deviceOption(d) {
+				u.deviceSelect.SetSelected(deviceOption(d))
+			}
+			return
+		}
+	}
+	if len(devices) > 0 {
+		u.deviceSelect.SetSelectedIndex(0)
+	}
+}
+
+// handleDeviceSelected switches the target device and loads its details. Unlock stays disabled
+// until they arrive, so the previous device's details are never used for the new one.
+func (u *UnlockScreen) handleDeviceSelected(option string) {
+	for _, d := range u.devices {
+		if deviceOption(d) != option {
+			continue
+		}
+		u.serial = d.Serial
+		u.info = nil
+		u.deviceLabel.Hide()
+		u.unlockButton.Disable()
+
+		go func(serial string) {
+			path, err := fastbootPath()
+			var info *types.DeviceInfo
+			if err == nil {
+				info, err = device.Snapshot(path, serial)
+			}
+			fyne.Do(func() {
+				if u.serial != serial {
+					return
+				}
+				if err != nil {
+					u.deviceLabel.SetText(err.Error())
+					u.deviceLabel.Show()
+					return
+				}
+				u.showDeviceInfo(info)
+				if !u.busy {
+					u.unlockButton.Enable()
+				}
+			})
+		}(d.Serial)
+		return
+	}
 }
 
-// handleUnlock processes unlock button press
+// deviceOption labels a device in the picker
+func deviceOption(d device.Device) string {
+	if d.Product == "" {
+		return d.Serial
+	}
+	return d.Serial + " (" + d.Product + ")"
+}
+
+// showDeviceInfo renders the device snapshot under the title
+func (u *UnlockScreen) showDeviceInfo(info *types.DeviceInfo) {
+	lines := []string{lang.L("device_product") + ": " + info.Product}
+	if info.Unlocked != "" {
+		lines = append(lines, lang.L("device_unlocked")+": "+info.Unlocked)
+	}
+	for _, field := range device.Fields(info) {
+		lines = append(lines, field.Label+": "+field.Value)
+	}
+
+	u.info = info
+	u.deviceLabel.SetText(strings.Join(lines, "\n"))
+	u.deviceLabel.Show()
+}
+
+// handleUnlock runs the unlock flow for the selected device, with its status in the progress
+// label and its questions in dialogs
 func (u *UnlockScreen) handleUnlock() {
-	// Show success dialog
-	dialog.ShowInformation(
-		"Success",
-		"Device unlocked successfully!",
-		u.window,
-	)
-	
-	// Here you could add actual unlock logic
-	// For now, just show success message
+	info := u.info
+	if u.serial == "" || info == nil {
+		dialog.ShowInformation(lang.L("error"), lang.L("no_device"), u.window)
+		return
+	}
+	if info.Unlocked == "yes" || info.Unlocked == "true" {
+		dialog.ShowInformation(lang.L("success"), lang.L("already_unlocked"), u.window)
+		return
+	}
+
+	progress := u.showProgress(lang.L("unlock_checking"))
+	ui := newFyneUI(u.window, progress)
+	serial := u.serial
+
+	go func() {
+		path, err := fastbootPath()
+		var resp *types.UnlockResponse
+		if err == nil {
+			resp, err = unlock.PerformUnlock(ui, info, u.sess, u.wbID, path, serial)
+		}
+
+		fyne.Do(func() {
+			u.hideProgress(progress)
+			switch {
+			case errors.Is(err, unlock.ErrCancelled):
+			case errors.Is(err, unlock.ErrAuthFailed):
+				dialog.ShowInformation(lang.L("login_failed"), loginErrorMessage(err), u.window)
+			case err != nil:
+				dialog.ShowInformation(lang.L("unlock_failed"), unlockErrorMessage(err, resp), u.window)
+			default:
+				dialog.ShowInformation(lang.L("success"), lang.L("unlock_success"), u.window)
+			}
+		})
+	}()
+}
+
+// showProgress disables the Unlock button and shows status text in place of the device details
+func (u *UnlockScreen) showProgress(text string) *widget.Label {
+	u.busy = true
+	u.unlockButton.Disable()
+
+	u.waitingLabel.SetText(text)
+	u.waitingLabel.Show()
+	return u.waitingLabel
+}
+
+// hideProgress restores the screen after an operation finishes
+func (u *UnlockScreen) hideProgress(label *widget.Label) {
+	u.busy = false
+	label.SetText(lang.L("waiting_to_connect"))
+	if u.isWaiting {
+		return
+	}
+	label.Hide()
+	if u.info != nil {
+		u.unlockButton.Enable()
+	}
+}
+
+// unlockErrorMessage renders an unlock failure with its localized meaning and remedy
+func unlockErrorMessage(err error, resp *types.UnlockResponse) string {
+	var apiErr *unlockapi.APIError
+	if !errors.As(err, &apiErr) {
+		return err.Error()
+	}
+
+	info, ok := unlockapi.LookupCode(apiErr.Code)
+	if !ok {
+		return lang.X("unlock_error_unknown", "The unlock server returned code {{.Code}}.", map[string]any{"Code": apiErr.Code})
+	}
+
+	message := lang.X(info.Key, info.Description) + "\n\n" + lang.X(info.Key+"_remedy", info.Remedy)
+	if errors.Is(err, unlockapi.ErrWaitPeriod) && resp != nil && !resp.WaitUntil.IsZero() {
+		message += "\n\n" + lang.X("unlock_error_wait_until", "You can unlock on {{.Time}}.",
+			map[string]any{"Time": resp.WaitUntil.Format("2006-01-02 15:04")})
+	}
+	return message
 }